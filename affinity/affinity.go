@@ -13,21 +13,40 @@ import (
 
 var explanation = `We are utilizing a new workflow in our issues and pull requests. Affinity teams have been setup to allow community members to hear about pull requests that may be interesting to them. When a new issue or pull request comes in, we are asking that the author mention the appropriate affinity team. I then assign a random "team captain" or two to the issue who is in charge of triaging it until it is closed or passing it off to another captain. In order to move forward with this new workflow, we need to know: which of the following teams best fits your issue or contribution?`
 
-func assignTeamCaptains(context *ctx.Context, handler Handler, body string, assigneeCount int) error {
+// assignTeamCaptains assigns captains of the team mentioned in the subject.
+// For newly opened issues & pull requests, the routing rules are tried next
+// and, if no team matches, the author is asked which team fits.
+func assignTeamCaptains(context *ctx.Context, handler *Handler, subject Subject, assigneeCount int, opened bool) error {
 	if context.Issue.IsEmpty() {
 		context.IncrStat("affinity.error.no_ref")
 		return context.NewError("assignTeamCaptains: issue reference was not set; bailing")
 	}
 
-	team, err := findAffinityTeam(body, handler.teams)
+	teams := handler.GetTeams()
+	team, err := findAffinityTeam(subject.Body, teams)
+	if err != nil && opened && len(handler.rules) > 0 {
+		if err := handler.completeSubject(context, context.Issue.Owner, context.Issue.Repo, context.Issue.Num, &subject); err != nil {
+			context.IncrStat("affinity.error.github_api")
+			return context.NewError("assignTeamCaptains: %v", err)
+		}
+		if team, err = Route(teams, handler.rules, subject); err == nil {
+			context.IncrStat("affinity.routed")
+		}
+	}
 	if err != nil {
 		context.IncrStat("affinity.error.no_team")
-		//return askForAffinityTeam(context, handler.teams)
-		return context.NewError("%s: no team in the message body; unable to assign", context.Issue)
+		if opened {
+			return askForAffinityTeam(context, teams)
+		}
+		return context.NewSkip("%s: no team in the message body; unable to assign", context.Issue)
 	}
 
 	context.Log("team: %s, excluding: %s", team, context.Issue.Author)
-	victims := team.RandomCaptainLoginsExcluding(context.Issue.Author, assigneeCount)
+	victims, err := team.SelectCaptains(context, context.Issue.Owner, context.Issue.Repo, []string{context.Issue.Author}, assigneeCount)
+	if err != nil {
+		context.IncrStat("affinity.error.github_api")
+		return context.NewError("assignTeamCaptains: problem selecting captains: %v", err)
+	}
 	if len(victims) == 0 {
 		context.IncrStat("affinity.error.no_acceptable_captains")
 		return context.NewError("%s: team captains other than issue author could not be found", context.Issue)
@@ -58,8 +77,18 @@ func findAffinityTeam(body string, allTeams []Team) (Team, error) {
 	return Team{}, fmt.Errorf("findAffinityTeam: no matching team")
 }
 
+// askForAffinityTeam asks the author which team fits the issue, unless that
+// was asked already.
 func askForAffinityTeam(context *ctx.Context, allTeams []Team) error {
-	_, _, err := context.GitHub.Issues.CreateComment(
+	comments, err := listComments(context, context.Issue.Owner, context.Issue.Repo, context.Issue.Num)
+	if err != nil {
+		return context.NewError("askForAffinityTeam: could not list comments: %v", err)
+	}
+	if findBotComment(context, comments, explanation) != nil {
+		return context.NewSkip("askForAffinityTeam: already asked on %s", context.Issue)
+	}
+
+	_, _, err = context.GitHub.Issues.CreateComment(
 		context.Issue.Owner,
 		context.Issue.Repo,
 		context.Issue.Num,
@@ -68,6 +97,35 @@ func askForAffinityTeam(context *ctx.Context, allTeams []Team) error {
 	if err != nil {
 		return context.NewError("askForAffinityTeam: could not leave comment: %v", err)
 	}
+	context.IncrStat("affinity.asked")
+	return nil
+}
+
+func listComments(context *ctx.Context, owner, repo string, number int) ([]*github.IssueComment, error) {
+	var comments []*github.IssueComment
+	opt := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		page, resp, err := context.GitHub.Issues.ListComments(owner, repo, number, opt)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, page...)
+		if resp.NextPage == 0 {
+			return comments, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// findBotComment returns the first of the comments left by the bot which
+// contains text, or nil if there's none.
+func findBotComment(context *ctx.Context, comments []*github.IssueComment, text string) *github.IssueComment {
+	for _, comment := range comments {
+		if comment.User != nil && comment.User.Login != nil && comment.Body != nil &&
+			context.GitHubAuthedAs(*comment.User.Login) && strings.Contains(*comment.Body, text) {
+			return comment
+		}
+	}
 	return nil
 }
 
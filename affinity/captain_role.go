@@ -0,0 +1,46 @@
+package affinity
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/buntobot/auto-reply/auth"
+	"github.com/buntobot/auto-reply/ctx"
+)
+
+// CaptainRole is the auth.Role of the captains of a repo's affinity teams,
+// e.g. to let them triage issues without push access.
+const CaptainRole auth.Role = "affinity_captain"
+
+// handlersByRepo maps "owner/name" to the handler the repo was last added
+// to, so a reloaded configuration replaces the old handlers.
+var handlersByRepo = struct {
+	sync.Mutex // protects 'handlers'
+	handlers   map[string]*Handler
+}{handlers: map[string]*Handler{}}
+
+func init() {
+	auth.RegisterRole(CaptainRole, isCaptain)
+}
+
+func registerRepo(h *Handler, owner, name string) {
+	handlersByRepo.Lock()
+	defer handlersByRepo.Unlock()
+	handlersByRepo.handlers[strings.ToLower(owner+"/"+name)] = h
+}
+
+func isCaptain(context *ctx.Context, command auth.Command) bool {
+	handlersByRepo.Lock()
+	h := handlersByRepo.handlers[strings.ToLower(command.Owner+"/"+command.Repo)]
+	handlersByRepo.Unlock()
+	if h == nil {
+		return false
+	}
+
+	for _, team := range h.GetTeams() {
+		if team.IsCaptain(command.Login) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,273 @@
+package affinity
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/buntobot/auto-reply/auth"
+	"github.com/buntobot/auto-reply/commands"
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/google/go-github/github"
+)
+
+var (
+	teamMentionRegexp = regexp.MustCompile(`^@[\w-]+/[\w-]+$`)
+	meRegexp          = regexp.MustCompile(`(?i)^me$`)
+)
+
+// Commands returns the commands which let captains pass an issue off to
+// another captain of its team:
+//
+//	@buntobot: reassign              swaps the team's assigned captains (or the
+//	                                 commenter, if assigned) for others
+//	@buntobot: assign @org/team      assigns a captain of the team
+//	@buntobot: unassign me           unassigns the commenter
+//	@buntobot: away                  stops assigning the commenter anything
+//	@buntobot: back                  starts assigning the commenter again
+//
+// New captains are never the author, someone already assigned or away.
+func (h *Handler) Commands() []commands.Command {
+	triagers := []auth.Role{CaptainRole, auth.PermissionRole(auth.TriagePermission)}
+	return []commands.Command{
+		{
+			Name:    "reassign",
+			Summary: "passes the issue off to other captains of its affinity team.",
+			Roles:   triagers,
+			Enabled: h.enabledForRepo,
+			Handler: h.Reassign,
+		},
+		{
+			Name:    "assign",
+			Summary: "assigns a captain of the affinity team, e.g. `/assign @bunto/documentation`.",
+			Args:    []commands.Arg{{Name: "team", Pattern: teamMentionRegexp}},
+			Roles:   append([]auth.Role{auth.AuthorRole}, triagers...),
+			Enabled: h.enabledForRepo,
+			Handler: h.Assign,
+		},
+		{
+			Name:    "unassign",
+			Summary: "unassigns you.",
+			Args:    []commands.Arg{{Name: "me", Pattern: meRegexp}},
+			Roles:   []auth.Role{auth.AnyoneRole},
+			Enabled: h.enabledForRepo,
+			Handler: h.Unassign,
+		},
+		{
+			Name:    "away",
+			Summary: "stops assigning you anything, until you're `back`.",
+			Roles:   []auth.Role{CaptainRole},
+			Enabled: h.enabledForRepo,
+			Handler: setAvailability(false),
+		},
+		{
+			Name:    "back",
+			Summary: "starts assigning you again.",
+			Roles:   []auth.Role{CaptainRole},
+			Enabled: h.enabledForRepo,
+			Handler: setAvailability(true),
+		},
+	}
+}
+
+// Reassign replaces the commenter, if assigned, or else the assigned
+// captains of the issue's team with as many other captains of the team.
+func (h *Handler) Reassign(context *ctx.Context, invocation *commands.Invocation) error {
+	h.refreshIfStale(context)
+	issue, err := fetchIssue(context, invocation)
+	if err != nil {
+		return err
+	}
+	assignees := usersByLogin(issue.Assignees)
+
+	team, ok := h.teamOfAssignees(assignees)
+	if !ok {
+		subject := Subject{Title: stringValue(issue.Title), Body: stringValue(issue.Body), Labels: labelNames(issue.Labels)}
+		if issue.PullRequestLinks == nil {
+			subject.Files = []string{}
+		}
+		if err := h.completeSubject(context, invocation.Owner, invocation.Repo, invocation.Number, &subject); err != nil {
+			context.IncrStat("affinity.error.github_api")
+			return context.NewError("affinity.Reassign: %v", err)
+		}
+		if team, err = Route(h.GetTeams(), h.rules, subject); err != nil {
+			context.IncrStat("affinity.error.no_team")
+			replyTo(context, invocation, "I don't know which affinity team this belongs to. Pick one with `assign`:\n\n"+h.teamList())
+			return context.NewSkip("affinity.Reassign: no team for %s/%s#%d", invocation.Owner, invocation.Repo, invocation.Number)
+		}
+	}
+
+	outgoing := []string{}
+	if containsLogin(assignees, invocation.Login) {
+		outgoing = append(outgoing, invocation.Login)
+	} else {
+		for _, assignee := range assignees {
+			if team.IsCaptain(assignee) {
+				outgoing = append(outgoing, assignee)
+			}
+		}
+	}
+	count := len(outgoing)
+	if count == 0 {
+		count = 1
+	}
+
+	incoming, err := team.SelectCaptains(context, invocation.Owner, invocation.Repo, append(assignees, invocation.Author), count)
+	if err != nil {
+		context.IncrStat("affinity.error.github_api")
+		return context.NewError("affinity.Reassign: problem selecting captains: %v", err)
+	}
+	if len(incoming) == 0 {
+		context.IncrStat("affinity.error.no_acceptable_captains")
+		replyTo(context, invocation, fmt.Sprintf("there's no other captain of %s to pass this off to.", team.Mention))
+		return context.NewSkip("affinity.Reassign: no other captain of %s for %s/%s#%d", team.Mention, invocation.Owner, invocation.Repo, invocation.Number)
+	}
+
+	if err := swapAssignees(context, invocation, incoming, outgoing); err != nil {
+		return err
+	}
+	context.IncrStat("affinity.reassigned")
+	return nil
+}
+
+// Assign adds a random captain of the team mentioned to the assignees.
+func (h *Handler) Assign(context *ctx.Context, invocation *commands.Invocation) error {
+	h.refreshIfStale(context)
+	team, ok := h.teamByMention(invocation.Arg("team"))
+	if !ok {
+		replyTo(context, invocation, fmt.Sprintf("`%s` isn't one of our affinity teams:\n\n%s", invocation.Arg("team"), h.teamList()))
+		return context.NewSkip("affinity.Assign: unknown team %q", invocation.Arg("team"))
+	}
+
+	issue, err := fetchIssue(context, invocation)
+	if err != nil {
+		return err
+	}
+	assignees := usersByLogin(issue.Assignees)
+	incoming, err := team.SelectCaptains(context, invocation.Owner, invocation.Repo, append(assignees, invocation.Author), 1)
+	if err != nil {
+		context.IncrStat("affinity.error.github_api")
+		return context.NewError("affinity.Assign: problem selecting captains: %v", err)
+	}
+	if len(incoming) == 0 {
+		context.IncrStat("affinity.error.no_acceptable_captains")
+		replyTo(context, invocation, fmt.Sprintf("every captain of %s is already on this, or opened it.", team.Mention))
+		return context.NewSkip("affinity.Assign: no other captain of %s for %s/%s#%d", team.Mention, invocation.Owner, invocation.Repo, invocation.Number)
+	}
+
+	if err := swapAssignees(context, invocation, incoming, nil); err != nil {
+		return err
+	}
+	context.IncrStat("affinity.assigned")
+	return nil
+}
+
+// Unassign removes the commenter from the assignees.
+func (h *Handler) Unassign(context *ctx.Context, invocation *commands.Invocation) error {
+	issue, err := fetchIssue(context, invocation)
+	if err != nil {
+		return err
+	}
+	assignees := usersByLogin(issue.Assignees)
+	if !containsLogin(assignees, invocation.Login) {
+		replyTo(context, invocation, "you aren't assigned to this.")
+		return context.NewSkip("affinity.Unassign: %s isn't assigned to %s/%s#%d", invocation.Login, invocation.Owner, invocation.Repo, invocation.Number)
+	}
+
+	if err := swapAssignees(context, invocation, nil, []string{invocation.Login}); err != nil {
+		return err
+	}
+	context.IncrStat("affinity.unassigned")
+	return nil
+}
+
+// setAvailability returns the handler of the away & back commands.
+func setAvailability(available bool) commands.Handler {
+	return func(context *ctx.Context, invocation *commands.Invocation) error {
+		if err := SetAvailable(invocation.Login, available); err != nil {
+			context.Log("affinity: couldn't persist that %s is away or back: %v", invocation.Login, err)
+		}
+		if available {
+			context.IncrStat("affinity.captain_back")
+			replyTo(context, invocation, "welcome back! I'll assign you again.")
+		} else {
+			context.IncrStat("affinity.captain_away")
+			replyTo(context, invocation, "got it, I won't assign you anything until you tell me you're `back`.")
+		}
+		return nil
+	}
+}
+
+// teamOfAssignees returns the first team one of the assignees captains.
+func (h *Handler) teamOfAssignees(assignees []string) (Team, bool) {
+	for _, team := range h.GetTeams() {
+		for _, assignee := range assignees {
+			if team.IsCaptain(assignee) {
+				return team, true
+			}
+		}
+	}
+	return Team{}, false
+}
+
+func (h *Handler) teamByMention(mention string) (Team, bool) {
+	for _, team := range h.GetTeams() {
+		if strings.EqualFold(team.Mention, mention) {
+			return team, true
+		}
+	}
+	return Team{}, false
+}
+
+func (h *Handler) teamList() string {
+	teams := []string{}
+	for _, team := range h.GetTeams() {
+		teams = append(teams, fmt.Sprintf("- `%s` – %s", team.Mention, team.Description))
+	}
+	return strings.Join(teams, "\n")
+}
+
+// fetchIssue returns the issue or pull request as it is now, rather than
+// as the event carried it.
+func fetchIssue(context *ctx.Context, invocation *commands.Invocation) (*github.Issue, error) {
+	issue, _, err := context.GitHub.Issues.Get(invocation.Owner, invocation.Repo, invocation.Number)
+	if err != nil {
+		context.IncrStat("affinity.error.github_api")
+		return nil, context.NewError("affinity: couldn't fetch %s/%s#%d: %v", invocation.Owner, invocation.Repo, invocation.Number, err)
+	}
+	return issue, nil
+}
+
+func swapAssignees(context *ctx.Context, invocation *commands.Invocation, incoming, outgoing []string) error {
+	if len(incoming) > 0 {
+		_, _, err := context.GitHub.Issues.AddAssignees(invocation.Owner, invocation.Repo, invocation.Number, incoming)
+		if err != nil {
+			context.IncrStat("affinity.error.github_api")
+			return context.NewError("affinity: problem assigning %q to %s/%s#%d: %v", incoming, invocation.Owner, invocation.Repo, invocation.Number, err)
+		}
+	}
+	if len(outgoing) > 0 {
+		_, _, err := context.GitHub.Issues.RemoveAssignees(invocation.Owner, invocation.Repo, invocation.Number, outgoing)
+		if err != nil {
+			context.IncrStat("affinity.error.github_api")
+			return context.NewError("affinity: problem unassigning %q from %s/%s#%d: %v", outgoing, invocation.Owner, invocation.Repo, invocation.Number, err)
+		}
+	}
+	context.Log("affinity: %s assigned %q and unassigned %q", invocation, incoming, outgoing)
+	return nil
+}
+
+func replyTo(context *ctx.Context, invocation *commands.Invocation, message string) {
+	if err := invocation.Reply(context, message); err != nil {
+		context.Log("ERROR replying to %s: %v", invocation, err)
+	}
+}
+
+func containsLogin(logins []string, login string) bool {
+	for _, candidate := range logins {
+		if strings.EqualFold(candidate, login) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package affinity
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/buntobot/auto-reply/commands"
+	"github.com/buntobot/auto-reply/internal/githubtest"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssignmentCommands(t *testing.T) {
+	mux, context, teardown := githubtest.Setup()
+	defer teardown()
+
+	assignees := []string{"aahashderuffy"}
+	issue := func() *github.Issue {
+		issue := &github.Issue{Number: github.Int(1), Body: github.String("Broken links. @bunto/documentation")}
+		for _, login := range assignees {
+			issue.Assignees = append(issue.Assignees, &github.User{Login: github.String(login)})
+		}
+		return issue
+	}
+	mux.HandleFunc("/repos/bunto/jemoji/issues/1", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(issue())
+	})
+	mux.HandleFunc("/repos/bunto/jemoji/issues/1/assignees", func(w http.ResponseWriter, r *http.Request) {
+		changed := &struct{ Assignees []string }{}
+		json.NewDecoder(r.Body).Decode(changed)
+		if r.Method == "POST" {
+			assignees = append(assignees, changed.Assignees...)
+		} else {
+			remaining := []string{}
+			for _, assignee := range assignees {
+				if !containsLogin(changed.Assignees, assignee) {
+					remaining = append(remaining, assignee)
+				}
+			}
+			assignees = remaining
+		}
+		json.NewEncoder(w).Encode(issue())
+	})
+	replies := []string{}
+	mux.HandleFunc("/repos/bunto/jemoji/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		comment := &github.IssueComment{}
+		json.NewDecoder(r.Body).Decode(comment)
+		replies = append(replies, *comment.Body)
+		json.NewEncoder(w).Encode(comment)
+	})
+
+	handler := &Handler{}
+	handler.AddRepo("bunto", "jemoji")
+	handler.teams = []Team{{Mention: "@bunto/documentation", Captains: []*github.User{
+		{Login: github.String("aahashderuffy")},
+		{Login: github.String("subins2000")},
+		{Login: github.String("octocat")},
+	}}}
+	router := &commands.Router{}
+	for _, command := range handler.Commands() {
+		router.Register(command)
+	}
+	comment := func(login, body string) *github.IssueCommentEvent {
+		return &github.IssueCommentEvent{
+			Action:  github.String("created"),
+			Issue:   &github.Issue{Number: github.Int(1), User: &github.User{Login: github.String("octocat")}},
+			Comment: &github.IssueComment{User: &github.User{Login: github.String(login)}, Body: github.String(body)},
+			Repo:    &github.Repository{Owner: &github.User{Login: github.String("bunto")}, Name: github.String("jemoji")},
+		}
+	}
+
+	// The author, a captain too, is never picked.
+	assert.NoError(t, router.IssueCommentHandler(context, comment("aahashderuffy", "@buntobot: reassign")))
+	assert.Equal(t, []string{"subins2000"}, assignees)
+
+	assert.NoError(t, router.IssueCommentHandler(context, comment("subins2000", "@buntobot: unassign me")))
+	assert.Empty(t, assignees)
+
+	assert.NoError(t, router.IssueCommentHandler(context, comment("octocat", "@buntobot: assign @bunto/documentation")))
+	assert.Len(t, assignees, 1)
+	assert.NotEqual(t, "octocat", assignees[0])
+
+	assert.Error(t, router.IssueCommentHandler(context, comment("octocat", "/assign @bunto/windows")))
+	assert.Error(t, router.IssueCommentHandler(context, comment("octocat", "/unassign me")))
+	if assert.Len(t, replies, 2) {
+		assert.Contains(t, replies[0], "`@bunto/windows` isn't one of our affinity teams")
+		assert.Contains(t, replies[1], "you aren't assigned to this.")
+	}
+
+	assert.NoError(t, router.IssueCommentHandler(context, comment("subins2000", "/away")))
+	assert.False(t, IsAvailable("subins2000"))
+	assert.NoError(t, router.IssueCommentHandler(context, comment("subins2000", "/back")))
+	assert.True(t, IsAvailable("subins2000"))
+}
@@ -0,0 +1,103 @@
+package affinity
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/google/go-github/github"
+)
+
+// reminder is left, once, on the issues whose author hasn't named a team
+// since being asked to.
+var reminder = "Which of the affinity teams listed above best fits this? Mention one in a comment and I'll assign one of its captains."
+
+// FollowUp follows up on the open, unassigned issues & pull requests of
+// owner/repo whose author was asked which team fits them more than after
+// ago, and hasn't answered. Captains of the team with the ID fallbackTeamID
+// are assigned if it's set; the author is reminded once otherwise.
+//
+// It is meant to be run periodically, e.g. by cmd/follow-up-affinity-teams.
+func (h *Handler) FollowUp(context *ctx.Context, owner, repo string, after time.Duration, fallbackTeamID int) error {
+	var fallback *Team
+	if fallbackTeamID != 0 {
+		team, err := h.GetTeam(fallbackTeamID)
+		if err != nil {
+			return context.NewError("affinity.FollowUp: fallback team: %v", err)
+		}
+		fallback = &team
+	}
+
+	opt := &github.IssueListByRepoOptions{
+		State:       "open",
+		Assignee:    "none",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		issues, resp, err := context.GitHub.Issues.ListByRepo(owner, repo, opt)
+		if err != nil {
+			return context.NewError("affinity.FollowUp: could not list the issues of %s/%s: %v", owner, repo, err)
+		}
+		for _, issue := range issues {
+			if err := h.followUpIssue(context, owner, repo, issue, after, fallback); err != nil {
+				return err
+			}
+		}
+		if resp.NextPage == 0 {
+			return nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+func (h *Handler) followUpIssue(context *ctx.Context, owner, repo string, issue *github.Issue, after time.Duration, fallback *Team) error {
+	number := *issue.Number
+	comments, err := listComments(context, owner, repo, number)
+	if err != nil {
+		return context.NewError("affinity.FollowUp: could not list the comments of %s/%s#%d: %v", owner, repo, number, err)
+	}
+	asked := findBotComment(context, comments, explanation)
+	if asked == nil || asked.CreatedAt == nil || time.Since(*asked.CreatedAt) < after {
+		return nil
+	}
+
+	author := ""
+	if issue.User != nil && issue.User.Login != nil {
+		author = *issue.User.Login
+	}
+
+	var body string
+	if fallback != nil {
+		captains, err := fallback.SelectCaptains(context, owner, repo, []string{author}, 1)
+		if err != nil {
+			return context.NewError("affinity.FollowUp: problem selecting captains of %s: %v", fallback.Mention, err)
+		}
+		if len(captains) == 0 {
+			context.IncrStat("affinity.error.no_acceptable_captains")
+			context.Log("affinity.FollowUp: no captain of %s to assign to %s/%s#%d", fallback.Mention, owner, repo, number)
+			return nil
+		}
+		if _, _, err := context.GitHub.Issues.AddAssignees(owner, repo, number, captains); err != nil {
+			context.IncrStat("affinity.error.github_api")
+			return context.NewError("affinity.FollowUp: problem assigning %q to %s/%s#%d: %v", captains, owner, repo, number, err)
+		}
+		context.IncrStat("affinity.fallback")
+		body = fmt.Sprintf("No team was mentioned, so I've asked @%s of %s to triage this.", captains[0], fallback.Mention)
+	} else {
+		if findBotComment(context, comments, reminder) != nil {
+			return nil
+		}
+		context.IncrStat("affinity.reminded")
+		body = reminder
+		if author != "" {
+			body = fmt.Sprintf("Hey @%s! %s", author, reminder)
+		}
+	}
+
+	_, _, err = context.GitHub.Issues.CreateComment(owner, repo, number, &github.IssueComment{Body: github.String(body)})
+	if err != nil {
+		return context.NewError("affinity.FollowUp: could not leave comment on %s/%s#%d: %v", owner, repo, number, err)
+	}
+	context.Log("affinity.FollowUp: followed up on %s/%s#%d", owner, repo, number)
+	return nil
+}
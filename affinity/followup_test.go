@@ -0,0 +1,115 @@
+package affinity
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/buntobot/auto-reply/internal/githubtest"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+// serveFollowUpIssue serves bunto/bunto-feed#1, unassigned, on the test
+// server, and records the comments & assignees added to it.
+func serveFollowUpIssue(t *testing.T, mux *http.ServeMux) (*[]*github.IssueComment, *[]string) {
+	mux.HandleFunc("/repos/bunto/bunto-feed/issues", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "none", r.URL.Query().Get("assignee"))
+		fmt.Fprint(w, `[{"number": 1, "user": {"login": "octocat"}}]`)
+	})
+	comments := []*github.IssueComment{}
+	mux.HandleFunc("/repos/bunto/bunto-feed/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			comment := &github.IssueComment{}
+			json.NewDecoder(r.Body).Decode(comment)
+			comment.User = &github.User{Login: github.String("buntobot")}
+			now := time.Now()
+			comment.CreatedAt = &now
+			comments = append(comments, comment)
+			json.NewEncoder(w).Encode(comment)
+			return
+		}
+		json.NewEncoder(w).Encode(comments)
+	})
+	assignees := []string{}
+	mux.HandleFunc("/repos/bunto/bunto-feed/issues/1/assignees", func(w http.ResponseWriter, r *http.Request) {
+		added := &struct{ Assignees []string }{}
+		json.NewDecoder(r.Body).Decode(added)
+		assignees = append(assignees, added.Assignees...)
+		fmt.Fprint(w, `{"number": 1}`)
+	})
+
+	return &comments, &assignees
+}
+
+func newFollowUpHandler() *Handler {
+	handler := &Handler{}
+	handler.AddRepo("bunto", "bunto-feed")
+	handler.teams = []Team{
+		{ID: 456, Mention: "@bunto/documentation", Captains: []*github.User{{Login: github.String("subins2000")}}},
+		{ID: 789, Mention: "@bunto/triage", Captains: []*github.User{{Login: github.String("aahashderuffy")}}},
+	}
+	return handler
+}
+
+func TestAskForAffinityTeamOnce(t *testing.T) {
+	mux, context, teardown := githubtest.Setup()
+	defer teardown()
+	// As the GlobalHandler does, from the payload.
+	context.SetIssue("bunto", "bunto-feed", 1)
+	context.SetAuthor("octocat")
+	comments, _ := serveFollowUpIssue(t, mux)
+
+	handler := newFollowUpHandler()
+	opened := &github.IssuesEvent{
+		Action: github.String("opened"),
+		Issue:  &github.Issue{Number: github.Int(1), User: &github.User{Login: github.String("octocat")}, Body: github.String("It's broken.")},
+		Sender: &github.User{Login: github.String("octocat")},
+		Repo:   &github.Repository{Owner: &github.User{Login: github.String("bunto")}, Name: github.String("bunto-feed")},
+	}
+
+	assert.NoError(t, handler.AssignIssueToAffinityTeamCaptain(context, opened))
+	assert.Error(t, handler.AssignIssueToAffinityTeamCaptain(context, opened))
+	if assert.Len(t, *comments, 1) {
+		assert.Contains(t, *(*comments)[0].Body, "Hey, @octocat!")
+		assert.Contains(t, *(*comments)[0].Body, "`@bunto/triage`")
+	}
+}
+
+func TestFollowUp(t *testing.T) {
+	mux, context, teardown := githubtest.Setup()
+	defer teardown()
+	comments, assignees := serveFollowUpIssue(t, mux)
+	handler := newFollowUpHandler()
+
+	// Not asked yet.
+	assert.NoError(t, handler.FollowUp(context, "bunto", "bunto-feed", time.Hour, 0))
+	assert.Empty(t, *comments)
+
+	askedAt := time.Now().Add(-2 * time.Hour)
+	*comments = append(*comments, &github.IssueComment{
+		User:      &github.User{Login: github.String("buntobot")},
+		Body:      github.String(buildAffinityTeamMessage(context, handler.teams)),
+		CreatedAt: &askedAt,
+	})
+	assert.NoError(t, handler.FollowUp(context, "bunto", "bunto-feed", 3*time.Hour, 0))
+	assert.Len(t, *comments, 1)
+
+	// Reminded once.
+	assert.NoError(t, handler.FollowUp(context, "bunto", "bunto-feed", time.Hour, 0))
+	assert.NoError(t, handler.FollowUp(context, "bunto", "bunto-feed", time.Hour, 0))
+	if assert.Len(t, *comments, 2) {
+		assert.Equal(t, "Hey @octocat! "+reminder, *(*comments)[1].Body)
+	}
+	assert.Empty(t, *assignees)
+
+	assert.NoError(t, handler.FollowUp(context, "bunto", "bunto-feed", time.Hour, 789))
+	assert.Equal(t, []string{"aahashderuffy"}, *assignees)
+	if assert.Len(t, *comments, 3) {
+		assert.Contains(t, *(*comments)[2].Body, "@aahashderuffy of @bunto/triage")
+	}
+
+	assert.Error(t, handler.FollowUp(context, "bunto", "bunto-feed", time.Hour, 101))
+}
@@ -2,14 +2,29 @@ package affinity
 
 import (
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/google/go-github/github"
+	"github.com/buntobot/auto-reply/commands"
 	"github.com/buntobot/auto-reply/ctx"
 )
 
 type Handler struct {
 	repos []Repo
-	teams []Team
+	rules []Rule
+
+	lock        sync.RWMutex // protects teams, teamIDs, strategy & refreshedAt
+	teams       []Team
+	teamIDs     []int
+	strategy    Strategy
+	refreshedAt time.Time
+
+	// refreshLock ensures only one refresh of the teams happens at a time.
+	refreshLock sync.Mutex
+
+	// router runs the comment commands, e.g. assign.
+	router *commands.Router
 }
 
 func (h *Handler) enabledForRepo(owner, name string) bool {
@@ -36,32 +51,59 @@ func (h *Handler) AddRepo(owner, name string) {
 	}
 
 	h.repos = append(h.repos, Repo{Owner: owner, Name: name})
+	registerRepo(h, owner, name)
 }
 
+// GetTeams returns the handler's teams as of now. Refreshes swap in new
+// teams rather than update these.
 func (h *Handler) GetTeams() []Team {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
 	return h.teams
 }
 
+// AddTeam fetches the team and its captains. The team is refreshed along
+// with the others from then on, even if this first fetch fails.
 func (h *Handler) AddTeam(context *ctx.Context, teamID int) error {
-	if h.teams == nil {
-		h.teams = []Team{}
-	}
-
-	if _, err := h.GetTeam(teamID); err == nil {
+	h.lock.Lock()
+	if containsInt(h.teamIDs, teamID) {
+		h.lock.Unlock()
 		return nil // already have it!
 	}
+	h.teamIDs = append(h.teamIDs, teamID)
+	h.lock.Unlock()
 
-	team, err := NewTeam(context, teamID)
-	if err != nil {
-		return err
-	}
+	return h.refreshTeams(context, []int{teamID})
+}
 
-	h.teams = append(h.teams, team)
-	return nil
+// SetRouter sets the router running the comment commands, so comments
+// which run one aren't taken for mentions of a team.
+func (h *Handler) SetRouter(router *commands.Router) {
+	h.router = router
+}
+
+// SetRules sets the rules routing the issues & pull requests which mention
+// no team.
+func (h *Handler) SetRules(rules []Rule) {
+	h.rules = rules
+}
+
+// SetStrategy sets how the captains of the handler's teams are picked.
+func (h *Handler) SetStrategy(strategy Strategy) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.strategy = strategy
+	teams := make([]Team, len(h.teams))
+	for i, team := range h.teams {
+		team.Strategy = strategy
+		teams[i] = team
+	}
+	h.teams = teams
 }
 
 func (h *Handler) GetTeam(teamID int) (Team, error) {
-	for _, team := range h.teams {
+	for _, team := range h.GetTeams() {
 		if team.ID == teamID {
 			return team, nil
 		}
@@ -72,91 +114,109 @@ func (h *Handler) GetTeam(teamID int) (Team, error) {
 func (h *Handler) AssignPRToAffinityTeamCaptain(context *ctx.Context, payload interface{}) error {
 	event, ok := payload.(*github.PullRequestEvent)
 	if !ok {
-		return context.NewError("AssignPRToAffinityTeamCaptain: not a pull request event")
+		return context.NewSkip("AssignPRToAffinityTeamCaptain: not a pull request event")
 	}
 
-	context.SetAuthor(*event.Sender.Login)
 	context.SetIssue(*event.Repo.Owner.Login, *event.Repo.Name, *event.Number)
 
 	if !h.enabledForRepo(context.Issue.Owner, context.Issue.Repo) {
-		return context.NewError("AssignPRToAffinityTeamCaptain: not enabled for %s", context.Issue)
+		return context.NewSkip("AssignPRToAffinityTeamCaptain: not enabled for %s", context.Issue)
 	}
 
 	if *event.Action != "opened" {
-		return context.NewError("AssignPRToAffinityTeamCaptain: not an 'opened' PR event")
+		return context.NewSkip("AssignPRToAffinityTeamCaptain: not an 'opened' PR event")
 	}
 
 	if event.PullRequest.Assignee != nil {
 		context.IncrStat("affinity.error.already_assigned")
-		return context.NewError("AssignPRToAffinityTeamCaptain: PR already assigned")
+		return context.NewSkip("AssignPRToAffinityTeamCaptain: PR already assigned")
 	}
 
 	if context.GitHubAuthedAs(*event.Sender.Login) {
-		return fmt.Errorf("bozo. you can't reply to your own comment!")
+		return context.NewSkip("bozo. you can't reply to your own comment!")
 	}
 
 	context.IncrStat("affinity.pull_request")
+	h.refreshIfStale(context)
 
-	return assignTeamCaptains(context, *h, *event.PullRequest.Body, 2)
+	subject := Subject{Title: stringValue(event.PullRequest.Title), Body: stringValue(event.PullRequest.Body)}
+	return assignTeamCaptains(context, h, subject, 2, true)
 }
 
 func (h *Handler) AssignIssueToAffinityTeamCaptain(context *ctx.Context, payload interface{}) error {
 	event, ok := payload.(*github.IssuesEvent)
 	if !ok {
-		return context.NewError("AssignIssueToAffinityTeamCaptain: not an issue event")
+		return context.NewSkip("AssignIssueToAffinityTeamCaptain: not an issue event")
 	}
 
-	context.SetAuthor(*event.Sender.Login)
 	context.SetIssue(*event.Repo.Owner.Login, *event.Repo.Name, *event.Issue.Number)
 
 	if !h.enabledForRepo(context.Issue.Owner, context.Issue.Repo) {
-		return context.NewError("AssignIssueToAffinityTeamCaptain: not enabled for %s", context.Issue)
+		return context.NewSkip("AssignIssueToAffinityTeamCaptain: not enabled for %s", context.Issue)
 	}
 
 	if *event.Action != "opened" {
-		return context.NewError("AssignIssueToAffinityTeamCaptain: not an 'opened' issue event")
+		return context.NewSkip("AssignIssueToAffinityTeamCaptain: not an 'opened' issue event")
 	}
 
 	if event.Assignee != nil {
 		context.IncrStat("affinity.error.already_assigned")
-		return context.NewError("AssignIssueToAffinityTeamCaptain: issue already assigned")
+		return context.NewSkip("AssignIssueToAffinityTeamCaptain: issue already assigned")
 	}
 
 	if context.GitHubAuthedAs(*event.Sender.Login) {
-		return fmt.Errorf("bozo. you can't reply to your own comment!")
+		return context.NewSkip("bozo. you can't reply to your own comment!")
 	}
 
 	context.IncrStat("affinity.issue")
+	h.refreshIfStale(context)
 
-	return assignTeamCaptains(context, *h, *event.Issue.Body, 1)
+	subject := Subject{
+		Title:  stringValue(event.Issue.Title),
+		Body:   stringValue(event.Issue.Body),
+		Labels: labelNames(event.Issue.Labels),
+		Files:  []string{},
+	}
+	return assignTeamCaptains(context, h, subject, 1, true)
 }
 
 func (h *Handler) AssignIssueToAffinityTeamCaptainFromComment(context *ctx.Context, payload interface{}) error {
 	event, ok := payload.(*github.IssueCommentEvent)
 	if !ok {
-		return context.NewError("AssignIssueToAffinityTeamCaptainFromComment: not an issue comment event")
+		return context.NewSkip("AssignIssueToAffinityTeamCaptainFromComment: not an issue comment event")
 	}
 
-	context.SetAuthor(*event.Sender.Login)
 	context.SetIssue(*event.Repo.Owner.Login, *event.Repo.Name, *event.Issue.Number)
 
 	if !h.enabledForRepo(context.Issue.Owner, context.Issue.Repo) {
-		return context.NewError("AssignIssueToAffinityTeamCaptainFromComment: not enabled for %s", context.Issue)
+		return context.NewSkip("AssignIssueToAffinityTeamCaptainFromComment: not enabled for %s", context.Issue)
 	}
 
 	if *event.Action == "deleted" {
-		return context.NewError("AssignIssueToAffinityTeamCaptainFromComment: deleted issue comment event")
+		return context.NewSkip("AssignIssueToAffinityTeamCaptainFromComment: deleted issue comment event")
 	}
 
 	if event.Issue.Assignee != nil {
-		return context.NewError("AssignIssueToAffinityTeamCaptainFromComment: issue already assigned")
+		return context.NewSkip("AssignIssueToAffinityTeamCaptainFromComment: issue already assigned")
 	}
 
 	if context.GitHubAuthedAs(*event.Sender.Login) {
-		return fmt.Errorf("bozo. you can't reply to your own comment!")
+		return context.NewSkip("bozo. you can't reply to your own comment!")
+	}
+
+	if h.router != nil && h.router.ContainsCommand(context, *event.Repo.Owner.Login, *event.Repo.Name, *event.Comment.Body) {
+		return context.NewSkip("AssignIssueToAffinityTeamCaptainFromComment: comment is a command, e.g. assign")
 	}
 
 	context.IncrStat("affinity.issue_comment")
+	h.refreshIfStale(context)
+
+	return assignTeamCaptains(context, h, Subject{Body: *event.Comment.Body}, 1, false)
+}
 
-	return assignTeamCaptains(context, *h, *event.Comment.Body, 1)
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
 }
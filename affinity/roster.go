@@ -0,0 +1,179 @@
+package affinity
+
+import (
+	"time"
+
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/buntobot/auto-reply/hooks"
+	"github.com/google/go-github/github"
+)
+
+// RefreshInterval is how long the teams & their captains are trusted before
+// they're fetched again, upon the next event which needs them.
+var RefreshInterval = time.Hour
+
+// Refresh fetches the metadata & captains of all of the handler's teams
+// again and swaps them in. A team which can't be fetched is kept as it was.
+func (h *Handler) Refresh(context *ctx.Context) error {
+	h.lock.RLock()
+	teamIDs := append([]int{}, h.teamIDs...)
+	h.lock.RUnlock()
+
+	return h.refreshTeams(context, teamIDs)
+}
+
+// MembershipHandler refreshes an affinity team once a member is added to
+// or removed from it, so new captains are assigned right away and former
+// ones are not.
+func (h *Handler) MembershipHandler(context *ctx.Context, payload interface{}) error {
+	event, ok := payload.(*github.MembershipEvent)
+	if !ok {
+		return context.NewSkip("affinity.MembershipHandler: not a membership event")
+	}
+	if event.Team == nil || event.Team.ID == nil {
+		return context.NewError("affinity.MembershipHandler: membership event without a team")
+	}
+	return h.refreshTeam(context, "affinity.MembershipHandler", *event.Team.ID)
+}
+
+// TeamHandler refreshes an affinity team once it's edited, e.g. renamed,
+// or added to or removed from a repository, and drops it once it's deleted.
+func (h *Handler) TeamHandler(context *ctx.Context, payload interface{}) error {
+	event, ok := payload.(*hooks.TeamEventPayload)
+	if !ok {
+		return context.NewSkip("affinity.TeamHandler: not a team event")
+	}
+	if event.Action == nil || event.Team == nil || event.Team.ID == nil {
+		return context.NewError("affinity.TeamHandler: team event without an action or a team")
+	}
+	if *event.Action == "deleted" {
+		return h.dropTeam(context, *event.Team.ID)
+	}
+	return h.refreshTeam(context, "affinity.TeamHandler", *event.Team.ID)
+}
+
+// refreshTeam refreshes the team, if it's one of the handler's, on behalf of
+// the named event handler.
+func (h *Handler) refreshTeam(context *ctx.Context, handlerName string, teamID int) error {
+	h.lock.RLock()
+	tracked := containsInt(h.teamIDs, teamID)
+	h.lock.RUnlock()
+	if !tracked {
+		return context.NewSkip("%s: team %d isn't an affinity team", handlerName, teamID)
+	}
+
+	if err := h.refreshTeams(context, []int{teamID}); err != nil {
+		context.IncrStat("affinity.error.github_api")
+		return context.NewError("%s: %v", handlerName, err)
+	}
+	context.IncrStat("affinity.refreshed")
+	return nil
+}
+
+// dropTeam forgets the team, if it's one of the handler's, so no more
+// issues are routed to it.
+func (h *Handler) dropTeam(context *ctx.Context, teamID int) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if !containsInt(h.teamIDs, teamID) {
+		return context.NewSkip("affinity.TeamHandler: team %d isn't an affinity team", teamID)
+	}
+
+	teamIDs := []int{}
+	for _, id := range h.teamIDs {
+		if id != teamID {
+			teamIDs = append(teamIDs, id)
+		}
+	}
+	teams := []Team{}
+	for _, team := range h.teams {
+		if team.ID != teamID {
+			teams = append(teams, team)
+		}
+	}
+	h.teamIDs, h.teams = teamIDs, teams
+	context.Log("affinity: dropped deleted team %d", teamID)
+	return nil
+}
+
+// refreshIfStale refreshes the teams if they're older than RefreshInterval.
+// Only the first of the events which find them stale waits for the
+// refresh; the others go on with the teams they have.
+func (h *Handler) refreshIfStale(context *ctx.Context) {
+	h.lock.Lock()
+	stale := len(h.teamIDs) > 0 && time.Since(h.refreshedAt) >= RefreshInterval
+	if stale {
+		h.refreshedAt = time.Now()
+	}
+	h.lock.Unlock()
+	if !stale {
+		return
+	}
+
+	if err := h.Refresh(context); err != nil {
+		context.IncrStat("affinity.error.github_api")
+		context.Log("affinity: couldn't refresh the teams: %v", err)
+		return
+	}
+	context.IncrStat("affinity.refreshed")
+}
+
+// refreshTeams fetches the given teams and swaps in a new slice of teams,
+// so the slices handed out by GetTeams are never modified.
+func (h *Handler) refreshTeams(context *ctx.Context, teamIDs []int) error {
+	h.refreshLock.Lock()
+	defer h.refreshLock.Unlock()
+
+	fetched := map[int]Team{}
+	var lastErr error
+	for _, teamID := range teamIDs {
+		team, err := NewTeam(context, teamID)
+		if err != nil {
+			lastErr = ctx.Errorf("couldn't fetch team %d: %v", teamID, err)
+			continue
+		}
+		fetched[teamID] = team
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	teams := []Team{}
+	all := true
+	for _, teamID := range h.teamIDs {
+		team, ok := fetched[teamID]
+		if !ok {
+			all = false
+			if team, ok = findTeam(h.teams, teamID); !ok {
+				continue
+			}
+		}
+		team.Strategy = h.strategy
+		teams = append(teams, team)
+	}
+	h.teams = teams
+	// Refreshing some of the teams, e.g. upon a membership event, leaves
+	// the others as stale as they were.
+	if all {
+		h.refreshedAt = time.Now()
+	}
+	context.Log("affinity: refreshed teams %v", teamIDs)
+	return lastErr
+}
+
+func findTeam(teams []Team, teamID int) (Team, bool) {
+	for _, team := range teams {
+		if team.ID == teamID {
+			return team, true
+		}
+	}
+	return Team{}, false
+}
+
+func containsInt(haystack []int, needle int) bool {
+	for _, i := range haystack {
+		if i == needle {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package affinity
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/buntobot/auto-reply/hooks"
+	"github.com/buntobot/auto-reply/internal/githubtest"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshTeams(t *testing.T) {
+	mux, context, teardown := githubtest.Setup()
+	defer teardown()
+
+	fetches, broken := 0, false
+	mux.HandleFunc("/teams/77", func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		if broken {
+			http.Error(w, "oops", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, `{"id": 77, "name": "Documentation", "slug": "documentation", "description": "Docs & site", "organization": {"login": "bunto-roster"}}`)
+	})
+	// The maintainers span two pages.
+	maintainers := []string{`[{"login": "subins2000"}]`, `[{"login": "aahashderuffy"}]`}
+	mux.HandleFunc("/teams/77/members", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("role") == "all" {
+			fmt.Fprint(w, `[{"login": "subins2000"}, {"login": "aahashderuffy"}, {"login": "DirtyF"}, {"login": "octocat"}]`)
+			return
+		}
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, maintainers[1])
+			return
+		}
+		w.Header().Set("Link", fmt.Sprintf(`<%s/teams/77/members?role=maintainer&page=2>; rel="next"`, context.GitHub.BaseURL))
+		fmt.Fprint(w, maintainers[0])
+	})
+	mux.HandleFunc("/orgs/bunto-roster/members", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"login": "DirtyF"}]`)
+	})
+
+	handler := &Handler{}
+	if !assert.NoError(t, handler.AddTeam(context, 77)) {
+		return
+	}
+	before := handler.GetTeams()
+	assert.Len(t, before, 1)
+	assert.Equal(t, "@bunto-roster/documentation", before[0].Mention)
+	assert.Equal(t, []string{"subins2000", "aahashderuffy", "DirtyF"}, usersByLogin(before[0].Captains))
+
+	// A new maintainer is picked up upon the membership event, and the teams
+	// handed out before are left as they were.
+	maintainers[1] = `[{"login": "aahashderuffy"}, {"login": "octocat"}]`
+	event := &github.MembershipEvent{
+		Action: github.String("added"),
+		Member: &github.User{Login: github.String("octocat")},
+		Team:   &github.Team{ID: github.Int(77)},
+	}
+	assert.NoError(t, handler.MembershipHandler(context, event))
+	assert.Equal(t, []string{"subins2000", "aahashderuffy", "octocat", "DirtyF"}, usersByLogin(handler.GetTeams()[0].Captains))
+	assert.Equal(t, []string{"subins2000", "aahashderuffy", "DirtyF"}, usersByLogin(before[0].Captains))
+
+	event.Team.ID = github.Int(78)
+	assert.Error(t, handler.MembershipHandler(context, event))
+
+	// Stale teams are refreshed once.
+	fetches = 0
+	handler.refreshedAt = time.Now().Add(-RefreshInterval)
+	handler.refreshIfStale(context)
+	handler.refreshIfStale(context)
+	assert.Equal(t, 1, fetches)
+
+	// So is a team once it's edited.
+	fetches = 0
+	edited := &hooks.TeamEventPayload{Action: github.String("edited"), Team: &github.Team{ID: github.Int(77)}}
+	assert.NoError(t, handler.TeamHandler(context, edited))
+	assert.Equal(t, 1, fetches)
+
+	// A team which can't be fetched is kept.
+	broken = true
+	assert.Error(t, handler.Refresh(context))
+	assert.Len(t, handler.GetTeams(), 1)
+	assert.Equal(t, "@bunto-roster/documentation", handler.GetTeams()[0].Mention)
+
+	// A deleted team is dropped.
+	deleted := &hooks.TeamEventPayload{Action: github.String("deleted"), Team: &github.Team{ID: github.Int(77)}}
+	assert.NoError(t, handler.TeamHandler(context, deleted))
+	assert.Empty(t, handler.GetTeams())
+	assert.True(t, ctx.IsSkip(handler.TeamHandler(context, deleted)))
+}
+
+func TestRefreshingOneTeamLeavesTheOthersStale(t *testing.T) {
+	mux, context, teardown := githubtest.Setup()
+	defer teardown()
+
+	fetched := map[string]int{}
+	for _, id := range []string{"77", "78"} {
+		id := id
+		mux.HandleFunc("/teams/"+id, func(w http.ResponseWriter, r *http.Request) {
+			fetched[id]++
+			fmt.Fprintf(w, `{"id": %s, "name": "Team", "slug": "team-%s", "description": "", "organization": {"login": "bunto-roster"}}`, id, id)
+		})
+		mux.HandleFunc("/teams/"+id+"/members", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `[{"login": "subins2000"}]`)
+		})
+	}
+	mux.HandleFunc("/orgs/bunto-roster/members", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+
+	handler := &Handler{}
+	assert.NoError(t, handler.AddTeam(context, 77))
+	assert.NoError(t, handler.AddTeam(context, 78))
+
+	handler.refreshedAt = time.Now().Add(-RefreshInterval)
+	event := &github.MembershipEvent{Action: github.String("added"), Team: &github.Team{ID: github.Int(77)}}
+	assert.NoError(t, handler.MembershipHandler(context, event))
+	assert.Equal(t, map[string]int{"77": 2, "78": 1}, fetched)
+
+	handler.refreshIfStale(context)
+	assert.Equal(t, map[string]int{"77": 3, "78": 2}, fetched)
+}
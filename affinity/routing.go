@@ -0,0 +1,168 @@
+package affinity
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/buntobot/auto-reply/common"
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/google/go-github/github"
+)
+
+// Rule routes the issues & pull requests which mention no team to the team
+// with the ID Team. It matches if any of its paths, labels or keywords do.
+// Of the rules which match, the one with the highest priority wins.
+type Rule struct {
+	Team     int `yaml:"team"`
+	Priority int `yaml:"priority"`
+	// Paths are globs of the files changed by a pull request, e.g.
+	// "docs/**" or "**/*.md". "*" doesn't match "/" but "**" does.
+	Paths []string `yaml:"paths"`
+	// Labels are the names of labels, any of which matches.
+	Labels []string `yaml:"labels"`
+	// Keywords are whole words of the title or body, matched regardless
+	// of case.
+	Keywords []string `yaml:"keywords"`
+}
+
+// Subject is what rules are matched against: an issue or pull request.
+type Subject struct {
+	Title  string
+	Body   string
+	Labels []string
+	// Files are the paths changed by a pull request.
+	Files []string
+}
+
+// Validate returns an error if the rule has no team, nothing to match or an
+// invalid glob.
+func (r Rule) Validate() error {
+	if r.Team == 0 {
+		return fmt.Errorf("affinity: routing rule without a team")
+	}
+	if len(r.Paths) == 0 && len(r.Labels) == 0 && len(r.Keywords) == 0 {
+		return fmt.Errorf("affinity: routing rule for team %d matches nothing", r.Team)
+	}
+	for _, glob := range r.Paths {
+		if _, err := globRegexp(glob); err != nil {
+			return fmt.Errorf("affinity: routing rule for team %d: %v", r.Team, err)
+		}
+	}
+	return nil
+}
+
+// Matches returns true if any of the rule's paths, labels or keywords match
+// the subject.
+func (r Rule) Matches(subject Subject) bool {
+	for _, glob := range r.Paths {
+		matcher, err := globRegexp(glob)
+		if err != nil {
+			continue
+		}
+		for _, file := range subject.Files {
+			if matcher.MatchString(file) {
+				return true
+			}
+		}
+	}
+	for _, label := range r.Labels {
+		for _, subjectLabel := range subject.Labels {
+			if strings.EqualFold(label, subjectLabel) {
+				return true
+			}
+		}
+	}
+	for _, keyword := range r.Keywords {
+		matcher := regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(keyword) + `\b`)
+		if matcher.MatchString(subject.Title) || matcher.MatchString(subject.Body) {
+			return true
+		}
+	}
+	return false
+}
+
+// Route returns the team the subject mentions or, failing that, the team of
+// the highest-priority rule it matches. Earlier rules win ties.
+func Route(teams []Team, rules []Rule, subject Subject) (Team, error) {
+	if team, err := findAffinityTeam(subject.Body, teams); err == nil {
+		return team, nil
+	}
+
+	sorted := append([]Rule{}, rules...)
+	sort.Stable(byPriority(sorted))
+	for _, rule := range sorted {
+		if !rule.Matches(subject) {
+			continue
+		}
+		for _, team := range teams {
+			if team.ID == rule.Team {
+				return team, nil
+			}
+		}
+	}
+	return Team{}, fmt.Errorf("affinity.Route: no matching team")
+}
+
+// byPriority sorts rules, highest priority first.
+type byPriority []Rule
+
+func (r byPriority) Len() int           { return len(r) }
+func (r byPriority) Less(i, j int) bool { return r[i].Priority > r[j].Priority }
+func (r byPriority) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+// globRegexp compiles the glob, where "**" matches any number of
+// directories.
+func globRegexp(glob string) (*regexp.Regexp, error) {
+	if glob == "" {
+		return nil, fmt.Errorf("empty glob")
+	}
+	return regexp.Compile("^" + common.GlobExpr(glob) + "$")
+}
+
+// needs returns whether the handler's rules match on changed files & labels,
+// which the webhook payloads of pull requests don't carry.
+func (h *Handler) needs() (files, labels bool) {
+	for _, rule := range h.rules {
+		files = files || len(rule.Paths) > 0
+		labels = labels || len(rule.Labels) > 0
+	}
+	return files, labels
+}
+
+// completeSubject fetches the files & labels of the pull request number of
+// owner/repo, if the rules need them.
+func (h *Handler) completeSubject(context *ctx.Context, owner, repo string, number int, subject *Subject) error {
+	needsFiles, needsLabels := h.needs()
+	if needsFiles && subject.Files == nil {
+		files, err := common.ChangedFiles(context, owner, repo, number)
+		if err != nil {
+			return err
+		}
+		subject.Files = files
+	}
+	if needsLabels && subject.Labels == nil {
+		labels, _, err := context.GitHub.Issues.ListLabelsByIssue(owner, repo, number, &github.ListOptions{PerPage: 100})
+		if err != nil {
+			return ctx.Errorf("couldn't list the labels of %s/%s#%d: %v", owner, repo, number, err)
+		}
+		subject.Labels = []string{}
+		for _, label := range labels {
+			if label.Name != nil {
+				subject.Labels = append(subject.Labels, *label.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func labelNames(labels []github.Label) []string {
+	names := []string{}
+	for _, label := range labels {
+		if label.Name != nil {
+			names = append(names, *label.Name)
+		}
+	}
+	return names
+}
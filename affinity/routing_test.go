@@ -0,0 +1,95 @@
+package affinity
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/buntobot/auto-reply/internal/githubtest"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	routingTeams = []Team{
+		{ID: 456, Mention: "@bunto/documentation", Captains: []*github.User{{Login: github.String("subins2000")}}},
+		{ID: 141, Mention: "@bunto/windows", Captains: []*github.User{{Login: github.String("SuriyaaKudoIsc")}}},
+		{ID: 123, Mention: "@bunto/build", Captains: []*github.User{{Login: github.String("aahashderuffy")}}},
+	}
+	routingRules = []Rule{
+		{Team: 123, Priority: 1, Paths: []string{"lib/**/*.rb"}},
+		{Team: 456, Priority: 10, Paths: []string{"docs/", "**/*.md"}, Labels: []string{"documentation"}},
+		{Team: 141, Priority: 5, Labels: []string{"windows"}, Keywords: []string{"windows", "wsl"}},
+	}
+)
+
+func TestRoute(t *testing.T) {
+	examples := []struct {
+		subject Subject
+		teamID  int
+	}{
+		// An explicit mention wins.
+		{Subject{Body: "cc @bunto/build", Files: []string{"docs/index.md"}}, 123},
+		// So does the higher priority.
+		{Subject{Files: []string{"lib/bunto/site.rb", "docs/_docs/windows.md"}}, 456},
+		{Subject{Files: []string{"lib/bunto/site.rb"}, Labels: []string{"Windows"}}, 141},
+		{Subject{Title: "Build fails on WSL", Files: []string{}}, 141},
+		{Subject{Files: []string{"lib/bunto.rb"}}, 123},
+	}
+	for _, example := range examples {
+		team, err := Route(routingTeams, routingRules, example.subject)
+		assert.NoError(t, err)
+		assert.Equal(t, example.teamID, team.ID, "%+v", example.subject)
+	}
+
+	// "windowsill" isn't "windows".
+	_, err := Route(routingTeams, routingRules, Subject{Body: "Fix the windowsill example"})
+	assert.Error(t, err)
+}
+
+func TestRuleValidate(t *testing.T) {
+	for _, rule := range routingRules {
+		assert.NoError(t, rule.Validate())
+	}
+	assert.Error(t, Rule{Labels: []string{"bug"}}.Validate())
+	assert.Error(t, Rule{Team: 1}.Validate())
+	assert.Error(t, Rule{Team: 1, Paths: []string{""}}.Validate())
+}
+
+// TestRouteRecordedPullRequest routes a recorded pull_request delivery,
+// whose changed files are served as GitHub would.
+func TestRouteRecordedPullRequest(t *testing.T) {
+	payload, err := ioutil.ReadFile("testdata/pull_request_docs.json")
+	if !assert.NoError(t, err) {
+		return
+	}
+	event := &github.PullRequestEvent{}
+	if !assert.NoError(t, json.Unmarshal(payload, event)) {
+		return
+	}
+
+	mux, context, teardown := githubtest.Setup()
+	defer teardown()
+
+	mux.HandleFunc("/repos/bunto/bunto-admin/pulls/42/files", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"filename": "docs/_docs/quickstart.md"}, {"filename": "lib/bunto/commands/new.rb"}]`)
+	})
+	mux.HandleFunc("/repos/bunto/bunto-admin/issues/42/labels", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+	var assignees []string
+	mux.HandleFunc("/repos/bunto/bunto-admin/issues/42/assignees", func(w http.ResponseWriter, r *http.Request) {
+		added := &struct{ Assignees []string }{}
+		json.NewDecoder(r.Body).Decode(added)
+		assignees = append(assignees, added.Assignees...)
+		fmt.Fprint(w, `{"number": 42}`)
+	})
+
+	handler := &Handler{teams: routingTeams}
+	handler.AddRepo("bunto", "bunto-admin")
+	handler.SetRules(routingRules)
+	assert.NoError(t, handler.AssignPRToAffinityTeamCaptain(context, event))
+	assert.Equal(t, []string{"subins2000"}, assignees)
+}
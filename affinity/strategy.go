@@ -0,0 +1,221 @@
+package affinity
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/google/go-github/github"
+)
+
+// Strategy picks which captains of a team to assign to an issue or pull
+// request of owner/repo.
+type Strategy interface {
+	// Select returns count of the candidates, logins of captains of the team
+	// in its order. There are always more candidates than count.
+	Select(context *ctx.Context, team Team, owner, repo string, candidates []string, count int) ([]string, error)
+}
+
+// ParseStrategy returns the strategy with the given name: "random" (the
+// default), "round_robin" or "least_loaded".
+func ParseStrategy(name string) (Strategy, error) {
+	switch name {
+	case "", "random":
+		return RandomStrategy{}, nil
+	case "round_robin":
+		return &RoundRobinStrategy{}, nil
+	case "least_loaded":
+		return LeastLoadedStrategy{}, nil
+	}
+	return nil, fmt.Errorf("affinity: unknown strategy %q, expected random, round_robin or least_loaded", name)
+}
+
+var (
+	randomLock sync.Mutex // protects random
+	random     = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+func shuffle(logins []string) []string {
+	shuffled := append([]string{}, logins...)
+	randomLock.Lock()
+	defer randomLock.Unlock()
+	for i := len(shuffled) - 1; i > 0; i-- {
+		j := random.Intn(i + 1)
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	}
+	return shuffled
+}
+
+// RandomStrategy picks captains uniformly at random.
+type RandomStrategy struct{}
+
+func (RandomStrategy) Select(context *ctx.Context, team Team, owner, repo string, candidates []string, count int) ([]string, error) {
+	return shuffle(candidates)[:count], nil
+}
+
+// RoundRobinStrategy takes the captains of each team in turn.
+type RoundRobinStrategy struct {
+	sync.Mutex // protects last
+	// last maps team IDs to the captain picked last.
+	last map[int]string
+}
+
+func (s *RoundRobinStrategy) Select(context *ctx.Context, team Team, owner, repo string, candidates []string, count int) ([]string, error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.last == nil {
+		s.last = map[int]string{}
+	}
+
+	order := usersByLogin(team.Captains)
+	start := 0
+	for i, login := range order {
+		if login == s.last[team.ID] {
+			start = i + 1
+		}
+	}
+
+	selections := []string{}
+	for i := 0; i < len(order) && len(selections) < count; i++ {
+		login := order[(start+i)%len(order)]
+		if containsLogin(candidates, login) {
+			selections = append(selections, login)
+		}
+	}
+	if len(selections) > 0 {
+		s.last[team.ID] = selections[len(selections)-1]
+	}
+	return selections, nil
+}
+
+// LeastLoadedStrategy picks the captains with the fewest open issues & pull
+// requests assigned to them in the repo. Ties are broken at random.
+type LeastLoadedStrategy struct{}
+
+func (LeastLoadedStrategy) Select(context *ctx.Context, team Team, owner, repo string, candidates []string, count int) ([]string, error) {
+	loads := map[string]int{}
+	for _, login := range candidates {
+		load, err := openAssignments(context, owner, repo, login)
+		if err != nil {
+			return nil, err
+		}
+		loads[login] = load
+	}
+
+	selections := shuffle(candidates)
+	sort.Stable(byLoad{selections, loads})
+	context.Log("affinity: open assignments in %s/%s: %v", owner, repo, loads)
+	return selections[:count], nil
+}
+
+// byLoad sorts logins by their number of open assignments.
+type byLoad struct {
+	logins []string
+	loads  map[string]int
+}
+
+func (l byLoad) Len() int           { return len(l.logins) }
+func (l byLoad) Less(i, j int) bool { return l.loads[l.logins[i]] < l.loads[l.logins[j]] }
+func (l byLoad) Swap(i, j int)      { l.logins[i], l.logins[j] = l.logins[j], l.logins[i] }
+
+// openAssignments returns the number of open issues & pull requests of
+// owner/repo assigned to login.
+func openAssignments(context *ctx.Context, owner, repo, login string) (int, error) {
+	count := 0
+	opt := &github.IssueListByRepoOptions{
+		State:       "open",
+		Assignee:    login,
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		issues, resp, err := context.GitHub.Issues.ListByRepo(owner, repo, opt)
+		if err != nil {
+			return 0, ctx.Errorf("affinity: couldn't list the issues of %s/%s assigned to %s: %v", owner, repo, login, err)
+		}
+		count += len(issues)
+		if resp.NextPage == 0 {
+			return count, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// unavailableCaptains are the logins, lowercased, of the captains who asked
+// not to be assigned anything for now.
+var unavailableCaptains = struct {
+	sync.Mutex // protects the fields below
+	logins     map[string]bool
+	// path, if set, is the file the logins are kept in.
+	path string
+}{logins: map[string]bool{}}
+
+// PersistAvailability keeps the logins of the unavailable captains in the
+// JSON file at path, so a restart doesn't forget them, and reads those the
+// file already lists.
+func PersistAvailability(path string) error {
+	unavailableCaptains.Lock()
+	defer unavailableCaptains.Unlock()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		logins := []string{}
+		if err := json.Unmarshal(data, &logins); err != nil {
+			return fmt.Errorf("affinity: couldn't read %s: %v", path, err)
+		}
+		for _, login := range logins {
+			unavailableCaptains.logins[strings.ToLower(login)] = true
+		}
+	}
+	unavailableCaptains.path = path
+	return nil
+}
+
+// SetAvailable marks the captain as available for new assignments, or not.
+// Unavailable captains are skipped by every strategy until they're back.
+// It returns an error if that couldn't be persisted, in which case it's
+// only kept in memory.
+func SetAvailable(login string, available bool) error {
+	unavailableCaptains.Lock()
+	defer unavailableCaptains.Unlock()
+	if available {
+		delete(unavailableCaptains.logins, strings.ToLower(login))
+	} else {
+		unavailableCaptains.logins[strings.ToLower(login)] = true
+	}
+
+	if unavailableCaptains.path == "" {
+		return nil
+	}
+	logins := []string{}
+	for login := range unavailableCaptains.logins {
+		logins = append(logins, login)
+	}
+	sort.Strings(logins)
+	data, err := json.Marshal(logins)
+	if err != nil {
+		return err
+	}
+	// Replace the file at once, so it's never left half-written.
+	tmp := unavailableCaptains.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, unavailableCaptains.path)
+}
+
+// IsAvailable returns false if the captain asked not to be assigned anything.
+func IsAvailable(login string) bool {
+	unavailableCaptains.Lock()
+	defer unavailableCaptains.Unlock()
+	return !unavailableCaptains.logins[strings.ToLower(login)]
+}
@@ -0,0 +1,113 @@
+package affinity
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/buntobot/auto-reply/internal/githubtest"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func newStrategyTeam(strategy Strategy) Team {
+	return Team{ID: 456, Strategy: strategy, Captains: []*github.User{
+		{Login: github.String("SuriyaaKudoIsc")},
+		{Login: github.String("aahashderuffy")},
+		{Login: github.String("subins2000")},
+	}}
+}
+
+func TestParseStrategy(t *testing.T) {
+	for name, expected := range map[string]Strategy{
+		"":             RandomStrategy{},
+		"random":       RandomStrategy{},
+		"round_robin":  &RoundRobinStrategy{},
+		"least_loaded": LeastLoadedStrategy{},
+	} {
+		strategy, err := ParseStrategy(name)
+		assert.NoError(t, err)
+		assert.IsType(t, expected, strategy, name)
+	}
+	_, err := ParseStrategy("roundrobin")
+	assert.Error(t, err)
+}
+
+func TestSelectCaptainsExcludesAndSkipsUnavailable(t *testing.T) {
+	team := newStrategyTeam(nil)
+
+	selections, err := team.SelectCaptains(nil, "bunto", "bunto", []string{"suriyaakudoisc", "subins2000"}, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"aahashderuffy"}, selections)
+
+	assert.NoError(t, SetAvailable("aahashderuffy", false))
+	defer SetAvailable("aahashderuffy", true)
+	assert.False(t, IsAvailable("AahashDeruffy"))
+	selections, err = team.SelectCaptains(nil, "bunto", "bunto", []string{"SuriyaaKudoIsc"}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"subins2000"}, selections)
+}
+
+func TestPersistAvailability(t *testing.T) {
+	dir, err := ioutil.TempDir("", "affinity-away")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "away.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`["DirtyF"]`), 0644))
+	defer func() {
+		unavailableCaptains.path = ""
+		SetAvailable("dirtyf", true)
+		SetAvailable("mattr-", true)
+	}()
+
+	assert.NoError(t, PersistAvailability(path))
+	assert.False(t, IsAvailable("dirtyf"))
+
+	assert.NoError(t, SetAvailable("mattr-", false))
+	assert.NoError(t, SetAvailable("DirtyF", true))
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `["mattr-"]`, string(data))
+}
+
+func TestRoundRobinStrategy(t *testing.T) {
+	team := newStrategyTeam(&RoundRobinStrategy{})
+
+	picked := []string{}
+	for i := 0; i < 4; i++ {
+		selections, err := team.SelectCaptains(nil, "bunto", "bunto", nil, 1)
+		assert.NoError(t, err)
+		picked = append(picked, selections...)
+	}
+	assert.Equal(t, []string{"SuriyaaKudoIsc", "aahashderuffy", "subins2000", "SuriyaaKudoIsc"}, picked)
+
+	// The excluded captain's turn goes to the next one.
+	selections, err := team.SelectCaptains(nil, "bunto", "bunto", []string{"aahashderuffy"}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"subins2000"}, selections)
+}
+
+func TestLeastLoadedStrategy(t *testing.T) {
+	mux, context, teardown := githubtest.Setup()
+	defer teardown()
+
+	loads := map[string]string{
+		"SuriyaaKudoIsc": `[{"number": 1}, {"number": 2}]`,
+		"aahashderuffy":  `[]`,
+		"subins2000":     `[{"number": 3}]`,
+	}
+	mux.HandleFunc("/repos/bunto/bunto/issues", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "open", r.URL.Query().Get("state"))
+		fmt.Fprint(w, loads[r.URL.Query().Get("assignee")])
+	})
+
+	team := newStrategyTeam(LeastLoadedStrategy{})
+	selections, err := team.SelectCaptains(context, "bunto", "bunto", nil, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"aahashderuffy", "subins2000"}, selections)
+}
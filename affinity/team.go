@@ -2,8 +2,6 @@ package affinity
 
 import (
 	"fmt"
-	"math/rand"
-	"time"
 
 	"github.com/google/go-github/github"
 	"github.com/buntobot/auto-reply/auth"
@@ -40,6 +38,9 @@ type Team struct {
 
 	// Team captains, requires at least the Login field
 	Captains []*github.User
+
+	// Strategy picks the captains to assign; RandomStrategy if nil.
+	Strategy Strategy
 }
 
 func (t Team) String() string {
@@ -53,77 +54,29 @@ func (t Team) String() string {
 	)
 }
 
-func (t Team) RandomCaptainLogins(num int) []string {
-	rand.Seed(time.Now().UnixNano())
-
-	selections := []string{}
-
-	// Just return all of them.
-	if len(t.Captains) <= num {
-		for _, captain := range t.Captains {
-			selections = append(selections, *captain.Login)
-		}
-		return selections
-	}
-
-	// Find a random selection.
-OuterLoop:
-	for {
-		selection := t.Captains[rand.Intn(len(t.Captains))]
-		for _, previous := range selections {
-			if *selection.Login == previous {
-				continue OuterLoop
-			}
-		}
-		selections = append(selections, *selection.Login)
-
-		if len(selections) == num {
-			break
+// SelectCaptains returns up to count captains to assign to an issue or pull
+// request of owner/repo, as picked by the team's strategy. Excluded logins,
+// e.g. the author's, and unavailable captains are never picked.
+func (t Team) SelectCaptains(context *ctx.Context, owner, repo string, excludedLogins []string, count int) ([]string, error) {
+	candidates := []string{}
+	for _, login := range usersByLogin(t.Captains) {
+		if !containsLogin(excludedLogins, login) && IsAvailable(login) {
+			candidates = append(candidates, login)
 		}
 	}
-	return selections
-}
-
-func (t Team) RandomCaptainLoginsExcluding(excludedLogin string, count int) []string {
-	var selections []string
-	validSelection := true
-
-	// Try 10 times to get a set of captains which doesn't include the
-	// excluded one.
-	for i := 0; i < 10; i++ {
-		selections = t.RandomCaptainLogins(count)
-
-		// Have we included the login of the excluded captain?
-		validSelection = true
-		for _, selection := range selections {
-			if excludedLogin == selection {
-				validSelection = false
-			}
-		}
-
-		// If everything is OK, then return.
-		if validSelection {
-			break
-		}
+	if len(candidates) <= count {
+		return candidates, nil
 	}
 
-	if !validSelection {
-		var limitedSelection []string
-		for _, selection := range selections {
-			if selection != excludedLogin {
-				limitedSelection = append(limitedSelection, selection)
-			}
-		}
-		return limitedSelection
+	strategy := t.Strategy
+	if strategy == nil {
+		strategy = RandomStrategy{}
 	}
-	return selections
+	return strategy.Select(context, t, owner, repo, candidates, count)
 }
 
 func (t *Team) FetchCaptains(context *ctx.Context) error {
-	users, _, err := context.GitHub.Organizations.ListTeamMembers(t.ID, &github.OrganizationListTeamMembersOptions{
-		Role:        "maintainer",
-		ListOptions: github.ListOptions{Page: 0, PerPage: 100},
-	})
+	users, err := listTeamMembers(context, t.ID, "maintainer")
 	if err != nil {
 		return err
 	}
@@ -131,10 +84,7 @@ func (t *Team) FetchCaptains(context *ctx.Context) error {
 	t.Captains = users
 
 	if t.Org != "" {
-		allMembers, _, err := context.GitHub.Organizations.ListTeamMembers(t.ID, &github.OrganizationListTeamMembersOptions{
-			Role:        "all",
-			ListOptions: github.ListOptions{Page: 0, PerPage: 100},
-		})
+		allMembers, err := listTeamMembers(context, t.ID, "all")
 		if err != nil {
 			return err
 		}
@@ -151,6 +101,27 @@ func (t *Team) FetchCaptains(context *ctx.Context) error {
 	return nil
 }
 
+// listTeamMembers lists the members of the team with the given role, over
+// as many pages as there are.
+func listTeamMembers(context *ctx.Context, teamID int, role string) ([]*github.User, error) {
+	members := []*github.User{}
+	opt := &github.OrganizationListTeamMembersOptions{
+		Role:        role,
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		users, resp, err := context.GitHub.Organizations.ListTeamMembers(teamID, opt)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, users...)
+		if resp.NextPage == 0 {
+			return members, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
 func (t *Team) IsCaptain(login string) bool {
 	for _, captain := range t.Captains {
 		if *captain.Login == login {
@@ -3,57 +3,18 @@ package affinity
 import (
 	"testing"
 
+	"github.com/buntobot/auto-reply/auth"
 	"github.com/google/go-github/github"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestTeamRandomCaptainLogins(t *testing.T) {
-	team := Team{Captains: []*github.User{
-		{Login: github.String("SuriyaaKudoIsc")},
-		{Login: github.String("aahashderuffy")},
-		{Login: github.String("subins2000")},
-	}}
-	selections := team.RandomCaptainLogins(1)
-	assert.Len(t, selections, 1)
-	assert.Contains(t, []string{"SuriyaaKudoIsc", "aahashderuffy", "subins2000"}, selections[0])
+func TestCaptainRole(t *testing.T) {
+	handler := &Handler{}
+	handler.AddRepo("bunto", "minima")
+	handler.teams = []Team{{Captains: []*github.User{{Login: github.String("subins2000")}}}}
 
-	selections = team.RandomCaptainLogins(2)
-	assert.Len(t, selections, 2)
-	assert.Contains(t, []string{"SuriyaaKudoIsc", "aahashderuffy", "subins2000"}, selections[0])
-	assert.Contains(t, []string{"SuriyaaKudoIsc", "aahashderuffy", "subins2000"}, selections[1])
-
-	selections = team.RandomCaptainLogins(3)
-	assert.Len(t, selections, 3)
-	assert.Contains(t, []string{"SuriyaaKudoIsc", "aahashderuffy", "subins2000"}, selections[0])
-	assert.Contains(t, []string{"SuriyaaKudoIsc", "aahashderuffy", "subins2000"}, selections[1])
-	assert.Contains(t, []string{"SuriyaaKudoIsc", "aahashderuffy", "subins2000"}, selections[2])
-
-	selections = team.RandomCaptainLogins(4)
-	assert.Len(t, selections, 3)
-	assert.Contains(t, []string{"SuriyaaKudoIsc", "aahashderuffy", "subins2000"}, selections[0])
-	assert.Contains(t, []string{"SuriyaaKudoIsc", "aahashderuffy", "subins2000"}, selections[1])
-	assert.Contains(t, []string{"SuriyaaKudoIsc", "aahashderuffy", "subins2000"}, selections[2])
-}
-
-func TestTeamRandomCaptainLoginsExcluding(t *testing.T) {
-	excluded := "SuriyaaKudoIsc"
-	team := Team{Captains: []*github.User{
-		{Login: github.String("SuriyaaKudoIsc")},
-		{Login: github.String("aahashderuffy")},
-		{Login: github.String("subins2000")},
-	}}
-
-	selections := team.RandomCaptainLoginsExcluding(excluded, 1)
-	assert.Len(t, selections, 1)
-	assert.Contains(t, []string{"aahashderuffy", "subins2000"}, selections[0])
-
-	selections = team.RandomCaptainLoginsExcluding(excluded, 2)
-	assert.Len(t, selections, 2)
-	assert.Contains(t, []string{"aahashderuffy", "subins2000"}, selections[0])
-	assert.Contains(t, []string{"aahashderuffy", "subins2000"}, selections[1])
-
-	selections = team.RandomCaptainLoginsExcluding(excluded, 3)
-	assert.Len(t, selections, 2)
-	assert.Contains(t, []string{"aahashderuffy", "subins2000"}, selections[0])
-	assert.Contains(t, []string{"aahashderuffy", "subins2000"}, selections[1])
+	assert.NoError(t, CaptainRole.Validate())
+	assert.True(t, isCaptain(nil, auth.Command{Owner: "bunto", Repo: "minima", Login: "subins2000"}))
+	assert.False(t, isCaptain(nil, auth.Command{Owner: "bunto", Repo: "minima", Login: "parkr"}))
+	assert.False(t, isCaptain(nil, auth.Command{Owner: "bunto", Repo: "bunto", Login: "subins2000"}))
 }
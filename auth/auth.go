@@ -3,17 +3,17 @@ package auth
 
 import (
 	"fmt"
-	"log"
+	"net/http"
 
 	"github.com/google/go-github/github"
 	"github.com/buntobot/auto-reply/ctx"
 )
 
 var (
-	teamsCache             = map[string][]*github.Team{}
-	teamHasPushAccessCache = map[string]*github.Repository{}
-	teamMembershipCache    = map[string]bool{}
-	orgOwnersCache         = map[string][]*github.User{}
+	permissionCache     = newCache() // Permission by "owner/repo:login"
+	orgOwnersCache      = newCache() // []*github.User by org
+	teamsCache          = newCache() // []*github.Team by org
+	teamMembershipCache = newCache() // bool by "org/slug:login"
 )
 
 type authenticator struct {
@@ -21,15 +21,39 @@ type authenticator struct {
 }
 
 func CommenterHasPushAccess(context *ctx.Context, event github.IssueCommentEvent) bool {
-	auth := authenticator{context: context}
-	orgTeams := auth.teamsForOrg(*event.Repo.Owner.Login)
-	for _, team := range orgTeams {
-		if auth.isTeamMember(*team.ID, *event.Comment.User.Login) &&
-			auth.teamHasPushAccess(*team.ID, *event.Repo.Owner.Login, *event.Repo.Name) {
-			return true
-		}
+	return UserHasPushAccess(context, *event.Repo.Owner.Login, *event.Repo.Name, *event.Comment.User.Login)
+}
+
+// UserHasPushAccess returns true if the given user has write access, or
+// more, to owner/repo.
+func UserHasPushAccess(context *ctx.Context, owner, repo, login string) bool {
+	return UserHasPermission(context, owner, repo, login, WritePermission)
+}
+
+// UserHasPermission returns true if the given user has at least the given
+// level of access to owner/repo. It returns false if GitHub can't tell.
+func UserHasPermission(context *ctx.Context, owner, repo, login string, min Permission) bool {
+	permission, err := UserPermission(context, owner, repo, login)
+	if err != nil {
+		context.Log("ERROR fetching the permission of %s on %s/%s: %v", login, owner, repo, err)
+		return false
 	}
-	return false
+	return permission >= min
+}
+
+// UserPermission returns the level of access the given user has to
+// owner/repo, whether as a collaborator, through a team, or as an owner of
+// the org.
+func UserPermission(context *ctx.Context, owner, repo, login string) (Permission, error) {
+	auth := authenticator{context: context}
+	return auth.permission(owner, repo, login)
+}
+
+// UserIsTeamMember returns true if login is an active member of the team
+// with the given slug in org.
+func UserIsTeamMember(context *ctx.Context, org, slug, login string) (bool, error) {
+	auth := authenticator{context: context}
+	return auth.isTeamMember(org, slug, login)
 }
 
 func UserIsOrgOwner(context *ctx.Context, org, login string) bool {
@@ -42,68 +66,59 @@ func UserIsOrgOwner(context *ctx.Context, org, login string) bool {
 	return false
 }
 
-func (auth authenticator) isTeamMember(teamId int, login string) bool {
-	cacheKey := auth.cacheKeyIsTeamMember(teamId, login)
-	if _, ok := teamMembershipCache[cacheKey]; !ok {
-		newOk, _, err := auth.context.GitHub.Organizations.IsTeamMember(teamId, login)
-		if err != nil {
-			log.Printf("ERROR performing IsTeamMember(%d, \"%s\"): %v", teamId, login, err)
-			return false
-		}
-		teamMembershipCache[cacheKey] = newOk
+func (auth authenticator) permission(owner, repo, login string) (Permission, error) {
+	cacheKey := auth.cacheKeyPermission(owner, repo, login)
+	if permission, ok := permissionCache.get(cacheKey); ok {
+		return permission.(Permission), nil
 	}
-	return teamMembershipCache[cacheKey]
-}
 
-func (auth authenticator) teamHasPushAccess(teamId int, owner, repo string) bool {
-	cacheKey := auth.cacheKeyTeamHashPushAccess(teamId, owner, repo)
-	if _, ok := teamHasPushAccessCache[cacheKey]; !ok {
-		repository, _, err := auth.context.GitHub.Organizations.IsTeamRepo(teamId, owner, repo)
-		if err != nil {
-			log.Printf("ERROR performing IsTeamRepo(%d, \"%s\", \"%s\"): %v", teamId, owner, repo, err)
-			return false
-		}
-		if repository == nil {
-			return false
+	// go-github doesn't know about this endpoint yet.
+	req, err := auth.context.GitHub.NewRequest("GET",
+		fmt.Sprintf("repos/%s/%s/collaborators/%s/permission", owner, repo, login), nil)
+	if err != nil {
+		return NoPermission, err
+	}
+	level := struct {
+		Permission string `json:"permission"`
+		RoleName   string `json:"role_name"`
+	}{}
+	resp, err := auth.context.GitHub.Do(req, &level)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			permissionCache.set(cacheKey, NoPermission)
+			return NoPermission, nil
 		}
-		teamHasPushAccessCache[cacheKey] = repository
+		return NoPermission, err
 	}
-	permissions := *teamHasPushAccessCache[cacheKey].Permissions
-	return permissions["push"] || permissions["admin"]
-}
 
-func (auth authenticator) teamsForOrg(org string) []*github.Team {
-	if _, ok := teamsCache[org]; !ok {
-		teamz, _, err := auth.context.GitHub.Organizations.ListTeams(org, &github.ListOptions{
-			Page: 0, PerPage: 100,
-		})
+	// The role tells triage & maintain apart from read & write, but may be
+	// a custom role.
+	permission, err := ParsePermission(level.RoleName)
+	if err != nil {
+		permission, err = ParsePermission(level.Permission)
 		if err != nil {
-			log.Printf("ERROR performing ListTeams(\"%s\"): %v", org, err)
-			return nil
+			return NoPermission, err
 		}
-		teamsCache[org] = teamz
 	}
-	return teamsCache[org]
+	permissionCache.set(cacheKey, permission)
+	return permission, nil
 }
 
 func (auth authenticator) ownersForOrg(org string) []*github.User {
-	if _, ok := orgOwnersCache[org]; !ok {
-		owners, _, err := auth.context.GitHub.Organizations.ListMembers(org, &github.ListMembersOptions{
-			Role: "admin", // owners
-		})
-		if err != nil {
-			auth.context.Log("ERROR performing ListMembers(\"%s\"): %v", org, err)
-			return nil
-		}
-		orgOwnersCache[org] = owners
+	if owners, ok := orgOwnersCache.get(org); ok {
+		return owners.([]*github.User)
 	}
-	return orgOwnersCache[org]
-}
-
-func (auth authenticator) cacheKeyIsTeamMember(teamId int, login string) string {
-	return fmt.Sprintf("%d_%s", teamId, login)
+	owners, _, err := auth.context.GitHub.Organizations.ListMembers(org, &github.ListMembersOptions{
+		Role: "admin", // owners
+	})
+	if err != nil {
+		auth.context.Log("ERROR performing ListMembers(\"%s\"): %v", org, err)
+		return nil
+	}
+	orgOwnersCache.set(org, owners)
+	return owners
 }
 
-func (auth authenticator) cacheKeyTeamHashPushAccess(teamId int, owner, repo string) string {
-	return fmt.Sprintf("%d_%s_%s", teamId, owner, repo)
+func (auth authenticator) cacheKeyPermission(owner, repo, login string) string {
+	return fmt.Sprintf("%s/%s:%s", owner, repo, login)
 }
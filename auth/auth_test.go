@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func setup() (*http.ServeMux, *ctx.Context, func()) {
+	permissionCache.clear()
+	orgOwnersCache.clear()
+	teamsCache.clear()
+	teamMembershipCache.clear()
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	client := github.NewClient(nil)
+	url, _ := url.Parse(server.URL)
+	client.BaseURL = url
+	client.UploadURL = url
+
+	return mux, &ctx.Context{GitHub: client}, server.Close
+}
+
+// servePermissions serves the permissions of the users on bunto/bunto, as
+// {permission, role_name}, and counts the requests for each.
+func servePermissions(mux *http.ServeMux, permissions map[string][2]string, requests map[string]int) {
+	mux.HandleFunc("/repos/bunto/bunto/collaborators/", func(w http.ResponseWriter, r *http.Request) {
+		login := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/repos/bunto/bunto/collaborators/"), "/permission")
+		requests[login]++
+		permission, ok := permissions[login]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"permission": %q, "role_name": %q, "user": {"login": %q}}`, permission[0], permission[1], login)
+	})
+}
+
+func TestCacheExpires(t *testing.T) {
+	now := time.Now()
+	c := newCache()
+	c.now = func() time.Time { return now }
+
+	c.set("1_parkr", true)
+	value, ok := c.get("1_parkr")
+	assert.True(t, ok)
+	assert.Equal(t, true, value)
+
+	now = now.Add(CacheTTL)
+	_, ok = c.get("1_parkr")
+	assert.False(t, ok)
+}
+
+func TestCacheDeleteSuffix(t *testing.T) {
+	c := newCache()
+	c.set("1_bunto_bunto", true)
+	c.set("2_bunto_bunto", true)
+	c.set("1_bunto_bunto-feed", true)
+	c.deleteSuffix("_bunto_bunto")
+
+	_, ok := c.get("2_bunto_bunto")
+	assert.False(t, ok)
+	_, ok = c.get("1_bunto_bunto-feed")
+	assert.True(t, ok)
+}
+
+func TestUserPermission(t *testing.T) {
+	mux, context, teardown := setup()
+	defer teardown()
+
+	requests := map[string]int{}
+	servePermissions(mux, map[string][2]string{
+		"parkr":     {"admin", "admin"},
+		"benbalter": {"write", "maintain"},
+		"pathawks":  {"read", "triage"},
+		"dirtyf":    {"write", "release-manager"},
+		"octocat":   {"none", ""},
+	}, requests)
+
+	cases := []struct {
+		login    string
+		expected Permission
+	}{
+		{"parkr", AdminPermission},
+		{"benbalter", MaintainPermission},
+		{"pathawks", TriagePermission},
+		{"dirtyf", WritePermission},
+		{"octocat", NoPermission},
+		{"ghost", NoPermission},
+	}
+	for _, test := range cases {
+		permission, err := UserPermission(context, "bunto", "bunto", test.login)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, permission, test.login)
+	}
+
+	assert.True(t, UserHasPushAccess(context, "bunto", "bunto", "benbalter"))
+	assert.False(t, UserHasPushAccess(context, "bunto", "bunto", "pathawks"))
+	assert.True(t, UserHasPermission(context, "bunto", "bunto", "pathawks", TriagePermission))
+	assert.False(t, UserHasPermission(context, "bunto", "bunto", "benbalter", AdminPermission))
+	assert.Equal(t, 1, requests["benbalter"])
+	assert.Equal(t, 1, requests["ghost"])
+}
+
+func TestParsePermission(t *testing.T) {
+	permission, err := ParsePermission("maintain")
+	assert.NoError(t, err)
+	assert.Equal(t, MaintainPermission, permission)
+	assert.Equal(t, "maintain", permission.String())
+
+	_, err = ParsePermission("push")
+	assert.Error(t, err)
+}
+
+func TestMembershipHandlerRevokesPushAccess(t *testing.T) {
+	mux, context, teardown := setup()
+	defer teardown()
+
+	permissions, requests := map[string][2]string{"parkr": {"write", "write"}}, map[string]int{}
+	servePermissions(mux, permissions, requests)
+
+	assert.True(t, UserHasPushAccess(context, "bunto", "bunto", "parkr"))
+	assert.True(t, UserHasPushAccess(context, "bunto", "bunto", "parkr"))
+	assert.Equal(t, 1, requests["parkr"])
+
+	permissions["parkr"] = [2]string{"read", "read"}
+	assert.NoError(t, MembershipHandler(context, &github.MembershipEvent{
+		Action: github.String("removed"),
+		Member: &github.User{Login: github.String("parkr")},
+		Team:   &github.Team{ID: github.Int(1)},
+	}))
+	assert.False(t, UserHasPushAccess(context, "bunto", "bunto", "parkr"))
+	assert.Equal(t, 2, requests["parkr"])
+
+	assert.True(t, ctx.IsSkip(MembershipHandler(context, &github.TeamAddEvent{})))
+	assert.Error(t, MembershipHandler(context, &github.MembershipEvent{}))
+}
+
+func TestTeamAddAndMemberHandlersEvict(t *testing.T) {
+	_, context, teardown := setup()
+	defer teardown()
+
+	repo := &github.Repository{
+		Name:  github.String("bunto"),
+		Owner: &github.User{Login: github.String("bunto")},
+	}
+	permissionCache.set("bunto/bunto:parkr", WritePermission)
+	permissionCache.set("bunto/bunto:benbalter", WritePermission)
+	permissionCache.set("bunto/bunto-feed:parkr", WritePermission)
+
+	assert.NoError(t, MemberHandler(context, &github.MemberEvent{
+		Action: github.String("added"),
+		Member: &github.User{Login: github.String("parkr")},
+		Repo:   repo,
+	}))
+	_, ok := permissionCache.get("bunto/bunto:parkr")
+	assert.False(t, ok)
+	_, ok = permissionCache.get("bunto/bunto:benbalter")
+	assert.True(t, ok)
+
+	assert.NoError(t, TeamAddHandler(context, &github.TeamAddEvent{Team: &github.Team{ID: github.Int(1)}, Repo: repo}))
+	_, ok = permissionCache.get("bunto/bunto:benbalter")
+	assert.False(t, ok)
+	_, ok = permissionCache.get("bunto/bunto-feed:parkr")
+	assert.True(t, ok)
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheTTL is how long the answers from GitHub are trusted for. The
+// membership, team_add & member events evict them sooner.
+var CacheTTL = 10 * time.Minute
+
+// cache is a concurrency-safe map whose entries expire after CacheTTL.
+type cache struct {
+	sync.Mutex // protects entries
+	entries    map[string]cacheEntry
+
+	now func() time.Time
+}
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+func newCache() *cache {
+	return &cache{entries: map[string]cacheEntry{}, now: time.Now}
+}
+
+// get returns the value for key, unless there is none or it has expired.
+func (c *cache) get(key string) (interface{}, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !c.now().Before(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (c *cache) set(key string, value interface{}) {
+	c.Lock()
+	defer c.Unlock()
+	c.entries[key] = cacheEntry{value: value, expires: c.now().Add(CacheTTL)}
+}
+
+func (c *cache) delete(key string) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.entries, key)
+}
+
+// deletePrefix deletes every entry whose key starts with prefix.
+func (c *cache) deletePrefix(prefix string) {
+	c.Lock()
+	defer c.Unlock()
+	for key := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// deleteSuffix deletes every entry whose key ends with suffix.
+func (c *cache) deleteSuffix(suffix string) {
+	c.Lock()
+	defer c.Unlock()
+	for key := range c.entries {
+		if strings.HasSuffix(key, suffix) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+func (c *cache) clear() {
+	c.Lock()
+	defer c.Unlock()
+	c.entries = map[string]cacheEntry{}
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/google/go-github/github"
+)
+
+// MembershipHandler forgets the permissions of a user once they're added to
+// or removed from a team, which may have access to any repo.
+func MembershipHandler(context *ctx.Context, payload interface{}) error {
+	event, ok := payload.(*github.MembershipEvent)
+	if !ok {
+		return context.NewSkip("auth.MembershipHandler: not a membership event")
+	}
+	if event.Team == nil || event.Team.ID == nil || event.Member == nil || event.Member.Login == nil {
+		return context.NewError("auth.MembershipHandler: membership event without a team or member")
+	}
+
+	permissionCache.deleteSuffix(":" + *event.Member.Login)
+	teamMembershipCache.deleteSuffix(":" + *event.Member.Login)
+	context.IncrStat("auth.invalidated")
+	context.Log("auth: membership of %s in team %d changed, dropped cached permissions", *event.Member.Login, *event.Team.ID)
+	return nil
+}
+
+// TeamAddHandler forgets the permissions on a repo once a team is given
+// access to it.
+func TeamAddHandler(context *ctx.Context, payload interface{}) error {
+	event, ok := payload.(*github.TeamAddEvent)
+	if !ok {
+		return context.NewSkip("auth.TeamAddHandler: not a team_add event")
+	}
+	if event.Team == nil || event.Team.ID == nil || event.Repo == nil || event.Repo.Owner == nil ||
+		event.Repo.Owner.Login == nil || event.Repo.Name == nil {
+		return context.NewError("auth.TeamAddHandler: team_add event without a team or repository")
+	}
+
+	owner, repo := *event.Repo.Owner.Login, *event.Repo.Name
+	permissionCache.deletePrefix(owner + "/" + repo + ":")
+	context.IncrStat("auth.invalidated")
+	context.Log("auth: team %d was added to %s/%s, dropped cached permissions", *event.Team.ID, owner, repo)
+	return nil
+}
+
+// MemberHandler forgets the permission of a user on a repo once they're
+// added to it as a collaborator, removed from it, or their access changes.
+func MemberHandler(context *ctx.Context, payload interface{}) error {
+	event, ok := payload.(*github.MemberEvent)
+	if !ok {
+		return context.NewSkip("auth.MemberHandler: not a member event")
+	}
+	if event.Member == nil || event.Member.Login == nil || event.Repo == nil || event.Repo.Owner == nil ||
+		event.Repo.Owner.Login == nil || event.Repo.Name == nil {
+		return context.NewError("auth.MemberHandler: member event without a member or repository")
+	}
+
+	owner, repo, login := *event.Repo.Owner.Login, *event.Repo.Name, *event.Member.Login
+	auth := authenticator{context: context}
+	permissionCache.delete(auth.cacheKeyPermission(owner, repo, login))
+	context.IncrStat("auth.invalidated")
+	context.Log("auth: access of %s to %s/%s changed, dropped cached permission", login, owner, repo)
+	return nil
+}
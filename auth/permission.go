@@ -0,0 +1,50 @@
+package auth
+
+import "fmt"
+
+// Permission is a level of access to a repository. Each level includes the
+// ones before it.
+type Permission int
+
+const (
+	NoPermission Permission = iota
+	ReadPermission
+	TriagePermission
+	WritePermission
+	MaintainPermission
+	AdminPermission
+)
+
+var permissionNames = []string{"none", "read", "triage", "write", "maintain", "admin"}
+
+func (p Permission) String() string {
+	if p < NoPermission || int(p) >= len(permissionNames) {
+		return fmt.Sprintf("Permission(%d)", int(p))
+	}
+	return permissionNames[p]
+}
+
+// ParsePermission reads a permission as GitHub names it, e.g. "maintain".
+func ParsePermission(name string) (Permission, error) {
+	for i, permissionName := range permissionNames {
+		if name == permissionName {
+			return Permission(i), nil
+		}
+	}
+	return NoPermission, fmt.Errorf("auth: unknown permission %q, expected one of %v", name, permissionNames)
+}
+
+// UnmarshalYAML reads a permission by name, so configuration files can
+// require one.
+func (p *Permission) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err != nil {
+		return err
+	}
+	permission, err := ParsePermission(name)
+	if err != nil {
+		return err
+	}
+	*p = permission
+	return nil
+}
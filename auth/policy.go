@@ -0,0 +1,287 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/google/go-github/github"
+)
+
+// Role is who may run a command. It is one of:
+//
+//	anyone        anybody at all
+//	author        the author of the issue or pull request
+//	org_owner     an owner of the repo's org
+//	team:<slug>   a member of the team of the repo's org
+//	user:<login>  the given user, e.g. a listed triager
+//	<permission>  anyone with at least this access to the repo, e.g. "write"
+//
+// or a role registered by another package, see RegisterRole.
+type Role string
+
+const (
+	AnyoneRole   Role = "anyone"
+	AuthorRole   Role = "author"
+	OrgOwnerRole Role = "org_owner"
+
+	teamRolePrefix = "team:"
+	userRolePrefix = "user:"
+)
+
+// RoleChecker returns true if command.Login has the role it was registered
+// for.
+type RoleChecker func(context *ctx.Context, command Command) bool
+
+var (
+	rolesLock  sync.RWMutex // protects roleChecks
+	roleChecks = map[Role]RoleChecker{}
+)
+
+// RegisterRole defines a role, e.g. being an affinity team captain, which
+// the built-in ones can't express. Registering a role again replaces it.
+func RegisterRole(role Role, check RoleChecker) {
+	rolesLock.Lock()
+	defer rolesLock.Unlock()
+	roleChecks[role] = check
+}
+
+func registeredRole(role Role) (RoleChecker, bool) {
+	rolesLock.RLock()
+	defer rolesLock.RUnlock()
+	check, ok := roleChecks[role]
+	return check, ok
+}
+
+// TeamRole returns the role of the members of the team with the given slug.
+func TeamRole(slug string) Role {
+	return Role(teamRolePrefix + slug)
+}
+
+// UserRole returns the role of the user with the given login.
+func UserRole(login string) Role {
+	return Role(userRolePrefix + login)
+}
+
+// PermissionRole returns the role of those with at least the given access.
+func PermissionRole(permission Permission) Role {
+	return Role(permission.String())
+}
+
+// Validate returns an error if the role isn't one of the above.
+func (r Role) Validate() error {
+	switch {
+	case r == AnyoneRole || r == AuthorRole || r == OrgOwnerRole:
+		return nil
+	case strings.HasPrefix(string(r), teamRolePrefix):
+		if string(r) == teamRolePrefix {
+			return fmt.Errorf("auth: role %q is missing a team slug", r)
+		}
+		return nil
+	case strings.HasPrefix(string(r), userRolePrefix):
+		if string(r) == userRolePrefix {
+			return fmt.Errorf("auth: role %q is missing a login", r)
+		}
+		return nil
+	}
+	if _, ok := registeredRole(r); ok {
+		return nil
+	}
+	if _, err := ParsePermission(string(r)); err != nil {
+		return fmt.Errorf("auth: unknown role %q, expected %s, %s, %s, %s<slug>, %s<login> or a permission",
+			r, AnyoneRole, AuthorRole, OrgOwnerRole, teamRolePrefix, userRolePrefix)
+	}
+	return nil
+}
+
+// UnmarshalYAML reads a role, rejecting unknown ones so typos in
+// configuration files don't go unnoticed.
+func (r *Role) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err != nil {
+		return err
+	}
+	role := Role(name)
+	if err := role.Validate(); err != nil {
+		return err
+	}
+	*r = role
+	return nil
+}
+
+// Policy maps command names, e.g. "merge", to the roles allowed to run them.
+// Having any one of the roles is enough.
+type Policy map[string][]Role
+
+// DefaultPolicy applies to the commands a repo doesn't list in its own
+// policy.
+var DefaultPolicy = Policy{
+	"lgtm":    {PermissionRole(WritePermission)},
+	"merge":   {PermissionRole(WritePermission)},
+	"unstale": {AnyoneRole},
+}
+
+// Merge returns the policy with the commands of overrides replacing its own.
+func (p Policy) Merge(overrides Policy) Policy {
+	merged := Policy{}
+	for name, roles := range p {
+		merged[name] = roles
+	}
+	for name, roles := range overrides {
+		merged[name] = roles
+	}
+	return merged
+}
+
+// RolesFor returns the roles allowed to run the command. Commands the
+// policy doesn't list fall back to DefaultPolicy, then to write access.
+func (p Policy) RolesFor(name string) []Role {
+	if roles, ok := p[name]; ok {
+		return roles
+	}
+	if roles, ok := DefaultPolicy[name]; ok {
+		return roles
+	}
+	return []Role{PermissionRole(WritePermission)}
+}
+
+// Command is a request by Login to run the command Name on
+// Owner/Repo#Number, an issue or pull request opened by Author.
+type Command struct {
+	Name   string
+	Owner  string
+	Repo   string
+	Number int
+	Login  string
+	Author string
+}
+
+func (c Command) String() string {
+	return fmt.Sprintf("%s by @%s on %s/%s#%d", c.Name, c.Login, c.Owner, c.Repo, c.Number)
+}
+
+// Allowed returns true if the policy lets command.Login run the command.
+func (p Policy) Allowed(context *ctx.Context, command Command) bool {
+	auth := authenticator{context: context}
+	for _, role := range p.RolesFor(command.Name) {
+		if auth.hasRole(role, command) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize returns nil if the policy lets command.Login run the command.
+// If it doesn't, the user is told so on the issue, the denial is counted as
+// auth.denied and a skip is returned.
+func Authorize(context *ctx.Context, policy Policy, command Command) error {
+	if policy.Allowed(context, command) {
+		return nil
+	}
+
+	context.CountStatWithTags("auth.denied", 1, []string{"command:" + command.Name})
+	if command.Number > 0 {
+		body := fmt.Sprintf(
+			"Sorry @%s, you're not allowed to do that: `%s` needs one of these roles on %s/%s: %s.",
+			command.Login, command.Name, command.Owner, command.Repo, describeRoles(policy.RolesFor(command.Name)))
+		_, _, err := context.GitHub.Issues.CreateComment(command.Owner, command.Repo, command.Number, &github.IssueComment{Body: github.String(body)})
+		if err != nil {
+			context.Log("ERROR replying to the denied %s: %v", command, err)
+		}
+	}
+	return context.NewSkip("auth.Authorize: %s isn't allowed", command)
+}
+
+func describeRoles(roles []Role) string {
+	descriptions := make([]string, len(roles))
+	for i, role := range roles {
+		descriptions[i] = "`" + string(role) + "`"
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+func (auth authenticator) hasRole(role Role, command Command) bool {
+	switch {
+	case role == AnyoneRole:
+		return true
+	case role == AuthorRole:
+		return command.Author != "" && strings.EqualFold(command.Author, command.Login)
+	case role == OrgOwnerRole:
+		return UserIsOrgOwner(auth.context, command.Owner, command.Login)
+	case strings.HasPrefix(string(role), teamRolePrefix):
+		isMember, err := auth.isTeamMember(command.Owner, strings.TrimPrefix(string(role), teamRolePrefix), command.Login)
+		if err != nil {
+			auth.context.Log("ERROR checking whether %s has the %s role in %s: %v", command.Login, role, command.Owner, err)
+			return false
+		}
+		return isMember
+	case strings.HasPrefix(string(role), userRolePrefix):
+		return strings.EqualFold(strings.TrimPrefix(string(role), userRolePrefix), command.Login)
+	}
+	if check, ok := registeredRole(role); ok {
+		return check(auth.context, command)
+	}
+
+	min, err := ParsePermission(string(role))
+	if err != nil {
+		auth.context.Log("ERROR %v", err)
+		return false
+	}
+	return UserHasPermission(auth.context, command.Owner, command.Repo, command.Login, min)
+}
+
+// isTeamMember returns true if login is an active member of the team with
+// the given slug in org.
+func (auth authenticator) isTeamMember(org, slug, login string) (bool, error) {
+	cacheKey := fmt.Sprintf("%s/%s:%s", org, slug, login)
+	if isMember, ok := teamMembershipCache.get(cacheKey); ok {
+		return isMember.(bool), nil
+	}
+
+	team, err := auth.teamBySlug(org, slug)
+	if err != nil {
+		return false, err
+	}
+	isMember := false
+	if team != nil {
+		membership, resp, err := auth.context.GitHub.Organizations.GetTeamMembership(*team.ID, login)
+		if err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
+			return false, err
+		}
+		isMember = err == nil && membership.State != nil && *membership.State == "active"
+	}
+	teamMembershipCache.set(cacheKey, isMember)
+	return isMember, nil
+}
+
+// teamBySlug returns the team of the org with the given slug, or nil if
+// there is none.
+func (auth authenticator) teamBySlug(org, slug string) (*github.Team, error) {
+	teams, ok := teamsCache.get(org)
+	if !ok {
+		var all []*github.Team
+		opt := &github.ListOptions{PerPage: 100}
+		for {
+			page, resp, err := auth.context.GitHub.Organizations.ListTeams(org, opt)
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, page...)
+			if resp.NextPage == 0 {
+				break
+			}
+			opt.Page = resp.NextPage
+		}
+		teamsCache.set(org, all)
+		teams = all
+	}
+
+	for _, team := range teams.([]*github.Team) {
+		if team.Slug != nil && *team.Slug == slug {
+			return team, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleValidate(t *testing.T) {
+	RegisterRole("captain", func(*ctx.Context, Command) bool { return false })
+	for _, role := range []Role{"anyone", "author", "org_owner", "team:core", "user:parkr", "triage", "admin", "captain"} {
+		assert.NoError(t, role.Validate(), "role %q", role)
+	}
+	for _, role := range []Role{"team:", "user:", "maintainers", ""} {
+		assert.Error(t, role.Validate(), "role %q", role)
+	}
+}
+
+func TestPolicyRolesFor(t *testing.T) {
+	policy := DefaultPolicy.Merge(Policy{"merge": {AuthorRole}})
+	assert.Equal(t, []Role{AuthorRole}, policy.RolesFor("merge"))
+	assert.Equal(t, []Role{"write"}, policy.RolesFor("lgtm"))
+	assert.Equal(t, []Role{"write"}, Policy{}.RolesFor("unknown"))
+	assert.Equal(t, []Role{"write"}, DefaultPolicy["merge"], "merging mustn't change the default policy")
+}
+
+func TestPolicyAllowed(t *testing.T) {
+	mux, context, teardown := setup()
+	defer teardown()
+
+	servePermissions(mux, map[string][2]string{
+		"parkr":  {"write", "write"},
+		"mattr-": {"read", "triage"},
+	}, map[string]int{})
+	mux.HandleFunc("/orgs/bunto/teams", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.Team{{ID: github.Int(5), Slug: github.String("core")}})
+	})
+	mux.HandleFunc("/teams/5/memberships/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/teams/5/memberships/mattr-" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"state": "active", "role": "member"}`)
+	})
+	mux.HandleFunc("/orgs/bunto/members", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.User{{Login: github.String("benbalter")}})
+	})
+
+	RegisterRole("maintainer", func(context *ctx.Context, command Command) bool {
+		return command.Login == "envygeeks"
+	})
+	policy := Policy{
+		"close":   {UserRole("Someone"), "maintainer"},
+		"merge":   {PermissionRole(WritePermission)},
+		"label":   {PermissionRole(TriagePermission), AuthorRole},
+		"release": {TeamRole("core"), OrgOwnerRole},
+		"unstale": {AnyoneRole},
+	}
+	cases := []struct {
+		command, login string
+		allowed        bool
+	}{
+		{"merge", "parkr", true},
+		{"merge", "mattr-", false},
+		{"label", "mattr-", true},
+		{"label", "octocat", true},
+		{"label", "someone", false},
+		{"release", "mattr-", true},
+		{"release", "benbalter", true},
+		{"release", "parkr", false},
+		{"unstale", "someone", true},
+		{"close", "someone", true},
+		{"close", "envygeeks", true},
+		{"close", "parkr", false},
+	}
+	for _, test := range cases {
+		command := Command{Name: test.command, Owner: "bunto", Repo: "bunto", Number: 1, Login: test.login, Author: "octocat"}
+		assert.Equal(t, test.allowed, policy.Allowed(context, command), "%s", command)
+	}
+}
+
+func TestAuthorizeRepliesWhenDenied(t *testing.T) {
+	mux, context, teardown := setup()
+	defer teardown()
+
+	servePermissions(mux, map[string][2]string{"parkr": {"write", "write"}}, map[string]int{})
+	var replies []string
+	mux.HandleFunc("/repos/bunto/bunto/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		comment := &github.IssueComment{}
+		json.NewDecoder(r.Body).Decode(comment)
+		replies = append(replies, *comment.Body)
+		json.NewEncoder(w).Encode(comment)
+	})
+
+	command := Command{Name: "merge", Owner: "bunto", Repo: "bunto", Number: 1, Login: "parkr"}
+	assert.NoError(t, Authorize(context, DefaultPolicy, command))
+	assert.Empty(t, replies)
+
+	command.Login = "someone"
+	err := Authorize(context, DefaultPolicy, command)
+	assert.Error(t, err)
+	if assert.Len(t, replies, 1) {
+		assert.Contains(t, replies[0], "@someone")
+		assert.Contains(t, replies[0], "`write`")
+	}
+}
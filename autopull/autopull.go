@@ -35,13 +35,13 @@ func (h *Handler) AcceptAllRepos(newValue bool) {
 func (h *Handler) CreatePullRequestFromPush(context *ctx.Context, event interface{}) error {
 	push, ok := event.(*github.PushEvent)
 	if !ok {
-		return context.NewError("AutoPull: not an push event")
+		return context.NewSkip("AutoPull: not an push event")
 	}
 
 	if strings.HasPrefix(*push.Ref, "refs/heads/pull/") && (h.acceptAllRepos || h.handlesRepo(*push.Repo.FullName)) {
 		pr := newPRForPush(push)
 		if pr == nil {
-			return context.NewError("AutoPull: no commits for %s on %s/%s", *push.Ref, *push.Repo.Owner.Name, *push.Repo.Name)
+			return context.NewSkip("AutoPull: no commits for %s on %s/%s", *push.Ref, *push.Repo.Owner.Name, *push.Repo.Name)
 		}
 
 		pull, _, err := context.GitHub.PullRequests.Create(*push.Repo.Owner.Name, *push.Repo.Name, pr)
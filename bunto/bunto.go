@@ -2,18 +2,20 @@
 package bunto
 
 import (
-	"fmt"
-
 	"github.com/buntobot/auto-reply/affinity"
+	"github.com/buntobot/auto-reply/auth"
 	"github.com/buntobot/auto-reply/autopull"
 	"github.com/buntobot/auto-reply/chlog"
+	"github.com/buntobot/auto-reply/codeowners"
+	"github.com/buntobot/auto-reply/commands"
 	"github.com/buntobot/auto-reply/ctx"
 	"github.com/buntobot/auto-reply/hooks"
 	"github.com/buntobot/auto-reply/labeler"
 	"github.com/buntobot/auto-reply/lgtm"
+	"github.com/buntobot/auto-reply/repoconfig"
+	"github.com/buntobot/auto-reply/stats"
 	"github.com/buntobot/auto-reply/travis"
 
-	"github.com/google/go-github/github"
 	"github.com/buntobot/auto-reply/bunto/deprecate"
 	"github.com/buntobot/auto-reply/bunto/issuecomment"
 )
@@ -24,36 +26,16 @@ var buntoOrgEventHandlers = hooks.EventHandlerMap{
 	hooks.IssueCommentEvent: {
 		issuecomment.PendingFeedbackUnlabeler,
 		issuecomment.StaleUnlabeler,
-		chlog.MergeAndLabel,
 	},
 	hooks.PullRequestEvent: {
 		labeler.IssueHasPullRequestLabeler,
 		labeler.PendingRebaseNeedsWorkPRUnlabeler,
 	},
-	hooks.StatusEvent: {statStatus, travis.FailingFmtBuildHandler},
-}
-
-func statStatus(context *ctx.Context, payload interface{}) error {
-	status, ok := payload.(*github.StatusEvent)
-	if !ok {
-		return context.NewError("statStatus: not an status event")
-	}
-
-	context.SetIssue(*status.Repo.Owner.Login, *status.Repo.Name, -1)
-
-	if context.Statsd != nil {
-		statName := fmt.Sprintf("status.%s", *status.State)
-		context.Log("context.Statsd.Count(%s, 1, []string{context:%s, repo:%s}, 1)", statName, *status.Context, context.Issue)
-		return context.Statsd.Incr(
-			statName,
-			[]string{
-				"context:" + *status.Context,
-				"repo:" + context.Issue.String(),
-			},
-			float64(1.0), // rate..?
-		)
-	}
-	return nil
+	hooks.PushEvent:       {repoconfig.PushHandler},
+	hooks.StatusEvent:     {stats.StatusHandler, travis.FailingFmtBuildHandler},
+	hooks.MembershipEvent: {auth.MembershipHandler},
+	hooks.TeamAddEvent:    {auth.TeamAddHandler},
+	hooks.MemberEvent:     {auth.MemberHandler},
 }
 
 func buntoAffinityHandler(context *ctx.Context) *affinity.Handler {
@@ -109,10 +91,25 @@ func NewBuntoOrgHandler(context *ctx.Context) *hooks.GlobalHandler {
 	buntoOrgEventHandlers.AddHandler(hooks.IssuesEvent, affinityHandler.AssignIssueToAffinityTeamCaptain)
 	buntoOrgEventHandlers.AddHandler(hooks.IssueCommentEvent, affinityHandler.AssignIssueToAffinityTeamCaptainFromComment)
 	buntoOrgEventHandlers.AddHandler(hooks.PullRequestEvent, affinityHandler.AssignPRToAffinityTeamCaptain)
+	buntoOrgEventHandlers.AddHandler(hooks.MembershipEvent, affinityHandler.MembershipHandler)
+	buntoOrgEventHandlers.AddHandler(hooks.TeamEvent, affinityHandler.TeamHandler)
+	buntoOrgEventHandlers.AddHandler(hooks.PullRequestEvent, codeowners.RequestReviewersHandler)
 
 	lgtmHandler := newLgtmHandler()
 	buntoOrgEventHandlers.AddHandler(hooks.PullRequestReviewEvent, lgtmHandler.PullRequestReviewHandler)
 
+	router := &commands.Router{}
+	router.Register(chlog.MergeCommand)
+	for _, command := range affinityHandler.Commands() {
+		router.Register(command)
+	}
+	affinityHandler.SetRouter(router)
+	for _, command := range labeler.LabelCommands(labeler.LabelNames(labeler.CanonicalLabels)) {
+		router.Register(command)
+	}
+	buntoOrgEventHandlers.AddHandler(hooks.IssueCommentEvent, router.IssueCommentHandler)
+	buntoOrgEventHandlers.AddHandler(hooks.PullRequestReviewCommentEvent, router.PullRequestReviewCommentHandler)
+
 	autopullHandler := autopull.Handler{}
 	autopullHandler.AcceptAllRepos(true)
 	buntoOrgEventHandlers.AddHandler(hooks.PushEvent, autopullHandler.CreatePullRequestFromPush)
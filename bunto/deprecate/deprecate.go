@@ -14,18 +14,38 @@ var (
 	}
 )
 
+// Handler closes new issues on the repos added to it, leaving that repo's
+// stock message as a comment.
+type Handler struct {
+	messages map[string]string
+}
+
+// AddRepo deprecates owner/name. New issues are closed with message.
+func (h *Handler) AddRepo(owner, name, message string) {
+	if h.messages == nil {
+		h.messages = map[string]string{}
+	}
+	h.messages[owner+"/"+name] = message
+}
+
+// DeprecateOldRepos closes new issues on the repos in deprecatedRepos.
 func DeprecateOldRepos(context *ctx.Context, event interface{}) error {
+	handler := &Handler{messages: deprecatedRepos}
+	return handler.DeprecateOldRepos(context, event)
+}
+
+func (h *Handler) DeprecateOldRepos(context *ctx.Context, event interface{}) error {
 	issue, ok := event.(*github.IssuesEvent)
 	if !ok {
-		return context.NewError("DeprecateOldRepos: not an issue event")
+		return context.NewSkip("DeprecateOldRepos: not an issue event")
 	}
 
 	if *issue.Action != "opened" {
-		return context.NewError("DeprecateOldRepos: issue event's action is not 'opened'")
+		return context.NewSkip("DeprecateOldRepos: issue event's action is not 'opened'")
 	}
 
 	owner, name, number := *issue.Repo.Owner.Login, *issue.Repo.Name, *issue.Issue.Number
-	if message, ok := deprecatedRepos[*issue.Repo.FullName]; ok {
+	if message, ok := h.messages[*issue.Repo.FullName]; ok {
 		err := commentAndClose(context, owner, name, number, message)
 		if err != nil {
 			return err
@@ -11,7 +11,7 @@ const pendingFeedbackLabel = "pending-feedback"
 func PendingFeedbackUnlabeler(context *ctx.Context, event interface{}) error {
 	comment, ok := event.(*github.IssueCommentEvent)
 	if !ok {
-		return context.NewError("PendingFeedbackUnlabeler: not an issue comment event")
+		return context.NewSkip("PendingFeedbackUnlabeler: not an issue comment event")
 	}
 
 	if senderAndCreatorEqual(comment) && hasLabel(comment.Issue.Labels, pendingFeedbackLabel) {
@@ -2,14 +2,16 @@ package issuecomment
 
 import (
 	"github.com/google/go-github/github"
+	"github.com/buntobot/auto-reply/auth"
 	"github.com/buntobot/auto-reply/ctx"
 	"github.com/buntobot/auto-reply/labeler"
+	"github.com/buntobot/auto-reply/repoconfig"
 )
 
 func StaleUnlabeler(context *ctx.Context, event interface{}) error {
 	comment, ok := event.(*github.IssueCommentEvent)
 	if !ok {
-		return context.NewError("StaleUnlabeler: not an issue comment event")
+		return context.NewSkip("StaleUnlabeler: not an issue comment event")
 	}
 
 	if *comment.Action != "created" {
@@ -21,6 +23,24 @@ func StaleUnlabeler(context *ctx.Context, event interface{}) error {
 	}
 
 	owner, name, number := *comment.Repo.Owner.Login, *comment.Repo.Name, *comment.Issue.Number
+	if !hasLabel(comment.Issue.Labels, "stale") {
+		return context.NewSkip("StaleUnlabeler: %s/%s#%d isn't stale", owner, name, number)
+	}
+
+	// A comment isn't a command, so those who may not unstale the issue
+	// aren't told so.
+	command := auth.Command{
+		Name:   "unstale",
+		Owner:  owner,
+		Repo:   name,
+		Number: number,
+		Login:  *comment.Sender.Login,
+		Author: *comment.Issue.User.Login,
+	}
+	if !repoconfig.Get(context, owner, name).Policy().Allowed(context, command) {
+		return context.NewSkip("StaleUnlabeler: %s isn't allowed", command)
+	}
+
 	err := labeler.RemoveLabelIfExists(context.GitHub, owner, name, number, "stale")
 	if err != nil {
 		return context.NewError("StaleUnlabeler: error removing label on %s/%s#%d: %v", owner, name, number, err)
@@ -13,16 +13,16 @@ var versionTagRegexp = regexp.MustCompile(`v(\d+\.\d+\.\d+)(\.pre\.(beta|rc)\d+)
 func CreateReleaseOnTagHandler(context *ctx.Context, payload interface{}) error {
 	create, ok := payload.(*github.CreateEvent)
 	if !ok {
-		return context.NewError("chlog.CreateReleaseOnTagHandler: not a create event")
+		return context.NewSkip("chlog.CreateReleaseOnTagHandler: not a create event")
 	}
 
 	if *create.RefType != "tag" {
-		return context.NewError("chlog.CreateReleaseOnTagHandler: not a tag create event")
+		return context.NewSkip("chlog.CreateReleaseOnTagHandler: not a tag create event")
 	}
 
 	version := extractVersion(*create.Ref)
 	if version == "" {
-		return context.NewError("chlog.CreateReleaseOnTagHandler: not a version tag (%s)", *create.Ref)
+		return context.NewSkip("chlog.CreateReleaseOnTagHandler: not a version tag (%s)", *create.Ref)
 	}
 
 	isPreRelease := strings.Index(version, ".pre") >= 0
@@ -43,7 +43,7 @@ func CreateReleaseOnTagHandler(context *ctx.Context, payload interface{}) error
 
 	versionLog := changes.GetVersion(desiredRef)
 	if versionLog == nil {
-		return context.NewError("chlog.CreateReleaseOnTagHandler: no '%s' version in history file", desiredRef)
+		return context.NewSkip("chlog.CreateReleaseOnTagHandler: no '%s' version in history file", desiredRef)
 	}
 
 	releaseBodyForVersion := strings.Join(strings.SplitN(versionLog.String(), "\n\n", 2)[1:], "\n")
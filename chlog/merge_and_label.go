@@ -2,7 +2,6 @@ package chlog
 
 import (
 	"encoding/base64"
-	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -11,8 +10,9 @@ import (
 	"sync"
 
 	"github.com/google/go-github/github"
-	"github.com/buntobot/auto-reply/auth"
+	"github.com/buntobot/auto-reply/commands"
 	"github.com/buntobot/auto-reply/ctx"
+	"github.com/buntobot/auto-reply/repoconfig"
 	"github.com/parkr/changelog"
 )
 
@@ -22,11 +22,14 @@ type changelogCategory struct {
 	Labels                []string
 }
 
+type changelogCategories []changelogCategory
+
 var (
-	mergeCommentRegexp = regexp.MustCompile("@[a-zA-Z-_]+: (merge|:shipit:|:ship:)( \\+([a-zA-Z-_ ]+))?")
-	mergeOptions       = &github.PullRequestOptions{MergeMethod: "squash"}
+	mergeOptions = &github.PullRequestOptions{MergeMethod: "squash"}
 
-	categories = []changelogCategory{
+	// categories are used unless the repo lists its own in its
+	// .github/buntobot.yml.
+	categories = changelogCategories{
 		changelogCategory{
 			Prefix:  "major",
 			Slug:    "major-enhancements",
@@ -72,43 +75,37 @@ var (
 	}
 )
 
-func MergeAndLabel(context *ctx.Context, payload interface{}) error {
-	event, ok := payload.(*github.IssueCommentEvent)
-	if !ok {
-		return context.NewError("MergeAndLabel: not an issue comment event")
-	}
-
-	// Is this a pull request?
-	if event.Issue == nil || event.Issue.PullRequestLinks == nil {
-		return context.NewError("MergeAndLabel: not a pull request")
-	}
+// MergeCommand merges a pull request with "@buntobot: merge +<category>",
+// labels it and files it under the category in the History file. Who may
+// run it is up to the repo's auth.Policy, write access by default.
+var MergeCommand = commands.Command{
+	Name:    "merge",
+	Aliases: []string{":shipit:", ":ship:"},
+	Summary: "merges the pull request and files it in the History file, under the changelog category if given, e.g. `+bug`.",
+	Args: []commands.Arg{
+		{Name: "+category", Optional: true, Rest: true, Pattern: regexp.MustCompile(`^\+[a-zA-Z-_ ]+$`)},
+	},
+	PullRequestOnly: true,
+	Handler:         MergeAndLabel,
+}
 
+func MergeAndLabel(context *ctx.Context, invocation *commands.Invocation) error {
 	var changeSectionLabel string
-	isReq, labelFromComment := parseMergeRequestComment(*event.Comment.Body)
-
-	// Is It a merge request comment?
-	if !isReq {
-		return context.NewError("MergeAndLabel: not a merge request comment")
-	}
 
 	if os.Getenv("AUTO_REPLY_DEBUG") == "true" {
-		log.Println("MergeAndLabel: received event:", event)
+		log.Println("MergeAndLabel: received event:", invocation.Event)
 	}
 
 	var wg sync.WaitGroup
 
-	owner, repo, number := *event.Repo.Owner.Login, *event.Repo.Name, *event.Issue.Number
+	owner, repo, number := invocation.Owner, invocation.Repo, invocation.Number
 	ref := fmt.Sprintf("%s/%s#%d", owner, repo, number)
 
-	// Does the user have merge/label abilities?
-	if !auth.CommenterHasPushAccess(context, *event) {
-		log.Printf("%s isn't authenticated to merge anything on %s", *event.Comment.User.Login, *event.Repo.FullName)
-		return errors.New("commenter isn't allowed to merge")
-	}
-
 	// Should it be labeled?
+	repoCategories := categoriesFor(context, owner, repo)
+	labelFromComment := repoCategories.labelForCategory(invocation.Arg("+category"))
 	if labelFromComment != "" {
-		changeSectionLabel = sectionForLabel(labelFromComment)
+		changeSectionLabel = repoCategories.sectionForLabel(labelFromComment)
 	} else {
 		changeSectionLabel = "none"
 	}
@@ -146,7 +143,7 @@ func MergeAndLabel(context *ctx.Context, payload interface{}) error {
 
 	wg.Add(1)
 	go func() {
-		err := addLabelsForSubsection(context, owner, repo, number, changeSectionLabel)
+		err := addLabelsForSubsection(context, owner, repo, number, repoCategories.labelsForSubsection(changeSectionLabel))
 		if err != nil {
 			fmt.Printf("MergeAndLabel: error applying labels: %v\n", err)
 		}
@@ -174,28 +171,42 @@ func MergeAndLabel(context *ctx.Context, payload interface{}) error {
 	return nil
 }
 
-func parseMergeRequestComment(commentBody string) (bool, string) {
-	matches := mergeCommentRegexp.FindAllStringSubmatch(commentBody, -1)
-	if matches == nil || matches[0] == nil {
-		return false, ""
+// categoriesFor returns the changelog categories listed in the repo's
+// .github/buntobot.yml, or the default ones if it lists none.
+func categoriesFor(context *ctx.Context, owner, repo string) changelogCategories {
+	custom := repoconfig.Get(context, owner, repo).Categories()
+	if len(custom) == 0 {
+		return categories
 	}
 
-	var label string
-	if len(matches[0]) >= 4 {
-		if labelFromComment := matches[0][3]; labelFromComment != "" {
-			label = downcaseAndHyphenize(labelFromComment)
-		}
+	repoCategories := changelogCategories{}
+	for _, category := range custom {
+		repoCategories = append(repoCategories, changelogCategory{
+			Prefix:  category.Prefix,
+			Slug:    category.Slug,
+			Section: category.Section,
+			Labels:  category.Labels,
+		})
 	}
+	return repoCategories
+}
 
-	return true, normalizeLabel(label)
+// labelForCategory returns the slug of the category given to the merge
+// command, e.g. "bug-fixes" for "+Bug Fix", or "" if none was.
+func (c changelogCategories) labelForCategory(category string) string {
+	label := downcaseAndHyphenize(strings.TrimPrefix(category, "+"))
+	if label == "" {
+		return ""
+	}
+	return c.normalizeLabel(label)
 }
 
 func downcaseAndHyphenize(label string) string {
 	return strings.Replace(strings.ToLower(label), " ", "-", -1)
 }
 
-func normalizeLabel(label string) string {
-	for _, category := range categories {
+func (c changelogCategories) normalizeLabel(label string) string {
+	for _, category := range c {
 		if strings.HasPrefix(label, category.Prefix) {
 			return category.Slug
 		}
@@ -205,7 +216,11 @@ func normalizeLabel(label string) string {
 }
 
 func sectionForLabel(slug string) string {
-	for _, category := range categories {
+	return categories.sectionForLabel(slug)
+}
+
+func (c changelogCategories) sectionForLabel(slug string) string {
+	for _, category := range c {
 		if slug == category.Slug {
 			return category.Section
 		}
@@ -215,7 +230,11 @@ func sectionForLabel(slug string) string {
 }
 
 func labelsForSubsection(changeSectionLabel string) []string {
-	for _, category := range categories {
+	return categories.labelsForSubsection(changeSectionLabel)
+}
+
+func (c changelogCategories) labelsForSubsection(changeSectionLabel string) []string {
+	for _, category := range c {
 		if changeSectionLabel == category.Section {
 			return category.Labels
 		}
@@ -233,16 +252,9 @@ func selectSectionLabel(labels []github.Label) string {
 	return ""
 }
 
-func containsChangeLabel(commentBody string) bool {
-	_, labelFromComment := parseMergeRequestComment(commentBody)
-	return labelFromComment != ""
-}
-
-func addLabelsForSubsection(context *ctx.Context, owner, repo string, number int, changeSectionLabel string) error {
-	labels := labelsForSubsection(changeSectionLabel)
-
+func addLabelsForSubsection(context *ctx.Context, owner, repo string, number int, labels []string) error {
 	if len(labels) < 1 {
-		return fmt.Errorf("no labels for changeSectionLabel='%s'", changeSectionLabel)
+		return fmt.Errorf("no labels for %s/%s#%d", owner, repo, number)
 	}
 
 	_, _, err := context.GitHub.Issues.AddLabelsToIssue(owner, repo, number, labels)
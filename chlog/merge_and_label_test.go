@@ -7,34 +7,35 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-func TestParseMergeRequestComment(t *testing.T) {
-	comments := []struct {
-		comment string
-		isReq   bool
-		label   string
-		section string
-		labels  []string
+func TestLabelForCategory(t *testing.T) {
+	cases := []struct {
+		category string
+		label    string
+		section  string
+		labels   []string
 	}{
-		{"it looked like you could merge it", false, "", "", []string{}},
-		{"@buntobot: merge", true, "", "", []string{}},
-		{"@buntobot: :shipit:", true, "", "", []string{}},
-		{"@buntobot: :ship:", true, "", "", []string{}},
-		{"@buntobot: merge +Site", true, "site-enhancements", "Site Enhancements", []string{"documentation"}},
-		{"@buntobot: merge +major", true, "major-enhancements", "Major Enhancements", []string{"feature"}},
-		{"@buntobot: merge +minor-enhancement", true, "minor-enhancements", "Minor Enhancements", []string{"enhancement"}},
-		{"@buntobot: merge +Bug Fix\n", true, "bug-fixes", "Bug Fixes", []string{"bug", "fix"}},
-		{"@buntobot: merge +port", true, "forward-ports", "Forward Ports", []string{"forward-port"}},
+		{"", "", "", []string{}},
+		{"+Site", "site-enhancements", "Site Enhancements", []string{"documentation"}},
+		{"+major", "major-enhancements", "Major Enhancements", []string{"feature"}},
+		{"+minor-enhancement", "minor-enhancements", "Minor Enhancements", []string{"enhancement"}},
+		{"+Bug Fix", "bug-fixes", "Bug Fixes", []string{"bug", "fix"}},
+		{"+port", "forward-ports", "Forward Ports", []string{"forward-port"}},
 	}
-	for _, c := range comments {
-		isReq, label := parseMergeRequestComment(c.comment)
+	for _, c := range cases {
+		label := categories.labelForCategory(c.category)
 		section := sectionForLabel(c.label)
-		assert.Equal(t, c.isReq, isReq, "'%s' should have isReq=%v", c.comment, c.isReq)
-		assert.Equal(t, c.label, label, "'%s' should have label=%v", c.comment, c.label)
-		assert.Equal(t, c.section, section, "'%s' should have section=%v", c.comment, c.section)
-		assert.Equal(t, c.labels, labelsForSubsection(section), "'%s' should have labels=%v", c.comment, c.labels)
+		assert.Equal(t, c.label, label, "'%s' should have label=%v", c.category, c.label)
+		assert.Equal(t, c.section, section, "'%s' should have section=%v", c.category, c.section)
+		assert.Equal(t, c.labels, labelsForSubsection(section), "'%s' should have labels=%v", c.category, c.labels)
 	}
 }
 
+func TestMergeCommandCategoryPattern(t *testing.T) {
+	pattern := MergeCommand.Args[0].Pattern
+	assert.True(t, pattern.MatchString("+Bug Fix"))
+	assert.False(t, pattern.MatchString("please"))
+}
+
 func TestBase64Decode(t *testing.T) {
 	encoded, err := ioutil.ReadFile("history_contents.enc")
 	assert.NoError(t, err)
@@ -61,3 +62,18 @@ func TestAddMergeReference(t *testing.T) {
 	historyFile = addMergeReference(string(buntoHistory), "Development Fixes", "A marvelous change.", 41526)
 	assert.Contains(t, historyFile, "* A marvelous change. (#41526)\n\n### Site Enhancements")
 }
+
+func TestRepoChangelogCategories(t *testing.T) {
+	repoCategories := changelogCategories{
+		{Prefix: "feat", Slug: "features", Section: "Features", Labels: []string{"feature"}},
+	}
+
+	label := repoCategories.labelForCategory("+feature")
+	assert.Equal(t, "features", label)
+	assert.Equal(t, "Features", repoCategories.sectionForLabel(label))
+	assert.Equal(t, []string{"feature"}, repoCategories.labelsForSubsection("Features"))
+
+	label = repoCategories.labelForCategory("+major")
+	assert.Equal(t, "major", label)
+	assert.Equal(t, []string{}, repoCategories.labelsForSubsection("Major Enhancements"))
+}
@@ -5,27 +5,108 @@ import (
 	"flag"
 	"log"
 	"net/http"
+	"os"
+	"syscall"
 
+	"github.com/buntobot/auto-reply/affinity"
 	"github.com/buntobot/auto-reply/ctx"
 	"github.com/buntobot/auto-reply/bunto"
+	"github.com/buntobot/auto-reply/config"
+	"github.com/buntobot/auto-reply/deliverylog"
+	"github.com/buntobot/auto-reply/hooks"
+	"github.com/buntobot/auto-reply/queue"
 )
 
+// adminTokenEnvVar holds the token required to reload the configuration
+// over HTTP. Without it, only SIGHUP can reload the configuration.
+const adminTokenEnvVar = "AUTO_REPLY_ADMIN_TOKEN"
+
 var context *ctx.Context
 
 func main() {
 	var port string
 	flag.StringVar(&port, "port", "8080", "The port to serve to")
+	var configPath string
+	flag.StringVar(&configPath, "config", "", "A YAML or JSON configuration file (default: the Go configuration in package bunto)")
+	var queueDir string
+	flag.StringVar(&queueDir, "queue", "", "A directory to persist deliveries to, so failed handlers are retried (default: fire handlers right away)")
+	var workers int
+	flag.IntVar(&workers, "workers", 4, "The number of handlers to run at once when using -queue")
+	var deliveryLogDir string
+	flag.StringVar(&deliveryLogDir, "delivery-log", "", "A directory to record deliveries to, so they can be replayed with replay-webhook")
+	var deliveryLogSize int
+	flag.IntVar(&deliveryLogSize, "delivery-log-size", deliverylog.DefaultMaxDeliveries, "The number of most recent deliveries to keep in -delivery-log")
+	var awayFile string
+	flag.StringVar(&awayFile, "captains-away", "", "A JSON file to keep the affinity team captains who said they're away in (default: kept in memory)")
+	var dryRun bool
+	flag.BoolVar(&dryRun, "dry-run", false, "Log the changes the handlers would make on GitHub instead of making them")
 	flag.Parse()
 	context = ctx.NewDefaultContext()
+	if dryRun {
+		context.EnableDryRun()
+		log.Println("Dry run: changes to GitHub will only be logged")
+	}
+
+	if awayFile != "" {
+		if err := affinity.PersistAvailability(awayFile); err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	http.HandleFunc("/_ping", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/plain")
 		w.Write([]byte("ok\n"))
 	}))
 
-	buntoOrgHandler := bunto.NewBuntoOrgHandler(context)
-	http.Handle("/_github/bunto", buntoOrgHandler)
+	if configPath != "" {
+		handler := &hooks.GlobalHandler{Context: context}
+		reloader, conf, err := config.NewReloader(handler, configPath, os.Getenv(adminTokenEnvVar))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Reload the configuration upon `kill -HUP` or a POST to /_admin/reload.
+		reloader.ReloadOnSignal(syscall.SIGHUP)
+		http.Handle("/_admin/reload", reloader)
+
+		useDeliveryLog(handler, deliveryLogDir, deliveryLogSize)
+		useQueue(handler, queueDir, workers)
+		http.Handle(conf.GetEndpoint(), handler)
+	} else {
+		buntoOrgHandler := bunto.NewBuntoOrgHandler(context)
+		useDeliveryLog(buntoOrgHandler, deliveryLogDir, deliveryLogSize)
+		useQueue(buntoOrgHandler, queueDir, workers)
+		http.Handle("/_github/bunto", buntoOrgHandler)
+	}
 
 	log.Printf("Listening on :%s", port)
 	log.Fatal(http.ListenAndServe(":"+port, nil))
 }
+
+func useQueue(handler *hooks.GlobalHandler, dir string, workers int) {
+	if dir == "" {
+		return
+	}
+
+	q, err := queue.Open(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := handler.UseQueue(q, workers); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Queueing deliveries in %s with %d workers", dir, workers)
+}
+
+func useDeliveryLog(handler *hooks.GlobalHandler, dir string, size int) {
+	if dir == "" {
+		return
+	}
+
+	deliveryLog, err := deliverylog.Open(dir, size)
+	if err != nil {
+		log.Fatal(err)
+	}
+	handler.DeliveryLog = deliveryLog
+	log.Printf("Recording deliveries in %s", dir)
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"strings"
 
+	"github.com/buntobot/auto-reply/config"
 	"github.com/buntobot/auto-reply/ctx"
 	"github.com/buntobot/auto-reply/dependencies"
 )
@@ -21,8 +22,22 @@ func main() {
 	flag.StringVar(&reposString, "repos", defaultRepos, "Comma-separated list of repos to check, e.g. bunto/bunto,bunto/bunto-import")
 	var perform bool
 	flag.BoolVar(&perform, "f", false, "Whether to open issues (default: false, which is a dry-run)")
+	var configPath string
+	flag.StringVar(&configPath, "config", "", "A YAML or JSON configuration file. If -repos isn't given, its repos with the 'dependencies' handler are checked.")
 	flag.Parse()
 
+	if configPath != "" && !isFlagPassed("repos") {
+		conf, err := config.Load(configPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		repos := []string{}
+		for _, ref := range conf.ReposWithHandler("dependencies") {
+			repos = append(repos, ref.String())
+		}
+		reposString = strings.Join(repos, ",")
+	}
+
 	context := ctx.NewDefaultContext()
 
 	for _, repo := range strings.Split(reposString, ",") {
@@ -57,3 +72,13 @@ func main() {
 		}
 	}
 }
+
+func isFlagPassed(name string) bool {
+	passed := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			passed = true
+		}
+	})
+	return passed
+}
@@ -0,0 +1,61 @@
+// A command-line utility to follow up on the issues whose author was asked
+// which affinity team fits them, and hasn't answered.
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/buntobot/auto-reply/affinity"
+	"github.com/buntobot/auto-reply/config"
+	"github.com/buntobot/auto-reply/ctx"
+)
+
+func main() {
+	var actuallyDoIt bool
+	flag.BoolVar(&actuallyDoIt, "f", false, "Whether to actually remind the authors or assign captains.")
+	var configPath string
+	flag.StringVar(&configPath, "config", "", "A YAML or JSON configuration file. Its repos with the 'affinity' handler are processed, if their org sets affinity.follow_up_after.")
+	flag.Parse()
+
+	if configPath == "" {
+		log.Fatalln("-config is required")
+	}
+	conf, err := config.Load(configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	context := ctx.NewDefaultContext()
+	if context.GitHub == nil {
+		log.Fatalln("cannot proceed without github client")
+	}
+	if !actuallyDoIt {
+		context.EnableDryRun()
+	}
+
+	handlers := map[string]*affinity.Handler{}
+	for _, ref := range conf.ReposWithHandler("affinity") {
+		settings := ref.Org.Affinity
+		if settings == nil || settings.FollowUpAfter == 0 {
+			continue
+		}
+
+		handler, ok := handlers[ref.Owner()]
+		if !ok {
+			handler = &affinity.Handler{}
+			strategy, _ := affinity.ParseStrategy(settings.Strategy)
+			handler.SetStrategy(strategy)
+			for _, teamID := range settings.Teams {
+				if err := handler.AddTeam(context, teamID); err != nil {
+					log.Fatalf("%s: couldn't fetch affinity team %d: %v", ref.Owner(), teamID, err)
+				}
+			}
+			handlers[ref.Owner()] = handler
+		}
+
+		if err := handler.FollowUp(context, ref.Owner(), ref.Name(), settings.FollowUpAfter, settings.FallbackTeam); err != nil {
+			log.Printf("%s/%s: error: %v", ref.Owner(), ref.Name(), err)
+		}
+	}
+}
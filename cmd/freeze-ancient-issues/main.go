@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/google/go-github/github"
+	"github.com/buntobot/auto-reply/config"
 	"github.com/buntobot/auto-reply/ctx"
 	"github.com/buntobot/auto-reply/freeze"
 )
@@ -37,8 +38,6 @@ var (
 		repository{"bunto", "bunto-coffeescript"},
 		repository{"bunto", "plugins"},
 	}
-
-	sleepBetweenFreezes = 150 * time.Millisecond
 )
 
 func main() {
@@ -46,10 +45,20 @@ func main() {
 	flag.BoolVar(&actuallyDoIt, "f", false, "Whether to actually mark the issues or close them.")
 	var inputRepos string
 	flag.StringVar(&inputRepos, "repos", "", "Specify a list of comma-separated repo name/owner pairs, e.g. 'bunto/bunto-admin'.")
+	var configPath string
+	flag.StringVar(&configPath, "config", "", "A YAML or JSON configuration file. Its repos with the 'freeze' handler are processed.")
 	flag.Parse()
 
 	var repos []repository
-	if inputRepos == "" {
+	if inputRepos == "" && configPath != "" {
+		conf, err := config.Load(configPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, ref := range conf.ReposWithHandler("freeze") {
+			repos = append(repos, repository{ref.Owner(), ref.Name()})
+		}
+	} else if inputRepos == "" {
 		repos = defaultRepos
 	}
 
@@ -157,10 +166,8 @@ func processIssues(context *ctx.Context, actuallyDoIt bool, issues []github.Issu
 			if err := freeze.Freeze(context, owner, repo, *issue.Number); err != nil {
 				return err
 			}
-			time.Sleep(sleepBetweenFreezes)
 		} else {
 			log.Printf("%s/%s: would have frozen %s", owner, repo, *issue.HTMLURL)
-			time.Sleep(sleepBetweenFreezes)
 		}
 	}
 	return nil
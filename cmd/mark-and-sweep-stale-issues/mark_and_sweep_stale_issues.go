@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/google/go-github/github"
+	"github.com/buntobot/auto-reply/config"
 	"github.com/buntobot/auto-reply/ctx"
 	"github.com/buntobot/auto-reply/stale"
 	"golang.org/x/sync/errgroup"
@@ -86,18 +87,36 @@ func main() {
 	flag.BoolVar(&actuallyDoIt, "f", false, "Whether to actually mark the issues or close them.")
 	var inputRepos string
 	flag.StringVar(&inputRepos, "repos", "", "Specify a list of comma-separated repo name/owner pairs, e.g. 'bunto/bunto-admin'.")
+	var configPath string
+	flag.StringVar(&configPath, "config", "", "A YAML or JSON configuration file. Its repos with the 'stale' handler are processed with their stale parameters.")
 	flag.Parse()
 
 	if ctx.NewDefaultContext().GitHub == nil {
 		log.Fatalln("cannot proceed without github client")
 	}
 
+	configurations := map[repo]stale.Configuration{}
+	var configuredRepos []repo
+	if configPath != "" {
+		conf, err := config.Load(configPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, ref := range conf.ReposWithHandler("stale") {
+			r := repo{Owner: ref.Owner(), Name: ref.Name()}
+			configurations[r] = ref.Org.StaleConfiguration(ref.Repo, actuallyDoIt)
+			configuredRepos = append(configuredRepos, r)
+		}
+	}
+
 	var repos []repo
 	if inputRepos != "" {
 		for _, nwo := range strings.Split(inputRepos, ",") {
 			pieces := strings.Split(nwo, "/")
 			repos = append(repos, repo{Owner: pieces[0], Name: pieces[1]})
 		}
+	} else if configPath != "" {
+		repos = configuredRepos
 	} else {
 		repos = defaultRepos
 	}
@@ -105,16 +124,17 @@ func main() {
 	wg, _ := errgroup.WithContext(context.Background())
 	for _, repo := range repos {
 		repo := repo
+		configuration, ok := configurations[repo]
+		if !ok {
+			configuration = stale.Configuration{
+				Perform:             actuallyDoIt,
+				ExemptLabels:        nonStaleableLabels,
+				DormantDuration:     time.Since(twoMonthsAgo),
+				NotificationComment: staleIssueComment(repo.Owner, repo.Name),
+			}
+		}
 		wg.Go(func() error {
-			return stale.MarkAndCloseForRepo(
-				ctx.WithRepo(repo.Owner, repo.Name),
-				stale.Configuration{
-					Perform:             actuallyDoIt,
-					ExemptLabels:        nonStaleableLabels,
-					DormantDuration:     time.Since(twoMonthsAgo),
-					NotificationComment: staleIssueComment(repo.Owner, repo.Name),
-				},
-			)
+			return stale.MarkAndCloseForRepo(ctx.WithRepo(repo.Owner, repo.Name), configuration)
 		})
 	}
 	if err := wg.Wait(); err != nil {
@@ -0,0 +1,9 @@
+// +build heroku
+
+package main
+
+import "log"
+
+func init() {
+	log.SetFlags(0)
+}
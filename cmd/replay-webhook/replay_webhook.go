@@ -0,0 +1,100 @@
+// A command-line utility to re-feed recorded webhook deliveries into the
+// handlers, e.g. to debug a handler against the payload which tripped it up.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/buntobot/auto-reply/bunto"
+	"github.com/buntobot/auto-reply/config"
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/buntobot/auto-reply/deliverylog"
+	"github.com/buntobot/auto-reply/hooks"
+)
+
+func main() {
+	var configPath string
+	flag.StringVar(&configPath, "config", "", "A YAML or JSON configuration file (default: the Go configuration in package bunto)")
+	var dir string
+	flag.StringVar(&dir, "deliveries", "", "The directory buntobot was told to record deliveries to with -delivery-log")
+	var list bool
+	flag.BoolVar(&list, "list", false, "Only list the handlers which would fire")
+	var dryRun bool
+	flag.BoolVar(&dryRun, "dry-run", false, "Log the changes the handlers would make on GitHub instead of making them")
+	var all bool
+	flag.BoolVar(&all, "all", false, "Replay every recorded delivery, oldest first")
+	flag.Parse()
+
+	if dir == "" {
+		log.Fatal("-deliveries is required")
+	}
+	if !all && flag.NArg() == 0 {
+		log.Fatal("specify the IDs of the deliveries to replay, or -all")
+	}
+
+	deliveries, err := deliveriesToReplay(dir, all, flag.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	context := ctx.NewDefaultContext()
+	if dryRun {
+		context.EnableDryRun()
+	}
+	handler, err := newHandler(context, configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, delivery := range deliveries {
+		fmt.Printf("%s: %s delivery received at %s\n", delivery.ID, delivery.EventType, delivery.ReceivedAt)
+		if list {
+			for _, key := range handler.HandlerKeys(delivery.EventType, delivery.Payload) {
+				fmt.Printf("  would fire %s\n", key)
+			}
+			continue
+		}
+
+		for _, result := range handler.HandleDelivery(delivery.ID, delivery.EventType, delivery.Payload) {
+			fmt.Printf("  %s %s in %s", result.Handler, result.Outcome, result.Duration)
+			if result.Err != nil {
+				fmt.Printf(": %v", result.Err)
+			}
+			fmt.Println()
+		}
+	}
+}
+
+func deliveriesToReplay(dir string, all bool, ids []string) ([]*deliverylog.Delivery, error) {
+	deliveryLog, err := deliverylog.Open(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	if all {
+		return deliveryLog.List()
+	}
+
+	deliveries := []*deliverylog.Delivery{}
+	for _, id := range ids {
+		delivery, err := deliveryLog.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+func newHandler(context *ctx.Context, configPath string) (*hooks.GlobalHandler, error) {
+	if configPath == "" {
+		return bunto.NewBuntoOrgHandler(context), nil
+	}
+
+	conf, err := config.Load(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return conf.NewGlobalHandler(context)
+}
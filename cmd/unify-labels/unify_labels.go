@@ -7,37 +7,12 @@ import (
 	"strings"
 
 	"github.com/google/go-github/github"
+	"github.com/buntobot/auto-reply/config"
 	"github.com/buntobot/auto-reply/ctx"
-	"github.com/buntobot/auto-reply/freeze"
+	"github.com/buntobot/auto-reply/labeler"
 )
 
-var desiredLabels = []*github.Label{
-	{Name: github.String("accepted"), Color: github.String("4bc865")},
-	{Name: github.String("bug"), Color: github.String("d41313")},
-	{Name: github.String("discussion"), Color: github.String("006b75")},
-	{Name: github.String("documentation"), Color: github.String("006b75")},
-	{Name: github.String("enhancement"), Color: github.String("009800")},
-	{Name: github.String("feature"), Color: github.String("009800")},
-	{Name: github.String("fix"), Color: github.String("eb6420")},
-	{Name: github.String(freeze.LabelName), Color: github.String("0052cc")},
-	{Name: github.String("github"), Color: github.String("222222")},
-	{Name: github.String("has-pull-request"), Color: github.String("fbca04")},
-	{Name: github.String("help-wanted"), Color: github.String("fbca04")},
-	{Name: github.String("internal"), Color: github.String("ededed")},
-	{Name: github.String("pending-feedback"), Color: github.String("fbca04")},
-	{Name: github.String("pending-rebase"), Color: github.String("eb6420")},
-	{Name: github.String("pinned"), Color: github.String("f3f4d3")},
-	{Name: github.String("release"), Color: github.String("d4c5f9")},
-	{Name: github.String("security"), Color: github.String("e11d21")},
-	{Name: github.String("stale"), Color: github.String("bfd4f2")},
-	{Name: github.String("suggestion"), Color: github.String("0052cc")},
-	{Name: github.String("support"), Color: github.String("5319e7")},
-	{Name: github.String("tests"), Color: github.String("d4c5f9")},
-	{Name: github.String("undetermined"), Color: github.String("fe3868")},
-	{Name: github.String("ux"), Color: github.String("006b75")},
-	{Name: github.String("windows"), Color: github.String("fbca04")},
-	{Name: github.String("wont-fix"), Color: github.String("e11d21")},
-}
+var desiredLabels = labeler.CanonicalLabels
 var listOpts = github.ListOptions{PerPage: 100}
 
 func allPossibleNames(name string) []string {
@@ -114,19 +89,38 @@ func processRepo(context *ctx.Context, repo *github.Repository, perform bool) er
 func main() {
 	var perform bool
 	flag.BoolVar(&perform, "f", false, "Whether to modify the labels (if true) or show dry-run output (if false).")
+	var configPath string
+	flag.StringVar(&configPath, "config", "", "A YAML or JSON configuration file. Its label set is applied to every repo of its orgs.")
 	flag.Parse()
 
-	context := ctx.NewDefaultContext()
-	repos, _, err := context.GitHub.Repositories.List("bunto", &github.RepositoryListOptions{
-		Type: "owner", Sort: "full_name", Direction: "asc", ListOptions: listOpts,
-	})
-	if err != nil {
-		log.Fatalln("error fetching repos:", err)
+	orgs := []string{"bunto"}
+	if configPath != "" {
+		conf, err := config.Load(configPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(conf.Labels) > 0 {
+			desiredLabels = conf.GitHubLabels()
+		}
+		orgs = []string{}
+		for _, org := range conf.Orgs {
+			orgs = append(orgs, org.Name)
+		}
 	}
 
-	for _, repo := range repos {
-		if err := processRepo(context, repo, perform); err != nil {
-			context.Log("%s: failed!", *repo.FullName)
+	context := ctx.NewDefaultContext()
+	for _, org := range orgs {
+		repos, _, err := context.GitHub.Repositories.List(org, &github.RepositoryListOptions{
+			Type: "owner", Sort: "full_name", Direction: "asc", ListOptions: listOpts,
+		})
+		if err != nil {
+			log.Fatalln("error fetching repos:", err)
+		}
+
+		for _, repo := range repos {
+			if err := processRepo(context, repo, perform); err != nil {
+				context.Log("%s: failed!", *repo.FullName)
+			}
 		}
 	}
 }
@@ -0,0 +1,107 @@
+// codeowners requests reviews of pull requests from the owners of the files
+// they change, as listed by the CODEOWNERS file of their base branch.
+package codeowners
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/buntobot/auto-reply/common"
+)
+
+// Paths are where a CODEOWNERS file is looked for, in order.
+var Paths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// File is a parsed CODEOWNERS file.
+type File struct {
+	Rules []Rule
+}
+
+// Rule gives the files matching Pattern to Owners: "@login"s, "@org/team"s
+// or email addresses. A rule without owners leaves its files unowned.
+type Rule struct {
+	Pattern string
+	Owners  []string
+
+	matcher *regexp.Regexp
+}
+
+// Parse reads a CODEOWNERS file. Lines whose pattern can't be compiled are
+// left out.
+func Parse(data []byte) *File {
+	file := &File{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		matcher, err := patternRegexp(fields[0])
+		if err != nil {
+			continue
+		}
+		file.Rules = append(file.Rules, Rule{Pattern: fields[0], Owners: fields[1:], matcher: matcher})
+	}
+	return file
+}
+
+// OwnersOf returns the owners of the file at path: those of the last rule
+// which matches it.
+func (f *File) OwnersOf(path string) []string {
+	for i := len(f.Rules) - 1; i >= 0; i-- {
+		if f.Rules[i].matcher.MatchString(path) {
+			return f.Rules[i].Owners
+		}
+	}
+	return nil
+}
+
+// Owners returns the owners of any of the files at paths, each once.
+func (f *File) Owners(paths []string) []string {
+	owners := []string{}
+	seen := map[string]bool{}
+	for _, path := range paths {
+		for _, owner := range f.OwnersOf(path) {
+			if !seen[strings.ToLower(owner)] {
+				seen[strings.ToLower(owner)] = true
+				owners = append(owners, owner)
+			}
+		}
+	}
+	return owners
+}
+
+// Match returns true if the pattern, as written in a CODEOWNERS file,
+// matches the file at path. An invalid pattern matches nothing.
+func Match(pattern, path string) bool {
+	matcher, err := patternRegexp(pattern)
+	return err == nil && matcher.MatchString(path)
+}
+
+// patternRegexp compiles a CODEOWNERS pattern, which follows the rules of
+// .gitignore: a pattern with a slash, other than a trailing one, is
+// relative to the root of the repo and matches anywhere otherwise. A
+// pattern matching a directory matches everything in it, unless it ends
+// with a "*".
+func patternRegexp(pattern string) (*regexp.Regexp, error) {
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	expr := "^(?:.*/)?"
+	if anchored {
+		expr = "^"
+	}
+	expr += common.GlobExpr(pattern)
+	// Unlike .gitignore, "docs/*" doesn't match docs/build/index.md.
+	if !strings.HasSuffix(pattern, "*") && !strings.HasSuffix(pattern, "/") {
+		expr += "(?:/.*)?"
+	}
+	return regexp.Compile(expr + "$")
+}
@@ -0,0 +1,58 @@
+package codeowners
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var exampleFile = []byte(`# Everything, unless a later rule says otherwise.
+*                   @bunto/core
+
+*.js                @DirtyF   # front-end
+/docs/              @bunto/documentation
+apps/               @octocat
+/build/logs/        @doctocat docs@example.com
+docs/*.md           @mattr-
+lib/bunto/vendor/   # not owned
+`)
+
+func TestOwnersOf(t *testing.T) {
+	file := Parse(exampleFile)
+	assert.Len(t, file.Rules, 7)
+
+	examples := map[string][]string{
+		"lib/bunto.rb":                  {"@bunto/core"},
+		"assets/js/search.js":           {"@DirtyF"},
+		"docs/_docs/quickstart.html":    {"@bunto/documentation"},
+		"docs/index.md":                 {"@mattr-"},
+		"docs/_docs/index.md":           {"@bunto/documentation"},
+		"apps/index.rb":                 {"@octocat"},
+		"site/apps/index.rb":            {"@octocat"},
+		"build/logs/today.log":          {"@doctocat", "docs@example.com"},
+		"vendor/build/logs/today.log":   {"@bunto/core"},
+		"lib/bunto/vendor/safe_yaml.rb": {},
+	}
+	for path, owners := range examples {
+		assert.Equal(t, owners, file.OwnersOf(path), path)
+	}
+}
+
+func TestOwners(t *testing.T) {
+	file := Parse(exampleFile)
+	assert.Equal(t,
+		[]string{"@bunto/core", "@DirtyF", "@doctocat", "docs@example.com"},
+		file.Owners([]string{"Gemfile", "lib/bunto.rb", "site/search.js", "build/logs/a.log"}))
+}
+
+func TestReviewers(t *testing.T) {
+	users, teams := reviewers([]string{"@bunto/core", "@DirtyF", "@octocat", "docs@example.com", "@github/security"}, "bunto", "OctoCat")
+	assert.Equal(t, []string{"DirtyF"}, users)
+	assert.Equal(t, []string{"core"}, teams)
+}
+
+func TestMatch(t *testing.T) {
+	assert.True(t, Match("/docs/", "docs/_docs/index.md"))
+	assert.True(t, Match("*.gemspec", "bunto.gemspec"))
+	assert.False(t, Match("/lib/", "test/lib/helper.rb"))
+}
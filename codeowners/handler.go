@@ -0,0 +1,215 @@
+package codeowners
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/buntobot/auto-reply/common"
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/google/go-github/github"
+)
+
+// maxCachedFiles is the number of parsed files kept in memory.
+const maxCachedFiles = 500
+
+var cache = fileCache{files: map[string]*File{}}
+
+// fileCache maps "owner/name@sha" to the CODEOWNERS file of the repo at the
+// commit, or to nil if it had none. A commit's file never changes, so the
+// entries don't expire; the oldest are evicted beyond maxCachedFiles.
+type fileCache struct {
+	sync.Mutex // protects 'files' & 'keys'
+	files      map[string]*File
+	// keys holds the keys of files, oldest first.
+	keys []string
+}
+
+func (c *fileCache) get(key string) (*File, bool) {
+	c.Lock()
+	defer c.Unlock()
+	file, ok := c.files[key]
+	return file, ok
+}
+
+func (c *fileCache) set(key string, file *File) {
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := c.files[key]; !ok {
+		c.keys = append(c.keys, key)
+	}
+	c.files[key] = file
+	for len(c.keys) > maxCachedFiles {
+		delete(c.files, c.keys[0])
+		c.keys = c.keys[1:]
+	}
+}
+
+// RequestReviewersHandler requests reviews of newly opened pull requests
+// from the users & teams owning the files they change, other than their
+// author, per the CODEOWNERS file of their base branch.
+func RequestReviewersHandler(context *ctx.Context, payload interface{}) error {
+	event, ok := payload.(*github.PullRequestEvent)
+	if !ok {
+		return context.NewSkip("codeowners.RequestReviewersHandler: not a pull request event")
+	}
+	if *event.Action != "opened" && *event.Action != "reopened" {
+		return context.NewSkip("codeowners.RequestReviewersHandler: pull request was %s, not opened", *event.Action)
+	}
+
+	owner, repo, number := *event.Repo.Owner.Login, *event.Repo.Name, *event.Number
+	context.SetIssue(owner, repo, number)
+	author := ""
+	if event.PullRequest.User != nil && event.PullRequest.User.Login != nil {
+		author = *event.PullRequest.User.Login
+		context.SetAuthor(author)
+	}
+
+	file, err := FetchFile(context, owner, repo, *event.PullRequest.Base.SHA)
+	if err != nil {
+		context.IncrStat("codeowners.error.github_api")
+		return context.NewError("codeowners.RequestReviewersHandler: %v", err)
+	}
+	if file == nil {
+		return context.NewSkip("codeowners.RequestReviewersHandler: %s/%s has no CODEOWNERS file", owner, repo)
+	}
+
+	paths, err := common.ChangedFiles(context, owner, repo, number)
+	if err != nil {
+		context.IncrStat("codeowners.error.github_api")
+		return context.NewError("codeowners.RequestReviewersHandler: %v", err)
+	}
+
+	users, teams := reviewers(file.Owners(paths), owner, author)
+	if len(users) == 0 && len(teams) == 0 {
+		return context.NewSkip("codeowners.RequestReviewersHandler: no owners of the files of %s other than its author", context.Issue)
+	}
+
+	users, teams, err = requestReviewers(context, owner, repo, number, users, teams)
+	if err != nil {
+		context.IncrStat("codeowners.error.github_api")
+		return context.NewError("codeowners.RequestReviewersHandler: couldn't request reviews on %s: %v", context.Issue, err)
+	}
+	if len(users) == 0 && len(teams) == 0 {
+		return context.NewSkip("codeowners.RequestReviewersHandler: none of the owners of the files of %s may review it", context.Issue)
+	}
+	context.IncrStat("codeowners.requested")
+	context.Log("codeowners: requested reviews from %q and teams %q on %s", users, teams, context.Issue)
+	return nil
+}
+
+// reviewers splits the owners into the logins of users, other than author,
+// and the slugs of teams of org. Email addresses and the teams of other
+// orgs can't be requested and are left out.
+func reviewers(owners []string, org, author string) (users, teams []string) {
+	users, teams = []string{}, []string{}
+	for _, owner := range owners {
+		if !strings.HasPrefix(owner, "@") {
+			continue
+		}
+		name := strings.TrimPrefix(owner, "@")
+		if i := strings.Index(name, "/"); i >= 0 {
+			if strings.EqualFold(name[:i], org) {
+				teams = append(teams, name[i+1:])
+			}
+		} else if !strings.EqualFold(name, author) {
+			users = append(users, name)
+		}
+	}
+	return users, teams
+}
+
+// FetchFile returns the CODEOWNERS file of owner/repo at the commit sha, or
+// nil if there's none.
+func FetchFile(context *ctx.Context, owner, repo, sha string) (*File, error) {
+	key := fmt.Sprintf("%s/%s@%s", owner, repo, sha)
+	if file, ok := cache.get(key); ok {
+		return file, nil
+	}
+
+	var file *File
+	for _, path := range Paths {
+		contents, _, resp, err := context.GitHub.Repositories.GetContents(owner, repo, path, &github.RepositoryContentGetOptions{Ref: sha})
+		if err != nil {
+			if resp != nil && resp.StatusCode == http.StatusNotFound {
+				continue
+			}
+			return nil, ctx.Errorf("couldn't fetch %s from %s/%s: %v", path, owner, repo, err)
+		}
+		if contents == nil || contents.Content == nil {
+			// path is a directory.
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(strings.Replace(*contents.Content, "\n", "", -1))
+		if err != nil {
+			return nil, ctx.Errorf("couldn't decode %s of %s/%s: %v", path, owner, repo, err)
+		}
+		file = Parse(data)
+		break
+	}
+	cache.set(key, file)
+	return file, nil
+}
+
+// requestReviewers requests reviews on the pull request from the users &
+// teams, and returns those it requested them from. GitHub turns down the
+// whole request if any of them can't review, e.g. a login of the CODEOWNERS
+// file who isn't a collaborator, so they're then requested one by one.
+func requestReviewers(context *ctx.Context, owner, repo string, number int, users, teams []string) ([]string, []string, error) {
+	err := postReviewRequest(context, owner, repo, number, users, teams)
+	if err == nil {
+		return users, teams, nil
+	}
+	if !isUnprocessable(err) {
+		return nil, nil, err
+	}
+
+	requestedUsers, requestedTeams := []string{}, []string{}
+	for _, user := range users {
+		err := postReviewRequest(context, owner, repo, number, []string{user}, nil)
+		if isUnprocessable(err) {
+			context.Log("codeowners: couldn't request a review from @%s on %s/%s#%d: %v", user, owner, repo, number, err)
+			continue
+		}
+		if err != nil {
+			return requestedUsers, requestedTeams, err
+		}
+		requestedUsers = append(requestedUsers, user)
+	}
+	for _, team := range teams {
+		err := postReviewRequest(context, owner, repo, number, nil, []string{team})
+		if isUnprocessable(err) {
+			context.Log("codeowners: couldn't request a review from @%s/%s on %s/%s#%d: %v", owner, team, owner, repo, number, err)
+			continue
+		}
+		if err != nil {
+			return requestedUsers, requestedTeams, err
+		}
+		requestedTeams = append(requestedTeams, team)
+	}
+	return requestedUsers, requestedTeams, nil
+}
+
+func postReviewRequest(context *ctx.Context, owner, repo string, number int, users, teams []string) error {
+	// go-github doesn't know about this endpoint yet.
+	body := struct {
+		Reviewers     []string `json:"reviewers,omitempty"`
+		TeamReviewers []string `json:"team_reviewers,omitempty"`
+	}{users, teams}
+	req, err := context.GitHub.NewRequest("POST",
+		fmt.Sprintf("repos/%s/%s/pulls/%d/requested_reviewers", owner, repo, number), body)
+	if err != nil {
+		return err
+	}
+	_, err = context.GitHub.Do(req, nil)
+	return err
+}
+
+// isUnprocessable returns true if GitHub turned the request down with a 422,
+// as it does for reviewers who aren't collaborators.
+func isUnprocessable(err error) bool {
+	errResp, ok := err.(*github.ErrorResponse)
+	return ok && errResp.Response != nil && errResp.Response.StatusCode == http.StatusUnprocessableEntity
+}
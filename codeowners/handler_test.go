@@ -0,0 +1,103 @@
+package codeowners
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/buntobot/auto-reply/internal/githubtest"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPullRequestEvent(number int, sha string) *github.PullRequestEvent {
+	return &github.PullRequestEvent{
+		Action: github.String("opened"),
+		Number: github.Int(number),
+		PullRequest: &github.PullRequest{
+			User: &github.User{Login: github.String("octocat")},
+			Base: &github.PullRequestBranch{SHA: github.String(sha)},
+		},
+		Repo: &github.Repository{
+			Owner: &github.User{Login: github.String("bunto")},
+			Name:  github.String("bunto-feed"),
+		},
+	}
+}
+
+func TestRequestReviewersHandler(t *testing.T) {
+	mux, context, teardown := githubtest.Setup()
+	defer teardown()
+
+	fetches := map[string]int{}
+	mux.HandleFunc("/repos/bunto/bunto-feed/contents/", func(w http.ResponseWriter, r *http.Request) {
+		fetches[r.URL.Path]++
+		assert.Equal(t, "abc123", r.URL.Query().Get("ref"))
+		if r.URL.Path != "/repos/bunto/bunto-feed/contents/CODEOWNERS" {
+			http.NotFound(w, r)
+			return
+		}
+		content := base64.StdEncoding.EncodeToString([]byte("* @bunto/core\n*.rb @octocat @DirtyF\n"))
+		fmt.Fprintf(w, `{"type": "file", "encoding": "base64", "content": %q}`, content)
+	})
+	mux.HandleFunc("/repos/bunto/bunto-feed/pulls/7/files", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"filename": "lib/bunto-feed.rb"}, {"filename": "README.md"}]`)
+	})
+	requested := map[string][]string{}
+	mux.HandleFunc("/repos/bunto/bunto-feed/pulls/7/requested_reviewers", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		json.NewDecoder(r.Body).Decode(&requested)
+		fmt.Fprint(w, `{"number": 7}`)
+	})
+
+	assert.NoError(t, RequestReviewersHandler(context, newPullRequestEvent(7, "abc123")))
+	assert.Equal(t, map[string][]string{"reviewers": {"DirtyF"}, "team_reviewers": {"core"}}, requested)
+
+	// The parsed file is cached for the commit.
+	assert.NoError(t, RequestReviewersHandler(context, newPullRequestEvent(7, "abc123")))
+	assert.Equal(t, map[string]int{
+		"/repos/bunto/bunto-feed/contents/.github/CODEOWNERS": 1,
+		"/repos/bunto/bunto-feed/contents/CODEOWNERS":         1,
+	}, fetches)
+
+	event := newPullRequestEvent(7, "abc123")
+	event.Action = github.String("closed")
+	assert.Error(t, RequestReviewersHandler(context, event))
+}
+
+func TestRequestReviewersHandlerSkipsOwnersWhoCantReview(t *testing.T) {
+	mux, context, teardown := githubtest.Setup()
+	defer teardown()
+
+	mux.HandleFunc("/repos/bunto/bunto-feed/contents/.github/CODEOWNERS", func(w http.ResponseWriter, r *http.Request) {
+		content := base64.StdEncoding.EncodeToString([]byte("* @bunto/core @DirtyF @former-maintainer\n"))
+		fmt.Fprintf(w, `{"type": "file", "encoding": "base64", "content": %q}`, content)
+	})
+	mux.HandleFunc("/repos/bunto/bunto-feed/pulls/8/files", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"filename": "README.md"}]`)
+	})
+	requests := 0
+	requested := map[string][]string{}
+	mux.HandleFunc("/repos/bunto/bunto-feed/pulls/8/requested_reviewers", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body := map[string][]string{}
+		json.NewDecoder(r.Body).Decode(&body)
+		for _, reviewer := range body["reviewers"] {
+			if reviewer == "former-maintainer" {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				fmt.Fprint(w, `{"message": "Reviews may only be requested from collaborators."}`)
+				return
+			}
+		}
+		for key, values := range body {
+			requested[key] = append(requested[key], values...)
+		}
+		fmt.Fprint(w, `{"number": 8}`)
+	})
+
+	assert.NoError(t, RequestReviewersHandler(context, newPullRequestEvent(8, "def456")))
+	assert.Equal(t, 4, requests)
+	assert.Equal(t, map[string][]string{"reviewers": {"DirtyF"}, "team_reviewers": {"core"}}, requested)
+}
@@ -0,0 +1,199 @@
+// commands routes the commands left in issue & pull request comments, as
+// either "@buntobot: <command> [args]" or "/<command> [args]" lines, to the
+// handlers registered for them. The mention may follow other text, e.g.
+// "Thanks! @buntobot: merge". It checks their arguments and whether the
+// commenter may run them, per the repo's auth.Policy, and answers unknown
+// commands addressed to the bot with the list of known ones.
+package commands
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/buntobot/auto-reply/auth"
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/google/go-github/github"
+)
+
+var (
+	slashCommandRegexp   = regexp.MustCompile(`^/([a-zA-Z][a-zA-Z0-9_-]*)(?:\s+(.*))?$`)
+	mentionCommandRegexp = regexp.MustCompile(`(?:^|\s)@([a-zA-Z0-9_\-\[\]]+):\s*(\S+)(?:\s+(.*))?$`)
+)
+
+// Handler runs a command.
+type Handler func(context *ctx.Context, invocation *Invocation) error
+
+// Command is something users may ask of the bot in a comment.
+type Command struct {
+	// Name is what the command is run as, e.g. "merge" for "/merge". It is
+	// also the name of the command in the repo's auth.Policy.
+	Name string
+	// Aliases may be used instead of the name, e.g. ":shipit:".
+	Aliases []string
+	// Summary tells users what the command does, in the help reply.
+	Summary string
+	// Args are the arguments the command takes, in order.
+	Args []Arg
+
+	// Roles may run the command, unless the repo's policy says otherwise.
+	// If nil, auth.DefaultPolicy applies.
+	Roles []auth.Role
+	// PullRequestOnly commands can't be run on issues.
+	PullRequestOnly bool
+	// Pattern, if set, also runs the command, without arguments, when the
+	// whole comment matches it, e.g. a plain "LGTM".
+	Pattern *regexp.Regexp
+	// Enabled returns true if the command may be run on the repo. If nil,
+	// it may be run everywhere.
+	Enabled func(owner, repo string) bool
+
+	Handler Handler
+}
+
+// Arg is an argument of a command.
+type Arg struct {
+	Name string
+	// Optional arguments may be left out. Only the last ones may be.
+	Optional bool
+	// Rest takes the rest of the line, spaces and all. Only the last
+	// argument may.
+	Rest bool
+	// Pattern, if set, must match the argument.
+	Pattern *regexp.Regexp
+}
+
+// Usage returns how to run the command, e.g. "/merge [+category...]".
+func (c *Command) Usage() string {
+	usage := "/" + c.Name
+	for _, arg := range c.Args {
+		name := arg.Name
+		if arg.Rest {
+			name += "..."
+		}
+		if arg.Optional {
+			usage += " [" + name + "]"
+		} else {
+			usage += " <" + name + ">"
+		}
+	}
+	return usage
+}
+
+func (c *Command) isEnabledFor(owner, repo string) bool {
+	return c.Enabled == nil || c.Enabled(owner, repo)
+}
+
+func (c *Command) isCalled(name string) bool {
+	if strings.EqualFold(c.Name, name) {
+		return true
+	}
+	for _, alias := range c.Aliases {
+		if strings.EqualFold(alias, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseArgs matches the words of a command line to the arguments of the
+// command, by name.
+func (c *Command) parseArgs(line string) (map[string]string, error) {
+	words := strings.Fields(line)
+	values := map[string]string{}
+	for i, arg := range c.Args {
+		if i >= len(words) {
+			if !arg.Optional {
+				return nil, fmt.Errorf("missing %s", arg.Name)
+			}
+			break
+		}
+		value := words[i]
+		if arg.Rest {
+			value = strings.Join(words[i:], " ")
+			words = words[:i+1]
+		}
+		if arg.Pattern != nil && !arg.Pattern.MatchString(value) {
+			return nil, fmt.Errorf("%q isn't a valid %s", value, arg.Name)
+		}
+		values[arg.Name] = value
+	}
+	if len(words) > len(c.Args) {
+		return nil, fmt.Errorf("unexpected %q", strings.Join(words[len(c.Args):], " "))
+	}
+	return values, nil
+}
+
+// Invocation is a command as run by a comment.
+type Invocation struct {
+	Command *Command
+	// Name is what the command was called, e.g. ":shipit:".
+	Name string
+	// Matched is true if the comment only matched the command's Pattern,
+	// rather than addressing the command to the bot.
+	Matched bool
+
+	Owner       string
+	Repo        string
+	Number      int
+	PullRequest bool
+	// Login is who ran the command; Author opened the issue or pull request.
+	Login  string
+	Author string
+
+	// Body is the whole comment, and Event the *github.IssueCommentEvent or
+	// *github.PullRequestReviewCommentEvent which carried it.
+	Body  string
+	Event interface{}
+
+	args map[string]string
+}
+
+// Arg returns the value of the named argument, or "" if it was left out.
+func (i *Invocation) Arg(name string) string {
+	return i.args[name]
+}
+
+// Reply leaves a comment addressed to whoever ran the command.
+func (i *Invocation) Reply(context *ctx.Context, message string) error {
+	body := fmt.Sprintf("@%s %s", i.Login, message)
+	_, _, err := context.GitHub.Issues.CreateComment(i.Owner, i.Repo, i.Number, &github.IssueComment{Body: github.String(body)})
+	return err
+}
+
+func (i *Invocation) String() string {
+	return fmt.Sprintf("%s by @%s on %s/%s#%d", i.Command.Name, i.Login, i.Owner, i.Repo, i.Number)
+}
+
+// line is a command line of a comment.
+type line struct {
+	// mention is who the line was addressed to, or "" for a slash command.
+	mention string
+	name    string
+	args    string
+}
+
+// parseLines returns the command lines of the comment, leaving out those in
+// code blocks & quotes.
+func parseLines(body string) []line {
+	lines := []line{}
+	inCode := false
+	for _, text := range strings.Split(body, "\n") {
+		text = strings.TrimSpace(text)
+		if strings.HasPrefix(text, "```") || strings.HasPrefix(text, "~~~") {
+			inCode = !inCode
+			continue
+		}
+		if inCode || strings.HasPrefix(text, ">") {
+			continue
+		}
+
+		if matches := slashCommandRegexp.FindStringSubmatch(text); matches != nil {
+			lines = append(lines, line{name: matches[1], args: matches[2]})
+		} else if matches := mentionCommandRegexp.FindStringSubmatch(text); matches != nil {
+			// Allow for "@buntobot: LGTM!".
+			lines = append(lines, line{mention: matches[1], name: strings.TrimRight(matches[2], ".!,"), args: matches[3]})
+		}
+	}
+	return lines
+}
@@ -0,0 +1,251 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/buntobot/auto-reply/auth"
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func setup() (*http.ServeMux, *ctx.Context, func()) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	client := github.NewClient(nil)
+	url, _ := url.Parse(server.URL)
+	client.BaseURL = url
+	client.UploadURL = url
+
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"login": "buntobot"}`)
+	})
+	mux.HandleFunc("/repos/bunto/bunto/collaborators/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/parkr/") {
+			fmt.Fprint(w, `{"permission": "write", "role_name": "write"}`)
+			return
+		}
+		http.NotFound(w, r)
+	})
+
+	return mux, &ctx.Context{GitHub: client}, server.Close
+}
+
+// serveReplies records the comments left on bunto/bunto#1.
+func serveReplies(mux *http.ServeMux) *[]string {
+	replies := []string{}
+	mux.HandleFunc("/repos/bunto/bunto/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		comment := &github.IssueComment{}
+		json.NewDecoder(r.Body).Decode(comment)
+		replies = append(replies, *comment.Body)
+		json.NewEncoder(w).Encode(comment)
+	})
+	return &replies
+}
+
+func newCommentEvent(login, body string) *github.IssueCommentEvent {
+	return &github.IssueCommentEvent{
+		Action: github.String("created"),
+		Issue: &github.Issue{
+			Number:           github.Int(1),
+			User:             &github.User{Login: github.String("octocat")},
+			PullRequestLinks: &github.PullRequestLinks{},
+		},
+		Comment: &github.IssueComment{
+			User: &github.User{Login: github.String(login)},
+			Body: github.String(body),
+		},
+		Repo: &github.Repository{
+			Owner: &github.User{Login: github.String("bunto")},
+			Name:  github.String("bunto"),
+		},
+	}
+}
+
+func TestParseLines(t *testing.T) {
+	body := "Thanks!\n/label bug  docs\n@buntobot: merge +Bug Fix\n> /quoted\n```\n/in-code\n```\n/usr/bin/env is a path\n@buntobot: LGTM!\nThanks! @buntobot: merge\nfoo@buntobot: merge"
+	assert.Equal(t, []line{
+		{name: "label", args: "bug  docs"},
+		{mention: "buntobot", name: "merge", args: "+Bug Fix"},
+		{mention: "buntobot", name: "LGTM"},
+		{mention: "buntobot", name: "merge"},
+	}, parseLines(body))
+}
+
+func TestParseArgs(t *testing.T) {
+	command := &Command{
+		Name: "label",
+		Args: []Arg{
+			{Name: "label", Pattern: regexp.MustCompile(`^[a-z]+$`)},
+			{Name: "reason", Optional: true, Rest: true},
+		},
+	}
+	assert.Equal(t, "/label <label> [reason...]", command.Usage())
+
+	args, err := command.parseArgs("bug because it is")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"label": "bug", "reason": "because it is"}, args)
+
+	args, err = command.parseArgs("bug")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"label": "bug"}, args)
+
+	_, err = command.parseArgs("")
+	assert.Error(t, err)
+	_, err = command.parseArgs("Bug")
+	assert.Error(t, err)
+
+	command.Args = command.Args[:1]
+	_, err = command.parseArgs("bug docs")
+	assert.Error(t, err)
+}
+
+func TestRouterRunsCommands(t *testing.T) {
+	mux, context, teardown := setup()
+	defer teardown()
+	replies := serveReplies(mux)
+
+	var invocations []*Invocation
+	record := func(context *ctx.Context, invocation *Invocation) error {
+		invocations = append(invocations, invocation)
+		return nil
+	}
+	router := &Router{}
+	router.Register(Command{
+		Name:    "merge",
+		Aliases: []string{":shipit:"},
+		Args:    []Arg{{Name: "+category", Optional: true, Rest: true}},
+		Handler: record,
+	})
+	router.Register(Command{Name: "lgtm", Pattern: regexp.MustCompile(`(?i)\ALGTM\z`), Handler: record})
+	router.Register(Command{Name: "thanks", Roles: []auth.Role{auth.AnyoneRole}, Handler: record})
+
+	assert.NoError(t, router.IssueCommentHandler(context, newCommentEvent("parkr", "@buntobot: :shipit: +Bug Fix")))
+	if assert.Len(t, invocations, 1) {
+		assert.Equal(t, "merge", invocations[0].Command.Name)
+		assert.Equal(t, ":shipit:", invocations[0].Name)
+		assert.Equal(t, "+Bug Fix", invocations[0].Arg("+category"))
+		assert.Equal(t, "octocat", invocations[0].Author)
+	}
+
+	assert.NoError(t, router.IssueCommentHandler(context, newCommentEvent("parkr", "LGTM")))
+	if assert.Len(t, invocations, 2) {
+		assert.Equal(t, "lgtm", invocations[1].Command.Name)
+	}
+
+	// Addressed to someone else.
+	assert.Error(t, router.IssueCommentHandler(context, newCommentEvent("parkr", "@mattr-: merge")))
+	assert.Len(t, invocations, 2)
+	assert.Empty(t, *replies)
+
+	// The command's roles apply unless the repo's policy says otherwise.
+	assert.NoError(t, router.IssueCommentHandler(context, newCommentEvent("someone", "/thanks")))
+	assert.Len(t, invocations, 3)
+
+	// Denied by the default policy.
+	assert.Error(t, router.IssueCommentHandler(context, newCommentEvent("someone", "/merge")))
+	assert.Len(t, invocations, 3)
+	if assert.Len(t, *replies, 1) {
+		assert.Contains(t, (*replies)[0], "not allowed")
+	}
+}
+
+func TestRouterIgnoresPatternMatchesItDenies(t *testing.T) {
+	mux, context, teardown := setup()
+	defer teardown()
+	replies := serveReplies(mux)
+
+	var invocations []*Invocation
+	router := &Router{}
+	router.Register(Command{
+		Name:    "lgtm",
+		Pattern: regexp.MustCompile(`(?i)\ALGTM!?\z`),
+		Handler: func(context *ctx.Context, invocation *Invocation) error {
+			invocations = append(invocations, invocation)
+			return nil
+		},
+	})
+
+	assert.Error(t, router.IssueCommentHandler(context, newCommentEvent("someone", "LGTM!")))
+	assert.Empty(t, invocations)
+	assert.Empty(t, *replies)
+
+	// Addressed to the bot, the denial is answered.
+	assert.Error(t, router.IssueCommentHandler(context, newCommentEvent("someone", "/lgtm")))
+	assert.Empty(t, invocations)
+	if assert.Len(t, *replies, 1) {
+		assert.Contains(t, (*replies)[0], "not allowed")
+	}
+}
+
+func TestRouterRepliesWithHelp(t *testing.T) {
+	mux, context, teardown := setup()
+	defer teardown()
+	replies := serveReplies(mux)
+
+	router := &Router{}
+	router.Register(Command{
+		Name:    "merge",
+		Summary: "merges the pull request.",
+		Args:    []Arg{{Name: "+category", Optional: true, Pattern: regexp.MustCompile(`^\+`)}},
+		Handler: func(*ctx.Context, *Invocation) error { return nil },
+	})
+	router.Register(Command{
+		Name:    "hidden",
+		Enabled: func(owner, repo string) bool { return false },
+		Handler: func(*ctx.Context, *Invocation) error { return nil },
+	})
+
+	// Unknown slash commands may not be meant for the bot.
+	assert.Error(t, router.IssueCommentHandler(context, newCommentEvent("parkr", "/cc @DirtyF")))
+	assert.Empty(t, *replies)
+
+	assert.Error(t, router.IssueCommentHandler(context, newCommentEvent("parkr", "@buntobot: hidden")))
+	assert.Error(t, router.IssueCommentHandler(context, newCommentEvent("parkr", "/merge bug")))
+	if assert.Len(t, *replies, 2) {
+		assert.Contains(t, (*replies)[0], "I don't know the command `hidden`")
+		assert.Contains(t, (*replies)[0], "- `/merge [+category]` – merges the pull request.")
+		assert.NotContains(t, (*replies)[0], "/hidden`")
+		assert.Contains(t, (*replies)[1], "Usage: `/merge [+category]`")
+	}
+}
+
+func TestRouterPicksTheCommandEnabledForTheRepo(t *testing.T) {
+	router := &Router{}
+	for _, org := range []string{"bunto", "buntobot"} {
+		org := org
+		router.Register(Command{
+			Name:    "reassign",
+			Summary: org,
+			Enabled: func(owner, repo string) bool { return owner == org },
+			Handler: func(*ctx.Context, *Invocation) error { return nil },
+		})
+	}
+
+	enabled := router.Commands("buntobot", "auto-reply")
+	if assert.Len(t, enabled, 1) {
+		assert.Equal(t, "buntobot", enabled[0].Summary)
+	}
+	assert.Empty(t, router.Commands("mattr-", "bunto"))
+}
+
+func TestContainsCommand(t *testing.T) {
+	_, context, teardown := setup()
+	defer teardown()
+
+	router := &Router{}
+	router.Register(Command{Name: "unassign", Handler: func(*ctx.Context, *Invocation) error { return nil }})
+
+	assert.True(t, router.ContainsCommand(context, "bunto", "bunto", "@buntobot: assign @bunto/documentation"))
+	assert.True(t, router.ContainsCommand(context, "bunto", "bunto", "/unassign me"))
+	assert.False(t, router.ContainsCommand(context, "bunto", "bunto", "/cc @bunto/documentation"))
+	assert.False(t, router.ContainsCommand(context, "bunto", "bunto", "@parkr: maybe @bunto/documentation?"))
+	assert.False(t, router.ContainsCommand(context, "bunto", "bunto", "cc @bunto/documentation"))
+}
@@ -0,0 +1,273 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/buntobot/auto-reply/auth"
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/buntobot/auto-reply/repoconfig"
+	"github.com/google/go-github/github"
+)
+
+// Router runs the commands of the comments it is given, with its
+// IssueCommentHandler & PullRequestReviewCommentHandler.
+type Router struct {
+	sync.Mutex // protects commands
+	commands   []*Command
+}
+
+// Register adds the command to the router. Commands may share a name as
+// long as they are enabled for different repos, e.g. one per org; where
+// several are, the first registered runs.
+func (r *Router) Register(command Command) {
+	r.Lock()
+	defer r.Unlock()
+	r.commands = append(r.commands, &command)
+}
+
+// Commands returns the commands which may be run on owner/repo, by name.
+func (r *Router) Commands(owner, repo string) []*Command {
+	r.Lock()
+	defer r.Unlock()
+
+	enabled := []*Command{}
+	seen := map[string]bool{}
+	for _, command := range r.commands {
+		if !seen[command.Name] && command.isEnabledFor(owner, repo) {
+			seen[command.Name] = true
+			enabled = append(enabled, command)
+		}
+	}
+	sort.Sort(byName(enabled))
+	return enabled
+}
+
+// ContainsCommand returns true if the comment runs one of the commands
+// enabled for owner/repo, or addresses any command to the bot, so handlers
+// reading comments for other things can leave it to the router. A line like
+// "/cc @bunto/documentation" isn't a command.
+func (r *Router) ContainsCommand(context *ctx.Context, owner, repo, body string) bool {
+	enabled := r.Commands(owner, repo)
+	for _, line := range parseLines(body) {
+		if line.mention != "" {
+			if isAddressedToMe(context, line.mention) {
+				return true
+			}
+			continue
+		}
+		if findCommand(enabled, line.name) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+type byName []*Command
+
+func (c byName) Len() int           { return len(c) }
+func (c byName) Less(i, j int) bool { return c[i].Name < c[j].Name }
+func (c byName) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+
+// Policy returns who may run which command on owner/repo: the roles the
+// commands were registered with, then the repo's own policy.
+func (r *Router) Policy(context *ctx.Context, owner, repo string) auth.Policy {
+	r.Lock()
+	registered := auth.Policy{}
+	for _, command := range r.commands {
+		if command.Roles != nil {
+			registered[command.Name] = command.Roles
+		}
+	}
+	r.Unlock()
+
+	return repoconfig.Get(context, owner, repo).PolicyOver(auth.DefaultPolicy.Merge(registered))
+}
+
+func (r *Router) IssueCommentHandler(context *ctx.Context, payload interface{}) error {
+	event, ok := payload.(*github.IssueCommentEvent)
+	if !ok {
+		return context.NewSkip("commands.IssueCommentHandler: not an issue comment event")
+	}
+	if *event.Action != "created" {
+		return context.NewSkip("commands.IssueCommentHandler: comment was %s, not created", *event.Action)
+	}
+
+	return r.run(context, &Invocation{
+		Owner:       *event.Repo.Owner.Login,
+		Repo:        *event.Repo.Name,
+		Number:      *event.Issue.Number,
+		PullRequest: event.Issue.PullRequestLinks != nil,
+		Login:       *event.Comment.User.Login,
+		Author:      loginOf(event.Issue.User),
+		Body:        *event.Comment.Body,
+		Event:       event,
+	})
+}
+
+func (r *Router) PullRequestReviewCommentHandler(context *ctx.Context, payload interface{}) error {
+	event, ok := payload.(*github.PullRequestReviewCommentEvent)
+	if !ok {
+		return context.NewSkip("commands.PullRequestReviewCommentHandler: not a pull request review comment event")
+	}
+	if *event.Action != "created" {
+		return context.NewSkip("commands.PullRequestReviewCommentHandler: comment was %s, not created", *event.Action)
+	}
+
+	return r.run(context, &Invocation{
+		Owner:       *event.Repo.Owner.Login,
+		Repo:        *event.Repo.Name,
+		Number:      *event.PullRequest.Number,
+		PullRequest: true,
+		Login:       *event.Comment.User.Login,
+		Author:      loginOf(event.PullRequest.User),
+		Body:        *event.Comment.Body,
+		Event:       event,
+	})
+}
+
+// run runs every command of the comment described by comment, which has no
+// Command yet.
+func (r *Router) run(context *ctx.Context, comment *Invocation) error {
+	enabled := r.Commands(comment.Owner, comment.Repo)
+	if len(enabled) == 0 {
+		return context.NewSkip("commands: none enabled for %s/%s", comment.Owner, comment.Repo)
+	}
+	if context.GitHubAuthedAs(comment.Login) {
+		return context.NewSkip("commands: ignoring my own comment on %s/%s#%d", comment.Owner, comment.Repo, comment.Number)
+	}
+
+	var invocations []*Invocation
+	addressed := 0
+	for _, line := range parseLines(comment.Body) {
+		if line.mention != "" && !isAddressedToMe(context, line.mention) {
+			continue
+		}
+
+		command := findCommand(enabled, line.name)
+		if command == nil {
+			context.CountStatWithTags("commands.unknown", 1, []string{"repo:" + comment.Owner + "/" + comment.Repo})
+			// A line like "/cc @parkr" isn't necessarily meant for the bot,
+			// but one addressed to it is.
+			if line.mention != "" {
+				addressed++
+				r.reply(context, comment, fmt.Sprintf("I don't know the command `%s`.\n\n%s", line.name, help(enabled)))
+			}
+			continue
+		}
+		addressed++
+		if command.PullRequestOnly && !comment.PullRequest {
+			r.reply(context, comment, fmt.Sprintf("`%s` only works on pull requests.", command.Name))
+			continue
+		}
+		args, err := command.parseArgs(line.args)
+		if err != nil {
+			r.reply(context, comment, fmt.Sprintf("I couldn't run `%s`: %v. Usage: `%s`", command.Name, err, command.Usage()))
+			continue
+		}
+		invocations = append(invocations, comment.with(command, line.name, args))
+	}
+
+	// A comment without command lines may still match a command's pattern.
+	if addressed == 0 {
+		for _, command := range enabled {
+			if command.Pattern != nil && command.Pattern.MatchString(comment.Body) &&
+				(comment.PullRequest || !command.PullRequestOnly) {
+				invocation := comment.with(command, command.Name, map[string]string{})
+				invocation.Matched = true
+				invocations = append(invocations, invocation)
+			}
+		}
+	}
+
+	if len(invocations) == 0 {
+		return context.NewSkip("commands: no command in the comment on %s/%s#%d", comment.Owner, comment.Repo, comment.Number)
+	}
+
+	policy := r.Policy(context, comment.Owner, comment.Repo)
+	var firstErr error
+	for _, invocation := range invocations {
+		context.CountStatWithTags("commands.invoked", 1, []string{"command:" + invocation.Command.Name})
+		command := auth.Command{
+			Name:   invocation.Command.Name,
+			Owner:  invocation.Owner,
+			Repo:   invocation.Repo,
+			Number: invocation.Number,
+			Login:  invocation.Login,
+			Author: invocation.Author,
+		}
+		var err error
+		if invocation.Matched {
+			// A drive-by "LGTM" wasn't meant for the bot, so it isn't
+			// answered with a denial.
+			if !policy.Allowed(context, command) {
+				err = context.NewSkip("commands: %s isn't allowed, ignoring the comment", command)
+			}
+		} else {
+			err = auth.Authorize(context, policy, command)
+		}
+		if err == nil {
+			err = invocation.Command.Handler(context, invocation)
+		}
+		if err != nil && (firstErr == nil || ctx.IsSkip(firstErr) && !ctx.IsSkip(err)) {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// with returns the invocation of the command by the comment.
+func (i *Invocation) with(command *Command, name string, args map[string]string) *Invocation {
+	invocation := *i
+	invocation.Command = command
+	invocation.Name = name
+	invocation.args = args
+	return &invocation
+}
+
+func (r *Router) reply(context *ctx.Context, comment *Invocation, message string) {
+	if err := comment.Reply(context, message); err != nil {
+		context.Log("ERROR replying to the commands on %s/%s#%d: %v", comment.Owner, comment.Repo, comment.Number, err)
+	}
+}
+
+// help lists the commands and what they do.
+func help(commands []*Command) string {
+	lines := []string{"Here's what I can do:", ""}
+	for _, command := range commands {
+		line := fmt.Sprintf("- `%s`", command.Usage())
+		if len(command.Aliases) > 0 {
+			line += fmt.Sprintf(" (or `%s`)", strings.Join(command.Aliases, "`, `"))
+		}
+		if command.Summary != "" {
+			line += " – " + command.Summary
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func findCommand(commands []*Command, name string) *Command {
+	for _, command := range commands {
+		if command.isCalled(name) {
+			return command
+		}
+	}
+	return nil
+}
+
+// isAddressedToMe returns true if mention is the login of the bot, or of
+// the bot user of its GitHub App.
+func isAddressedToMe(context *ctx.Context, mention string) bool {
+	return context.GitHubAuthedAs(mention) || context.GitHubAuthedAs(mention+"[bot]")
+}
+
+// loginOf returns the user's login, or "" if the payload left them out.
+func loginOf(user *github.User) string {
+	if user == nil || user.Login == nil {
+		return ""
+	}
+	return *user.Login
+}
@@ -0,0 +1,39 @@
+package common
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// GlobExpr translates the glob into an unanchored regular expression. A "*"
+// or "?" doesn't match a slash, "**" matches any number of directories & a
+// trailing slash matches everything in the directory. A backslash escapes
+// the character after it.
+func GlobExpr(glob string) string {
+	if strings.HasSuffix(glob, "/") {
+		glob += "**"
+	}
+
+	var expr bytes.Buffer
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			expr.WriteString("[^/]*")
+		case glob[i] == '?':
+			expr.WriteString("[^/]")
+		case glob[i] == '\\' && i+1 < len(glob):
+			expr.WriteString(regexp.QuoteMeta(glob[i+1 : i+2]))
+			i++
+		default:
+			expr.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	return expr.String()
+}
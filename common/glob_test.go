@@ -0,0 +1,35 @@
+package common
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestGlobExpr(t *testing.T) {
+	examples := []struct {
+		glob, path string
+		matches    bool
+	}{
+		{"docs/", "docs/_docs/quickstart.md", true},
+		{"docs/**", "docs/index.html", true},
+		{"*.md", "README.md", true},
+		{"*.md", "docs/README.md", false},
+		{"**/*.md", "docs/README.md", true},
+		{"**/*.md", "README.md", true},
+		{"lib/**/*.rb", "lib/bunto.rb", true},
+		{"lib/**/*.rb", "lib/bunto/site.rb", true},
+		{"lib/?.rb", "lib/ab.rb", false},
+		{"site.rb", "lib/site.rb", false},
+		{`\*.md`, "*.md", true},
+		{`\*.md`, "README.md", false},
+	}
+	for _, example := range examples {
+		matcher, err := regexp.Compile("^" + GlobExpr(example.glob) + "$")
+		if err != nil {
+			t.Fatalf("%s: %v", example.glob, err)
+		}
+		if matcher.MatchString(example.path) != example.matches {
+			t.Errorf("expected %s ~ %s to be %v", example.glob, example.path, example.matches)
+		}
+	}
+}
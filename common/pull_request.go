@@ -0,0 +1,27 @@
+package common
+
+import (
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/google/go-github/github"
+)
+
+// ChangedFiles returns the paths of the files changed by the pull request.
+func ChangedFiles(context *ctx.Context, owner, repo string, number int) ([]string, error) {
+	paths := []string{}
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		files, resp, err := context.GitHub.PullRequests.ListFiles(owner, repo, number, opt)
+		if err != nil {
+			return nil, ctx.Errorf("couldn't list the files of %s/%s#%d: %v", owner, repo, number, err)
+		}
+		for _, file := range files {
+			if file.Filename != nil {
+				paths = append(paths, *file.Filename)
+			}
+		}
+		if resp.NextPage == 0 {
+			return paths, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
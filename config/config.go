@@ -0,0 +1,392 @@
+// config reads the whole bot's configuration from a single YAML (or JSON)
+// file: the orgs and repos it acts upon, which handlers are enabled for
+// each, and their parameters. A GlobalHandler can be built straight from
+// it, so running the bot for another org requires no Go code at all.
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/buntobot/auto-reply/affinity"
+	"github.com/buntobot/auto-reply/labeler"
+	"github.com/buntobot/auto-reply/lgtm"
+	"github.com/buntobot/auto-reply/stale"
+	"github.com/google/go-github/github"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	defaultEndpoint   = "/_github"
+	defaultLGTMQuorum = 1
+)
+
+type Config struct {
+	// The path the webhook handler is served at. Defaults to "/_github".
+	Endpoint string `yaml:"endpoint"`
+
+	// The canonical set of labels each repo should have.
+	Labels []Label `yaml:"labels"`
+
+	// The orgs the bot acts upon.
+	Orgs []Org `yaml:"orgs"`
+}
+
+type Label struct {
+	Name  string `yaml:"name"`
+	Color string `yaml:"color"`
+}
+
+type Org struct {
+	// The org's login, e.g. "bunto".
+	Name string `yaml:"name"`
+
+	// Handlers enabled for every repo in the org.
+	Handlers []string `yaml:"handlers"`
+
+	// The affinity teams of the org, by team ID.
+	Affinity *Affinity `yaml:"affinity"`
+
+	// Defaults for the repos of this org. Each repo can override them.
+	LGTM  *LGTM  `yaml:"lgtm"`
+	Stale *Stale `yaml:"stale"`
+
+	Repos []Repo `yaml:"repos"`
+}
+
+type Repo struct {
+	// The repo's name, without the owner, e.g. "bunto-feed".
+	Name string `yaml:"name"`
+
+	// Handlers enabled for this repo, in addition to the org's.
+	Handlers []string `yaml:"handlers"`
+
+	LGTM      *LGTM      `yaml:"lgtm"`
+	Stale     *Stale     `yaml:"stale"`
+	Deprecate *Deprecate `yaml:"deprecate"`
+}
+
+type Affinity struct {
+	Teams []int `yaml:"teams"`
+	// Strategy picks the captains to assign: random (the default),
+	// round_robin or least_loaded.
+	Strategy string `yaml:"strategy"`
+
+	// After this duration without an answer to the bot asking which team
+	// fits an issue, cmd/follow-up-affinity-teams reminds the author, or
+	// assigns captains of FallbackTeam if it's set.
+	FollowUpAfter time.Duration `yaml:"follow_up_after"`
+	// The ID of one of the teams, e.g. a triage team.
+	FallbackTeam int `yaml:"fallback_team"`
+
+	// Routes pick the team of the issues & pull requests which mention
+	// none, by their changed files, labels, or title & body keywords.
+	Routes []affinity.Rule `yaml:"routes"`
+}
+
+type LGTM struct {
+	// The number of LGTM's a PR must get before going state: "success".
+	// If unset, the org's or the default quorum applies.
+	Quorum int `yaml:"quorum"`
+
+	// The approvals it needs on top of that: from teams, from code owners,
+	// and the quorums of given base branches.
+	lgtm.Approvals `yaml:",inline"`
+
+	// Whether LGTM's survive pushes: on_push & protected_paths.
+	lgtm.CarryOver `yaml:",inline"`
+}
+
+type Stale struct {
+	// After this duration, an issue is marked as stale, then closed.
+	DormantDuration time.Duration `yaml:"dormant_duration"`
+
+	// If an issue has one of these labels, it is not stale.
+	ExemptLabels []string `yaml:"exempt_labels"`
+
+	// Comment to leave on an issue when marking it as stale.
+	Comment string `yaml:"comment"`
+}
+
+type Deprecate struct {
+	// The comment to leave on new issues before closing them.
+	Message string `yaml:"message"`
+}
+
+// Load reads and validates the configuration file at path.
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("config: %s: %v", path, err)
+	}
+	return config, nil
+}
+
+// Parse reads and validates a YAML or JSON configuration.
+func Parse(data []byte) (*Config, error) {
+	config := &Config{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Validate checks that every org and repo is named, that every handler
+// exists and that handler parameters are sensible.
+func (c *Config) Validate() error {
+	orgs := map[string]bool{}
+	for _, org := range c.Orgs {
+		if org.Name == "" {
+			return fmt.Errorf("org without a name")
+		}
+		if orgs[org.Name] {
+			return fmt.Errorf("org %s is listed twice", org.Name)
+		}
+		orgs[org.Name] = true
+
+		if err := validateHandlers(org.Name, org.Handlers); err != nil {
+			return err
+		}
+		if err := org.LGTM.validate(org.Name); err != nil {
+			return err
+		}
+		if org.Affinity != nil {
+			if _, err := affinity.ParseStrategy(org.Affinity.Strategy); err != nil {
+				return fmt.Errorf("%s: %v", org.Name, err)
+			}
+			if org.Affinity.FollowUpAfter < 0 {
+				return fmt.Errorf("%s: the affinity follow_up_after can't be negative", org.Name)
+			}
+			if org.Affinity.FallbackTeam != 0 && !containsInt(org.Affinity.Teams, org.Affinity.FallbackTeam) {
+				return fmt.Errorf("%s: the affinity fallback_team %d isn't one of its teams", org.Name, org.Affinity.FallbackTeam)
+			}
+			for _, rule := range org.Affinity.Routes {
+				if err := rule.Validate(); err != nil {
+					return fmt.Errorf("%s: %v", org.Name, err)
+				}
+				if !containsInt(org.Affinity.Teams, rule.Team) {
+					return fmt.Errorf("%s: the affinity route to team %d isn't to one of its teams", org.Name, rule.Team)
+				}
+			}
+		}
+
+		repos := map[string]bool{}
+		for _, repo := range org.Repos {
+			if repo.Name == "" {
+				return fmt.Errorf("repo without a name in org %s", org.Name)
+			}
+			nwo := org.Name + "/" + repo.Name
+			if repos[repo.Name] {
+				return fmt.Errorf("repo %s is listed twice", nwo)
+			}
+			repos[repo.Name] = true
+
+			if err := validateHandlers(nwo, repo.Handlers); err != nil {
+				return err
+			}
+			if err := repo.LGTM.validate(nwo); err != nil {
+				return err
+			}
+			if org.HasHandler(repo, "deprecate") && (repo.Deprecate == nil || repo.Deprecate.Message == "") {
+				return fmt.Errorf("%s: the deprecate handler requires a deprecate message", nwo)
+			}
+			if org.HasHandler(repo, "stale") && org.StaleConfiguration(repo, false).DormantDuration <= 0 {
+				return fmt.Errorf("%s: the stale handler requires a dormant_duration", nwo)
+			}
+			if org.HasHandler(repo, "affinity") && (org.Affinity == nil || len(org.Affinity.Teams) == 0) {
+				return fmt.Errorf("%s: the affinity handler requires affinity teams for org %s", nwo, org.Name)
+			}
+		}
+	}
+
+	for _, label := range c.Labels {
+		if label.Name == "" || label.Color == "" {
+			return fmt.Errorf("labels require a name and a color: %+v", label)
+		}
+	}
+
+	return nil
+}
+
+func validateHandlers(scope string, handlers []string) error {
+	for _, name := range handlers {
+		if !isKnownHandler(name) {
+			return fmt.Errorf("%s: unknown handler %q", scope, name)
+		}
+	}
+	return nil
+}
+
+func (l *LGTM) validate(scope string) error {
+	if l == nil {
+		return nil
+	}
+	if l.Quorum < 0 {
+		return fmt.Errorf("%s: lgtm quorum must not be negative", scope)
+	}
+	if err := l.Approvals.Validate(); err != nil {
+		return fmt.Errorf("%s: %v", scope, err)
+	}
+	if err := l.CarryOver.Validate(); err != nil {
+		return fmt.Errorf("%s: %v", scope, err)
+	}
+	return nil
+}
+
+// GetEndpoint returns the path the webhook handler should be served at.
+func (c *Config) GetEndpoint() string {
+	if c.Endpoint == "" {
+		return defaultEndpoint
+	}
+	return c.Endpoint
+}
+
+// GitHubLabels returns the canonical label set as GitHub labels.
+func (c *Config) GitHubLabels() []*github.Label {
+	labels := []*github.Label{}
+	for _, label := range c.Labels {
+		labels = append(labels, &github.Label{
+			Name:  github.String(label.Name),
+			Color: github.String(label.Color),
+		})
+	}
+	return labels
+}
+
+// labelsOrCanonical returns the labels the config lists or, if it lists
+// none, labeler.CanonicalLabels.
+func (c *Config) labelsOrCanonical() []*github.Label {
+	if len(c.Labels) == 0 {
+		return labeler.CanonicalLabels
+	}
+	return c.GitHubLabels()
+}
+
+// RepoRef identifies a configured repo along with the org it belongs to.
+type RepoRef struct {
+	Org  Org
+	Repo Repo
+}
+
+func (r RepoRef) Owner() string {
+	return r.Org.Name
+}
+
+func (r RepoRef) Name() string {
+	return r.Repo.Name
+}
+
+func (r RepoRef) String() string {
+	return r.Org.Name + "/" + r.Repo.Name
+}
+
+// ReposWithHandler returns every configured repo for which the named
+// handler is enabled, either directly or through its org.
+func (c *Config) ReposWithHandler(name string) []RepoRef {
+	refs := []RepoRef{}
+	for _, org := range c.Orgs {
+		for _, repo := range org.Repos {
+			if org.HasHandler(repo, name) {
+				refs = append(refs, RepoRef{Org: org, Repo: repo})
+			}
+		}
+	}
+	return refs
+}
+
+// HasHandler returns true if the named handler is enabled for the repo,
+// either directly or through the org.
+func (o Org) HasHandler(repo Repo, name string) bool {
+	return contains(o.Handlers, name) || contains(repo.Handlers, name)
+}
+
+// LGTMQuorum returns the repo's quorum, falling back to the org's if it
+// sets none, e.g. in an lgtm block which only sets approvals or on_push.
+func (o Org) LGTMQuorum(repo Repo) int {
+	if repo.LGTM != nil && repo.LGTM.Quorum > 0 {
+		return repo.LGTM.Quorum
+	}
+	if o.LGTM != nil && o.LGTM.Quorum > 0 {
+		return o.LGTM.Quorum
+	}
+	return defaultLGTMQuorum
+}
+
+// LGTMApprovals returns the repo's approvals, falling back to the org's if
+// it sets none.
+func (o Org) LGTMApprovals(repo Repo) lgtm.Approvals {
+	if repo.LGTM != nil && !repo.LGTM.Approvals.IsEmpty() {
+		return repo.LGTM.Approvals
+	}
+	if o.LGTM != nil {
+		return o.LGTM.Approvals
+	}
+	return lgtm.Approvals{}
+}
+
+// LGTMCarryOver returns the repo's policy for LGTM's upon pushes, falling
+// back to the org's if it sets none.
+func (o Org) LGTMCarryOver(repo Repo) lgtm.CarryOver {
+	if repo.LGTM != nil && repo.LGTM.OnPush != "" {
+		return repo.LGTM.CarryOver
+	}
+	if o.LGTM != nil {
+		return o.LGTM.CarryOver
+	}
+	return lgtm.CarryOver{}
+}
+
+// StaleConfiguration merges the repo's stale parameters over the org's.
+func (o Org) StaleConfiguration(repo Repo, perform bool) stale.Configuration {
+	merged := Stale{}
+	for _, params := range []*Stale{o.Stale, repo.Stale} {
+		if params == nil {
+			continue
+		}
+		if params.DormantDuration != 0 {
+			merged.DormantDuration = params.DormantDuration
+		}
+		if params.ExemptLabels != nil {
+			merged.ExemptLabels = params.ExemptLabels
+		}
+		if params.Comment != "" {
+			merged.Comment = params.Comment
+		}
+	}
+
+	config := stale.Configuration{
+		Perform:         perform,
+		ExemptLabels:    merged.ExemptLabels,
+		DormantDuration: merged.DormantDuration,
+	}
+	if merged.Comment != "" {
+		config.NotificationComment = &github.IssueComment{Body: github.String(merged.Comment)}
+	}
+	return config
+}
+
+func contains(haystack []string, needle string) bool {
+	for _, hay := range haystack {
+		if hay == needle {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(haystack []int, needle int) bool {
+	for _, hay := range haystack {
+		if hay == needle {
+			return true
+		}
+	}
+	return false
+}
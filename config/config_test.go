@@ -0,0 +1,185 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/buntobot/auto-reply/hooks"
+	"github.com/buntobot/auto-reply/lgtm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadBuntoConfig(t *testing.T) {
+	conf, err := Load("../bunto/buntobot.yml")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "/_github/bunto", conf.GetEndpoint())
+	assert.Len(t, conf.Labels, 25)
+	assert.Len(t, conf.ReposWithHandler("lgtm"), 22)
+	assert.Len(t, conf.ReposWithHandler("stale"), 15)
+	assert.Len(t, conf.ReposWithHandler("affinity"), 2)
+
+	org := conf.Orgs[0]
+	quorums := map[string]int{}
+	for _, ref := range conf.ReposWithHandler("lgtm") {
+		quorums[ref.Name()] = org.LGTMQuorum(ref.Repo)
+	}
+	assert.Equal(t, 2, quorums["bunto"])
+	assert.Equal(t, 1, quorums["bunto-feed"])
+	assert.Equal(t, 2, quorums["github-metadata"])
+
+	for _, ref := range conf.ReposWithHandler("stale") {
+		staleConfig := ref.Org.StaleConfiguration(ref.Repo, false)
+		assert.Equal(t, 1440*time.Hour, staleConfig.DormantDuration)
+		assert.Equal(t, []string{"has-pull-request", "pinned", "security"}, staleConfig.ExemptLabels)
+		if assert.NotNil(t, staleConfig.NotificationComment) {
+			if ref.Name() == "bunto" {
+				assert.Contains(t, *staleConfig.NotificationComment.Body, "3.3-stable")
+			} else {
+				assert.NotContains(t, *staleConfig.NotificationComment.Body, "3.3-stable")
+			}
+		}
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	conf, err := Parse([]byte(`{
+		"orgs": [{
+			"name": "octo",
+			"handlers": ["stats.status"],
+			"repos": [{"name": "cat", "handlers": ["lgtm"], "lgtm": {"quorum": 3}}]
+		}]
+	}`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "/_github", conf.GetEndpoint())
+	assert.Equal(t, 3, conf.Orgs[0].LGTMQuorum(conf.Orgs[0].Repos[0]))
+}
+
+func TestLGTMApprovals(t *testing.T) {
+	conf, err := Parse([]byte(`
+orgs:
+  - name: octo
+    lgtm:
+      quorum: 1
+      teams: [{team: octo/core}]
+      code_owners: true
+      on_push: keep_base_merges
+    repos:
+      - name: cat
+      - name: dog
+        lgtm:
+          branches: [{branch: "release/*", quorum: 2}]
+          on_push: keep_unless_protected
+          protected_paths: [/lib/]
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	org := conf.Orgs[0]
+	cat := org.LGTMApprovals(org.Repos[0])
+	assert.Equal(t, "octo/core", cat.Teams[0].Team)
+	assert.True(t, cat.CodeOwners)
+	assert.Equal(t, lgtm.KeepOnBaseMerge, org.LGTMCarryOver(org.Repos[0]).OnPush)
+	assert.Equal(t, []string{"/lib/"}, org.LGTMCarryOver(org.Repos[1]).ProtectedPaths)
+	dog := org.LGTMApprovals(org.Repos[1])
+	assert.Empty(t, dog.Teams)
+	assert.Equal(t, 2, dog.Branches[0].Quorum)
+}
+
+func TestLGTMQuorumFallsBack(t *testing.T) {
+	conf, err := Parse([]byte(`
+orgs:
+  - name: octo
+    lgtm: {quorum: 2}
+    repos:
+      - name: cat
+        lgtm: {on_push: keep_base_merges}
+      - name: dog
+        lgtm:
+          teams: [{team: octo/core}]
+  - name: bunto
+    lgtm: {code_owners: true}
+    repos:
+      - name: bunto
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	octo := conf.Orgs[0]
+	assert.Equal(t, 2, octo.LGTMQuorum(octo.Repos[0]))
+	assert.Equal(t, 2, octo.LGTMQuorum(octo.Repos[1]))
+	bunto := conf.Orgs[1]
+	assert.Equal(t, defaultLGTMQuorum, bunto.LGTMQuorum(bunto.Repos[0]))
+}
+
+func TestParseInvalid(t *testing.T) {
+	cases := map[string]string{
+		"unknown handler":     "orgs: [{name: octo, handlers: [nope]}]",
+		"unknown field":       "orgs: [{name: octo, quorum: 2}]",
+		"unnamed org":         "orgs: [{handlers: [stats.status]}]",
+		"duplicate repo":      "orgs: [{name: octo, repos: [{name: cat}, {name: cat}]}]",
+		"deprecate message":   "orgs: [{name: octo, repos: [{name: cat, handlers: [deprecate]}]}]",
+		"stale duration":      "orgs: [{name: octo, repos: [{name: cat, handlers: [stale]}]}]",
+		"affinity teams":      "orgs: [{name: octo, repos: [{name: cat, handlers: [affinity]}]}]",
+		"affinity strategy":   "orgs: [{name: octo, affinity: {teams: [1], strategy: busiest}}]",
+		"affinity fallback":   "orgs: [{name: octo, affinity: {teams: [1], fallback_team: 2}}]",
+		"affinity route team": "orgs: [{name: octo, affinity: {teams: [1], routes: [{team: 2, labels: [docs]}]}}]",
+		"affinity route rule": "orgs: [{name: octo, affinity: {teams: [1], routes: [{team: 1}]}}]",
+		"negative quorum":     "orgs: [{name: octo, repos: [{name: cat, lgtm: {quorum: -1}}]}]",
+		"lgtm team":           "orgs: [{name: octo, lgtm: {quorum: 1, teams: [{team: core}]}}]",
+		"lgtm branch":         "orgs: [{name: octo, repos: [{name: cat, lgtm: {branches: [{branch: 'v[', quorum: 2}]}}]}]",
+		"lgtm on_push":        "orgs: [{name: octo, lgtm: {on_push: keep_unless_protected}}]",
+		"label without color": "labels: [{name: bug}]",
+	}
+	for description, input := range cases {
+		_, err := Parse([]byte(input))
+		assert.Error(t, err, description)
+	}
+}
+
+func TestBuildHandlers(t *testing.T) {
+	conf, err := Parse([]byte(`
+orgs:
+  - name: octo
+    handlers: [stats.status, travis.failing_fmt_build]
+    repos:
+      - name: cat
+        handlers: [lgtm, chlog.merge_and_label]
+      - name: dog
+        handlers: [deprecate]
+        deprecate: {message: "Gone fishin'."}
+      - name: fish
+        handlers: [stale]
+        stale: {dormant_duration: 24h}
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	handlers, err := conf.BuildHandlers(&ctx.Context{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Len(t, handlers.EventHandlers, 6)
+	assert.Len(t, handlers.EventHandlers[hooks.PushEvent], 1)
+	assert.Len(t, handlers.EventHandlers[hooks.MembershipEvent], 1)
+	// The lgtm & merge commands are run by a single router.
+	assert.Len(t, handlers.EventHandlers[hooks.IssueCommentEvent], 1)
+	assert.Len(t, handlers.EventHandlers[hooks.PullRequestReviewCommentEvent], 1)
+	assert.Len(t, handlers.RepoEventHandlers, 1)
+
+	org := handlers.RepoEventHandlers["octo"]
+	assert.Len(t, org[hooks.StatusEvent], 2)
+	assert.Len(t, org[hooks.IssuesEvent], 1)
+	assert.Len(t, org[hooks.IssueCommentEvent], 0)
+	assert.Len(t, org[hooks.PullRequestEvent], 1)
+	assert.Len(t, org[hooks.PullRequestReviewEvent], 1)
+}
@@ -0,0 +1,246 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/buntobot/auto-reply/affinity"
+	"github.com/buntobot/auto-reply/auth"
+	"github.com/buntobot/auto-reply/autopull"
+	"github.com/buntobot/auto-reply/bunto/deprecate"
+	"github.com/buntobot/auto-reply/bunto/issuecomment"
+	"github.com/buntobot/auto-reply/chlog"
+	"github.com/buntobot/auto-reply/codeowners"
+	"github.com/buntobot/auto-reply/commands"
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/buntobot/auto-reply/hooks"
+	"github.com/buntobot/auto-reply/labeler"
+	"github.com/buntobot/auto-reply/lgtm"
+	"github.com/buntobot/auto-reply/repoconfig"
+	"github.com/buntobot/auto-reply/stats"
+	"github.com/buntobot/auto-reply/travis"
+)
+
+type registration struct {
+	eventType hooks.EventType
+	handler   hooks.EventHandler
+}
+
+var (
+	// functionHandlers need no parameters. They are fired for every repo
+	// they are enabled for.
+	functionHandlers = map[string][]registration{
+		"chlog.create_release":          {{hooks.CreateEvent, chlog.CreateReleaseOnTagHandler}},
+		"codeowners.request_reviewers":  {{hooks.PullRequestEvent, codeowners.RequestReviewersHandler}},
+		"issuecomment.pending_feedback": {{hooks.IssueCommentEvent, issuecomment.PendingFeedbackUnlabeler}},
+		"issuecomment.stale":            {{hooks.IssueCommentEvent, issuecomment.StaleUnlabeler}},
+		"labeler.has_pull_request":      {{hooks.PullRequestEvent, labeler.IssueHasPullRequestLabeler}},
+		"labeler.pending_rebase":        {{hooks.PullRequestEvent, labeler.PendingRebaseNeedsWorkPRUnlabeler}},
+		"stats.status":                  {{hooks.StatusEvent, stats.StatusHandler}},
+		"travis.failing_fmt_build":      {{hooks.StatusEvent, travis.FailingFmtBuildHandler}},
+	}
+
+	// commandHandlers build comment commands, run by a commands.Router on
+	// the repos they are enabled for.
+	commandHandlers = map[string]func(c *Config) []commands.Command{
+		"chlog.merge_and_label": func(c *Config) []commands.Command { return []commands.Command{chlog.MergeCommand} },
+		"labeler.commands": func(c *Config) []commands.Command {
+			return labeler.LabelCommands(labeler.LabelNames(c.labelsOrCanonical()))
+		},
+	}
+
+	// repoHandlers keep their own list of repos and per-repo parameters.
+	repoHandlers = []string{"affinity", "autopull", "deprecate", "lgtm"}
+
+	// jobs are run by the cmd/* utilities rather than by webhooks. Enabling
+	// one for a repo adds the repo to the utility's default list.
+	jobs = []string{"dependencies", "freeze", "stale"}
+)
+
+func isKnownHandler(name string) bool {
+	_, ok := functionHandlers[name]
+	_, isCommand := commandHandlers[name]
+	return ok || isCommand || contains(repoHandlers, name) || contains(jobs, name)
+}
+
+// Handlers are the event handlers described by a Config, ready to be used
+// by a hooks.GlobalHandler.
+type Handlers struct {
+	EventHandlers     hooks.EventHandlerMap
+	RepoEventHandlers map[string]hooks.EventHandlerMap
+}
+
+// NewGlobalHandler builds every handler enabled in the config and returns a
+// GlobalHandler which fires them.
+func (c *Config) NewGlobalHandler(context *ctx.Context) (*hooks.GlobalHandler, error) {
+	handlers, err := c.BuildHandlers(context)
+	if err != nil {
+		return nil, err
+	}
+
+	return &hooks.GlobalHandler{
+		Context:           context,
+		EventHandlers:     handlers.EventHandlers,
+		RepoEventHandlers: handlers.RepoEventHandlers,
+	}, nil
+}
+
+// BuildHandlers creates and configures every handler enabled in the config.
+// Affinity teams are fetched from GitHub, so this makes API calls.
+func (c *Config) BuildHandlers(context *ctx.Context) (*Handlers, error) {
+	handlers := &Handlers{
+		EventHandlers:     hooks.EventHandlerMap{},
+		RepoEventHandlers: map[string]hooks.EventHandlerMap{},
+	}
+
+	// Keep the cached .github/buntobot.yml of every repo up to date.
+	handlers.EventHandlers.AddHandler(hooks.PushEvent, repoconfig.PushHandler)
+	// Forget who may do what once it changes.
+	handlers.EventHandlers.AddHandler(hooks.MembershipEvent, auth.MembershipHandler)
+	handlers.EventHandlers.AddHandler(hooks.TeamAddEvent, auth.TeamAddHandler)
+	handlers.EventHandlers.AddHandler(hooks.MemberEvent, auth.MemberHandler)
+
+	lgtmHandler := &lgtm.Handler{}
+	deprecateHandler := &deprecate.Handler{}
+	router := &commands.Router{}
+	// commandScopes lists the orgs & repos each command is enabled for.
+	commandScopes := map[string]scopeSet{}
+	lgtmEnabled := false
+	affinityEnabled := false
+
+	for _, org := range c.Orgs {
+		orgHandlers := handlers.forScope(org.Name)
+		for _, name := range org.Handlers {
+			addFunctionHandler(orgHandlers, name)
+			enableCommand(commandScopes, name, org.Name)
+		}
+
+		affinityHandler := &affinity.Handler{}
+		autopullHandler := &autopull.Handler{}
+		autopullHandler.AcceptAllRepos(contains(org.Handlers, "autopull"))
+		enabled := map[string]bool{}
+
+		for _, repo := range org.Repos {
+			repoHandlers := handlers.forScope(org.Name + "/" + repo.Name)
+			for _, name := range repo.Handlers {
+				addFunctionHandler(repoHandlers, name)
+				enableCommand(commandScopes, name, org.Name+"/"+repo.Name)
+			}
+
+			if org.HasHandler(repo, "affinity") {
+				affinityHandler.AddRepo(org.Name, repo.Name)
+				enabled["affinity"] = true
+			}
+			if org.HasHandler(repo, "autopull") {
+				autopullHandler.AddRepo(org.Name, repo.Name)
+				enabled["autopull"] = true
+			}
+			if org.HasHandler(repo, "deprecate") {
+				deprecateHandler.AddRepo(org.Name, repo.Name, repo.Deprecate.Message)
+				enabled["deprecate"] = true
+			}
+			if org.HasHandler(repo, "lgtm") {
+				lgtmHandler.AddRepo(org.Name, repo.Name, org.LGTMQuorum(repo))
+				lgtmHandler.SetApprovals(org.Name, repo.Name, org.LGTMApprovals(repo))
+				lgtmHandler.SetCarryOver(org.Name, repo.Name, org.LGTMCarryOver(repo))
+				enabled["lgtm"] = true
+			}
+		}
+
+		if enabled["affinity"] {
+			strategy, _ := affinity.ParseStrategy(org.Affinity.Strategy)
+			affinityHandler.SetStrategy(strategy)
+			affinityHandler.SetRules(org.Affinity.Routes)
+			for _, teamID := range org.Affinity.Teams {
+				if err := affinityHandler.AddTeam(context, teamID); err != nil {
+					return nil, fmt.Errorf("%s: couldn't fetch affinity team %d: %v", org.Name, teamID, err)
+				}
+			}
+			context.Log("%s affinity teams: %+v", org.Name, affinityHandler.GetTeams())
+			context.Log("%s affinity team repos: %+v", org.Name, affinityHandler.GetRepos())
+
+			orgHandlers.AddHandler(hooks.IssuesEvent, affinityHandler.AssignIssueToAffinityTeamCaptain)
+			orgHandlers.AddHandler(hooks.IssueCommentEvent, affinityHandler.AssignIssueToAffinityTeamCaptainFromComment)
+			orgHandlers.AddHandler(hooks.PullRequestEvent, affinityHandler.AssignPRToAffinityTeamCaptain)
+			// Membership & team events needn't carry a repository, but
+			// their organization scopes them to the org.
+			orgHandlers.AddHandler(hooks.MembershipEvent, affinityHandler.MembershipHandler)
+			orgHandlers.AddHandler(hooks.TeamEvent, affinityHandler.TeamHandler)
+			for _, command := range affinityHandler.Commands() {
+				router.Register(command)
+			}
+			affinityHandler.SetRouter(router)
+			affinityEnabled = true
+		}
+		if enabled["autopull"] || contains(org.Handlers, "autopull") {
+			orgHandlers.AddHandler(hooks.PushEvent, autopullHandler.CreatePullRequestFromPush)
+		}
+		if enabled["deprecate"] {
+			orgHandlers.AddHandler(hooks.IssuesEvent, deprecateHandler.DeprecateOldRepos)
+		}
+		if enabled["lgtm"] {
+			lgtmEnabled = true
+			orgHandlers.AddHandler(hooks.PullRequestEvent, lgtmHandler.PullRequestHandler)
+			orgHandlers.AddHandler(hooks.PullRequestReviewEvent, lgtmHandler.PullRequestReviewHandler)
+		}
+	}
+
+	for name, scopes := range commandScopes {
+		for _, command := range commandHandlers[name](c) {
+			command.Enabled = scopes.includes
+			router.Register(command)
+		}
+	}
+	if lgtmEnabled {
+		router.Register(lgtmHandler.Command())
+	}
+	if len(commandScopes) > 0 || lgtmEnabled || affinityEnabled {
+		handlers.EventHandlers.AddHandler(hooks.IssueCommentEvent, router.IssueCommentHandler)
+		handlers.EventHandlers.AddHandler(hooks.PullRequestReviewCommentEvent, router.PullRequestReviewCommentHandler)
+	}
+
+	handlers.prune()
+	return handlers, nil
+}
+
+// scopeSet is a set of orgs & "org/repo"s.
+type scopeSet map[string]bool
+
+func (s scopeSet) includes(owner, repo string) bool {
+	return s[owner] || s[owner+"/"+repo]
+}
+
+// enableCommand records that the named handler, if it is a command, is
+// enabled for the scope.
+func enableCommand(scopes map[string]scopeSet, name, scope string) {
+	if _, ok := commandHandlers[name]; !ok {
+		return
+	}
+	if scopes[name] == nil {
+		scopes[name] = scopeSet{}
+	}
+	scopes[name][scope] = true
+}
+
+// forScope returns the handler map for the given org or repo, creating it
+// if necessary.
+func (h *Handlers) forScope(scope string) hooks.EventHandlerMap {
+	if _, ok := h.RepoEventHandlers[scope]; !ok {
+		h.RepoEventHandlers[scope] = hooks.EventHandlerMap{}
+	}
+	return h.RepoEventHandlers[scope]
+}
+
+// prune removes the scopes which ended up without any handlers.
+func (h *Handlers) prune() {
+	for scope, handlers := range h.RepoEventHandlers {
+		if len(handlers) == 0 {
+			delete(h.RepoEventHandlers, scope)
+		}
+	}
+}
+
+func addFunctionHandler(handlers hooks.EventHandlerMap, name string) {
+	for _, reg := range functionHandlers[name] {
+		handlers.AddHandler(reg.eventType, reg.handler)
+	}
+}
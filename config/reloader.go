@@ -0,0 +1,134 @@
+package config
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+
+	"github.com/buntobot/auto-reply/hooks"
+)
+
+// Reloader rebuilds the handlers of a GlobalHandler from a configuration
+// file while the server is running. If the file is invalid or the handlers
+// can't be built, the running handlers are left in place.
+type Reloader struct {
+	// The configuration file to read.
+	Path string
+
+	// The handler whose event handlers are replaced upon reload.
+	Handler *hooks.GlobalHandler
+
+	// The token required by ServeHTTP. If empty, ServeHTTP always refuses.
+	Token string
+
+	// reloadLock ensures only one reload happens at a time.
+	reloadLock sync.Mutex
+	endpoint   string
+}
+
+// NewReloader loads the configuration at path and builds a GlobalHandler
+// from it which the returned Reloader can then reload.
+func NewReloader(handler *hooks.GlobalHandler, path, token string) (*Reloader, *Config, error) {
+	conf, err := Load(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	handlers, err := conf.BuildHandlers(handler.Context)
+	if err != nil {
+		return nil, nil, fmt.Errorf("config: %s: %v", path, err)
+	}
+	handler.SetEventHandlers(handlers.EventHandlers, handlers.RepoEventHandlers)
+
+	return &Reloader{
+		Path:     path,
+		Handler:  handler,
+		Token:    token,
+		endpoint: conf.GetEndpoint(),
+	}, conf, nil
+}
+
+// Reload reads the configuration file again and swaps the new handlers in.
+func (r *Reloader) Reload() error {
+	r.reloadLock.Lock()
+	defer r.reloadLock.Unlock()
+
+	context := r.Handler.Context
+
+	conf, err := Load(r.Path)
+	if err != nil {
+		context.IncrStat("config.reload.invalid")
+		return context.NewError("config.Reload: rejecting new configuration: %v", err)
+	}
+
+	handlers, err := conf.BuildHandlers(context)
+	if err != nil {
+		context.IncrStat("config.reload.invalid")
+		return context.NewError("config.Reload: rejecting new configuration: %v", err)
+	}
+
+	if r.endpoint != "" && conf.GetEndpoint() != r.endpoint {
+		context.Log("config.Reload: endpoint changed from %s to %s; restart to serve the new endpoint",
+			r.endpoint, conf.GetEndpoint())
+	}
+
+	r.Handler.SetEventHandlers(handlers.EventHandlers, handlers.RepoEventHandlers)
+	context.IncrStat("config.reload.success")
+	context.Log("config.Reload: reloaded %s", r.Path)
+	return nil
+}
+
+// ReloadOnSignal reloads the configuration each time one of the given
+// signals (e.g. syscall.SIGHUP) is received.
+func (r *Reloader) ReloadOnSignal(signals ...os.Signal) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, signals...)
+	go func() {
+		for sig := range c {
+			log.Printf("config: received %s, reloading %s", sig, r.Path)
+			r.Reload()
+		}
+	}()
+}
+
+// ServeHTTP reloads the configuration upon a POST request which carries
+// the reloader's token in its Authorization header.
+func (r *Reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+
+	if req.Method != "POST" {
+		http.Error(w, "reloading requires a POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !r.authorized(req) {
+		http.Error(w, "not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.Reload(); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	fmt.Fprintf(w, "reloaded %s", r.Path)
+}
+
+func (r *Reloader) authorized(req *http.Request) bool {
+	if r.Token == "" {
+		return false
+	}
+
+	auth := req.Header.Get("Authorization")
+	for _, scheme := range []string{"token ", "Bearer "} {
+		if strings.HasPrefix(auth, scheme) {
+			given := strings.TrimPrefix(auth, scheme)
+			return subtle.ConstantTimeCompare([]byte(given), []byte(r.Token)) == 1
+		}
+	}
+	return false
+}
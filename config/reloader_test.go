@@ -0,0 +1,94 @@
+package config
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/buntobot/auto-reply/hooks"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfig(t *testing.T, path, contents string) {
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auto-reply-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "buntobot.yml")
+
+	writeConfig(t, path, "orgs: [{name: octo, handlers: [stats.status]}]")
+	handler := &hooks.GlobalHandler{Context: &ctx.Context{}}
+	reloader, conf, err := NewReloader(handler, path, "s3kr1t")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "/_github", conf.GetEndpoint())
+	assert.Len(t, handler.RepoEventHandlers["octo"][hooks.StatusEvent], 1)
+
+	// Invalid configs are rejected & the old handlers stay in place.
+	writeConfig(t, path, "orgs: [{name: octo, handlers: [nope]}]")
+	assert.Error(t, reloader.Reload())
+	assert.Len(t, handler.RepoEventHandlers["octo"][hooks.StatusEvent], 1)
+
+	writeConfig(t, path, "orgs: [{name: octo, handlers: [stats.status, travis.failing_fmt_build]}]")
+	assert.NoError(t, reloader.Reload())
+	assert.Len(t, handler.RepoEventHandlers["octo"][hooks.StatusEvent], 2)
+}
+
+func TestReloaderServeHTTP(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auto-reply-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "buntobot.yml")
+
+	writeConfig(t, path, "orgs: [{name: octo, handlers: [stats.status]}]")
+	handler := &hooks.GlobalHandler{Context: &ctx.Context{}}
+	reloader, _, err := NewReloader(handler, path, "s3kr1t")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	cases := []struct {
+		method, authorization, config string
+		expectedCode                  int
+	}{
+		{"GET", "token s3kr1t", "", http.StatusMethodNotAllowed},
+		{"POST", "", "", http.StatusUnauthorized},
+		{"POST", "token nope", "", http.StatusUnauthorized},
+		{"POST", "token s3kr1t", "orgs: [{name: octo, handlers: [nope]}]", http.StatusUnprocessableEntity},
+		{"POST", "Bearer s3kr1t", "orgs: [{name: octo}]", http.StatusOK},
+	}
+	for _, test := range cases {
+		if test.config != "" {
+			writeConfig(t, path, test.config)
+		}
+		req := httptest.NewRequest(test.method, "/_admin/reload", nil)
+		if test.authorization != "" {
+			req.Header.Set("Authorization", test.authorization)
+		}
+		w := httptest.NewRecorder()
+		reloader.ServeHTTP(w, req)
+		assert.Equal(t, test.expectedCode, w.Code, "%s with %q", test.method, test.authorization)
+	}
+	assert.Empty(t, handler.RepoEventHandlers)
+
+	reloader.Token = ""
+	req := httptest.NewRequest("POST", "/_admin/reload", nil)
+	req.Header.Set("Authorization", "token ")
+	w := httptest.NewRecorder()
+	reloader.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
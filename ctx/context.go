@@ -1,40 +1,220 @@
 // ctx is magic; it is basically my own "context" package before I realied that "context" existed.
 // ctx.Context is the main construct. It keeps track of information pertinent to the request.
-// It should all eventually be replaced by context.Context from the Go stdlib.
+// It wraps a context.Context from the Go stdlib, and implements that
+// interface itself, so it can be handed to anything which accepts one.
 package ctx
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net/http"
+	"time"
 
 	"github.com/DataDog/datadog-go/statsd"
 	"github.com/google/go-github/github"
 )
 
 type Context struct {
+	// The clients are shared by every context derived from this one.
 	GitHub   *github.Client
 	Statsd   *statsd.Client
 	RubyGems *rubyGemsClient
-	Repo     repoRef
-	Issue    issueRef
+	// GitHubApp, if set, provides the client of each installation.
+	GitHubApp *GitHubApp
 
-	currentlyAuthedGitHubUser *github.User
+	// The repo & issue this context refers to. Each event gets its own.
+	Repo  repoRef
+	Issue issueRef
+
+	// RequestID identifies the event being handled, e.g. the
+	// X-GitHub-Delivery header of the webhook. Empty outside of events.
+	RequestID string
+
+	// Before is the SHA the pushed ref was at before the push, for push
+	// events & "synchronize" pull_request events. Empty otherwise.
+	Before string
+
+	// DryRun is set by EnableDryRun: changes to GitHub are only logged.
+	DryRun bool
+
+	// std carries the deadline & cancellation of the event.
+	std context.Context
+
+	// baseTransport sends the requests of the GitHub clients once they
+	// are authenticated. Shared like them.
+	baseTransport http.RoundTripper
+
+	// gitHubTransport sends the requests of GitHub, if ctx built it. Each
+	// event gets a client of its own which sends them bound to the event.
+	gitHubTransport http.RoundTripper
+
+	// currentlyAuthedGitHubUser is shared like the clients.
+	currentlyAuthedGitHubUser *authedUser
+}
+
+// WithEvent returns a copy of c scoped to a single event. It shares the
+// clients of c, but has its own Repo & Issue, is tagged with requestID, and
+// is cancelled after timeout or when cancel is called, whichever is first.
+// The GitHub requests of the event are aborted once it is cancelled.
+func (c *Context) WithEvent(requestID string, timeout time.Duration) (eventContext *Context, cancel context.CancelFunc) {
+	std, cancel := context.WithTimeout(c.stdContext(), timeout)
+	eventContext = &Context{
+		GitHub:    c.GitHub,
+		Statsd:    c.Statsd,
+		RubyGems:  c.RubyGems,
+		GitHubApp: c.GitHubApp,
+		RequestID: requestID,
+		DryRun:    c.DryRun,
+		std:       std,
+
+		baseTransport:             c.baseTransport,
+		gitHubTransport:           c.gitHubTransport,
+		currentlyAuthedGitHubUser: c.currentlyAuthedGitHubUser,
+	}
+	if c.gitHubTransport != nil {
+		eventContext.GitHub = eventClient(c.GitHub, c.gitHubTransport, std)
+	}
+	return eventContext, cancel
+}
+
+// UseInstallation makes c act as the installation of its GitHubApp, e.g.
+// the one a webhook is from. Like those of WithEvent, its requests are
+// aborted once c is cancelled.
+func (c *Context) UseInstallation(installationID int64) {
+	transport := c.GitHubApp.clientTransport(installationID)
+	c.GitHub = eventClient(c.GitHubApp.Client(installationID), transport, c.stdContext())
+	c.gitHubTransport = transport
+}
+
+// Copy returns a shallow copy of c, so that e.g. each handler of an event
+// can call SetIssue without affecting the others. The deadline &
+// cancellation are shared.
+func (c *Context) Copy() *Context {
+	copied := *c
+	return &copied
+}
+
+func (c *Context) stdContext() context.Context {
+	if c.std == nil {
+		return context.Background()
+	}
+	return c.std
+}
+
+// Deadline, Done, Err & Value implement context.Context.
+
+func (c *Context) Deadline() (deadline time.Time, ok bool) {
+	return c.stdContext().Deadline()
+}
+
+func (c *Context) Done() <-chan struct{} {
+	return c.stdContext().Done()
+}
+
+func (c *Context) Err() error {
+	return c.stdContext().Err()
 }
 
+func (c *Context) Value(key interface{}) interface{} {
+	return c.stdContext().Value(key)
+}
+
+// NewError logs the message and returns it as an error. If one of args is
+// an error, the returned error wraps it, so that callers can tell e.g. a
+// GitHub outage from a handler which chose not to act.
 func (c *Context) NewError(format string, args ...interface{}) error {
 	c.Log(format, args...)
-	return fmt.Errorf(format, args...)
+	return Errorf(format, args...)
+}
+
+// Errorf is fmt.Errorf, except that the error wraps the first of args which
+// is an error, like those of NewError. It isn't logged.
+func Errorf(format string, args ...interface{}) error {
+	err := &contextError{message: fmt.Sprintf(format, args...)}
+	for _, arg := range args {
+		if cause, ok := arg.(error); ok {
+			err.cause = cause
+			break
+		}
+	}
+	return err
+}
+
+// NewSkip returns an error telling the caller that the handler chose not to
+// act on the event, e.g. because it isn't a LGTM comment. Unlike NewError,
+// the message isn't logged here; the GlobalHandler reports every skip.
+func (c *Context) NewSkip(format string, args ...interface{}) error {
+	return &skipError{message: fmt.Sprintf(format, args...)}
+}
+
+// IsSkip returns true if err was returned by NewSkip.
+func IsSkip(err error) bool {
+	for ; err != nil; err = Unwrap(err) {
+		if _, ok := err.(*skipError); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type skipError struct {
+	message string
+}
+
+func (e *skipError) Error() string {
+	return e.message
+}
+
+type contextError struct {
+	message string
+	cause   error
+}
+
+func (e *contextError) Error() string {
+	return e.message
+}
+
+func (e *contextError) Unwrap() error {
+	return e.cause
+}
+
+// Unwrap returns the error err wraps, if it has an Unwrap method, or nil.
+// It's errors.Unwrap, which our Go version predates.
+func Unwrap(err error) error {
+	if wrapper, ok := err.(interface {
+		Unwrap() error
+	}); ok {
+		return wrapper.Unwrap()
+	}
+	return nil
 }
 
 func (c *Context) Log(format string, args ...interface{}) {
+	if c.RequestID != "" {
+		log.Println("["+c.RequestID+"]", fmt.Sprintf(format, args...))
+		return
+	}
 	log.Println(fmt.Sprintf(format, args...))
 }
 
 func NewDefaultContext() *Context {
+	statsdClient := NewStatsd()
+	base := newBaseTransport(statsdClient)
+	app := GitHubAppFromEnv()
+	if app != nil {
+		app.Transport = base
+	}
+	transport := newTransport(app, base)
 	return &Context{
-		GitHub:   NewClient(),
-		Statsd:   NewStatsd(),
-		RubyGems: NewRubyGemsClient(),
+		GitHub:          newClient(app, transport),
+		Statsd:          statsdClient,
+		RubyGems:        NewRubyGemsClient(),
+		GitHubApp:       app,
+		baseTransport:   base,
+		gitHubTransport: transport,
+
+		currentlyAuthedGitHubUser: &authedUser{},
 	}
 }
 
@@ -0,0 +1,93 @@
+package ctx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithEvent(t *testing.T) {
+	parent := &Context{GitHub: github.NewClient(nil)}
+	parent.SetRepo("bunto", "bunto")
+
+	eventContext, cancel := parent.WithEvent("delivery-1", time.Minute)
+	assert.True(t, parent.GitHub == eventContext.GitHub)
+	assert.Equal(t, "delivery-1", eventContext.RequestID)
+	assert.True(t, eventContext.Repo.IsEmpty())
+
+	deadline, ok := eventContext.Deadline()
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+
+	handlerContext := eventContext.Copy()
+	handlerContext.SetIssue("bunto", "bunto", 1)
+	assert.True(t, eventContext.Issue.IsEmpty())
+
+	cancel()
+	assert.Equal(t, context.Canceled, handlerContext.Err())
+	assert.NoError(t, parent.Err())
+}
+
+func TestWithEventAbortsGitHubRequests(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	parent := &Context{GitHub: github.NewClient(nil), gitHubTransport: http.DefaultTransport}
+	parent.GitHub.BaseURL, _ = url.Parse(server.URL + "/")
+
+	eventContext, cancel := parent.WithEvent("delivery-1", 50*time.Millisecond)
+	defer cancel()
+	assert.False(t, parent.GitHub == eventContext.GitHub)
+	assert.Equal(t, parent.GitHub.BaseURL, eventContext.GitHub.BaseURL)
+
+	start := time.Now()
+	_, _, err := eventContext.GitHub.Issues.Get("bunto", "bunto", 1)
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < 5*time.Second, "the request outlived the event")
+	assert.Equal(t, context.DeadlineExceeded, eventContext.Err())
+}
+
+func TestSetIssueKeepsTheAuthorOfTheSameIssue(t *testing.T) {
+	context := &Context{}
+	context.SetIssue("bunto", "bunto", 1)
+	context.SetAuthor("octocat")
+
+	context.SetIssue("bunto", "bunto", 1)
+	assert.Equal(t, "octocat", context.Issue.Author)
+
+	context.SetIssue("bunto", "bunto", 2)
+	assert.Equal(t, "", context.Issue.Author)
+}
+
+func TestContextWithoutEvent(t *testing.T) {
+	context := &Context{}
+	_, ok := context.Deadline()
+	assert.False(t, ok)
+	assert.Nil(t, context.Done())
+	assert.NoError(t, context.Err())
+}
+
+func TestNewErrorWrapsCause(t *testing.T) {
+	context := &Context{}
+	cause := &github.ErrorResponse{Message: "Server Error"}
+	err := context.NewError("lgtm: couldn't set status on %s: %v", "o/r#1", cause)
+
+	responseErr, ok := Unwrap(err).(*github.ErrorResponse)
+	if assert.True(t, ok) {
+		assert.Equal(t, "Server Error", responseErr.Message)
+	}
+
+	err = context.NewError("lgtm: not enabled for %s", "o/r")
+	assert.Equal(t, "lgtm: not enabled for o/r", err.Error())
+	assert.Nil(t, Unwrap(err))
+}
@@ -0,0 +1,137 @@
+package ctx
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// dryRunHTMLURL stands in for the URL of whatever a planned action would
+// have created, for the handlers which log it.
+const dryRunHTMLURL = "https://github.com/buntobot/auto-reply#dry-run"
+
+// DryRunTransport makes the GitHub API calls which only read, and reports
+// every other call (merges, labels, comments, statuses, assignees, releases,
+// file commits...) to Planned instead of making it. The planned calls are
+// answered as though they had succeeded.
+type DryRunTransport struct {
+	// Transport makes the calls which only read. http.DefaultTransport is
+	// used if nil.
+	Transport http.RoundTripper
+
+	// Planned is called with each call which wasn't made, e.g.
+	// "POST /repos/bunto/bunto/issues/1/labels [\"has-pull-request\"]".
+	Planned func(action string)
+}
+
+func (t *DryRunTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == "GET" || req.Method == "HEAD" || req.Method == "OPTIONS" {
+		transport := t.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		return transport.RoundTrip(req)
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	action := req.Method + " " + req.URL.Path
+	if trimmed := strings.TrimSpace(string(body)); trimmed != "" {
+		action += " " + trimmed
+	}
+	if t.Planned != nil {
+		t.Planned(action)
+	}
+
+	response := dryRunResponse(body)
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(response)),
+		ContentLength: int64(len(response)),
+		Request:       req,
+	}, nil
+}
+
+// dryRunResponse echoes the object sent in the request, e.g. the title &
+// body of an issue, with placeholders for the fields only GitHub could fill
+// in, so handlers can use the response as usual. Anything else gets an
+// empty response.
+func dryRunResponse(body []byte) []byte {
+	object := map[string]interface{}{}
+	if err := json.Unmarshal(body, &object); err != nil {
+		return nil
+	}
+	placeholders := map[string]interface{}{
+		"id":       0,
+		"number":   0,
+		"html_url": dryRunHTMLURL,
+	}
+	for field, value := range placeholders {
+		if _, ok := object[field]; !ok {
+			object[field] = value
+		}
+	}
+	response, err := json.Marshal(object)
+	if err != nil {
+		return nil
+	}
+	return response
+}
+
+// EnableDryRun swaps the GitHub client of c for one which logs the calls
+// which would change anything on GitHub as planned actions instead of
+// making them. Contexts derived from c afterwards share the client, and so
+// do the installation clients of its GitHubApp.
+func (c *Context) EnableDryRun() {
+	dryRun := func(transport http.RoundTripper) http.RoundTripper {
+		return &DryRunTransport{
+			Transport: transport,
+			Planned: func(action string) {
+				c.IncrStat("github.dry_run.planned")
+				c.Log("dry-run: would %s", action)
+			},
+		}
+	}
+
+	base := c.baseTransport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	// As newTransport does, use the app's installation unless there's only
+	// a token to authenticate with. Its transports are wrapped already.
+	var transport http.RoundTripper
+	if app := c.GitHubApp; app != nil {
+		app.wrapTransport(dryRun)
+		if usesInstallation(app) {
+			transport = app.clientTransport(app.InstallationID)
+		}
+	}
+	if transport == nil {
+		transport = dryRun(githubTransport(base))
+	}
+	c.gitHubTransport = transport
+	client := github.NewClient(&http.Client{Transport: c.gitHubTransport})
+	if c.GitHub != nil {
+		client.BaseURL = c.GitHub.BaseURL
+		client.UploadURL = c.GitHub.UploadURL
+	}
+	c.GitHub = client
+	c.DryRun = true
+}
@@ -0,0 +1,74 @@
+package ctx
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnableDryRun(t *testing.T) {
+	requests := []string{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/bunto/bunto/issues/1", func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		json.NewEncoder(w).Encode(&github.Issue{Number: github.Int(1), Title: github.String("Bug")})
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	context := &Context{GitHub: github.NewClient(nil)}
+	context.GitHub.BaseURL, _ = url.Parse(server.URL + "/")
+	context.EnableDryRun()
+	assert.True(t, context.DryRun)
+	eventContext, cancel := context.WithEvent("delivery-1", time.Minute)
+	defer cancel()
+	assert.True(t, eventContext.DryRun)
+
+	// Reads go through.
+	issue, _, err := eventContext.GitHub.Issues.Get("bunto", "bunto", 1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Bug", *issue.Title)
+	}
+
+	// Writes don't, but look like they did.
+	created, _, err := eventContext.GitHub.Issues.Create("bunto", "bunto", &github.IssueRequest{Title: github.String("Bump")})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Bump", *created.Title)
+		assert.Equal(t, 0, *created.Number)
+		assert.Equal(t, dryRunHTMLURL, *created.HTMLURL)
+	}
+	_, _, err = eventContext.GitHub.Issues.AddLabelsToIssue("bunto", "bunto", 1, []string{"has-pull-request"})
+	assert.NoError(t, err)
+	_, _, err = eventContext.GitHub.PullRequests.Merge("bunto", "bunto", 1, "Merge", nil)
+	assert.NoError(t, err)
+	_, err = eventContext.GitHub.Issues.Lock("bunto", "bunto", 1)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"GET /repos/bunto/bunto/issues/1"}, requests)
+}
+
+func TestDryRunTransportPlans(t *testing.T) {
+	planned := []string{}
+	client := github.NewClient(&http.Client{Transport: &DryRunTransport{
+		Planned: func(action string) { planned = append(planned, action) },
+	}})
+
+	_, _, err := client.Issues.AddLabelsToIssue("bunto", "bunto", 1, []string{"has-pull-request"})
+	assert.NoError(t, err)
+	_, err = client.Issues.RemoveLabelForIssue("bunto", "bunto", 1, "pending-rebase")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{
+		`POST /repos/bunto/bunto/issues/1/labels ["has-pull-request"]`,
+		"DELETE /repos/bunto/bunto/issues/1/labels/pending-rebase",
+	}, planned)
+}
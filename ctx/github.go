@@ -1,42 +1,147 @@
 package ctx
 
 import (
+	"context"
 	"log"
+	"net/http"
 	"os"
+	"sync"
 
+	"github.com/DataDog/datadog-go/statsd"
 	"github.com/google/go-github/github"
 	"golang.org/x/oauth2"
 )
 
 const githubAccessTokenEnvVar = "GITHUB_ACCESS_TOKEN"
 
+// authedUser caches the user the GitHub client is authenticated as.
+type authedUser struct {
+	sync.Mutex // protects 'user'
+	user       *github.User
+}
+
 func (c *Context) GitHubAuthedAs(login string) bool {
 	if c.currentlyAuthedGitHubUser == nil {
+		c.currentlyAuthedGitHubUser = &authedUser{}
+	}
+
+	authed := c.currentlyAuthedGitHubUser
+	authed.Lock()
+	defer authed.Unlock()
+
+	if authed.user == nil && c.GitHubApp != nil {
+		appLogin, err := c.GitHubApp.Login()
+		if err != nil {
+			c.Log("couldn't fetch GitHub App: %v", err)
+			return false
+		}
+		authed.user = &github.User{Login: github.String(appLogin)}
+	}
+
+	if authed.user == nil {
 		currentlyAuthedUser, _, err := c.GitHub.Users.Get("")
 		if err != nil {
 			c.Log("couldn't fetch currently-auth'd user: %v", err)
 			return false
 		}
-		c.currentlyAuthedGitHubUser = currentlyAuthedUser
+		authed.user = currentlyAuthedUser
 	}
 
-	return *c.currentlyAuthedGitHubUser.Login == login
+	return *authed.user.Login == login
 }
 
 func GitHubToken() string {
 	return os.Getenv(githubAccessTokenEnvVar)
 }
 
+// NewClient returns a client authenticated with the GITHUB_ACCESS_TOKEN or
+// as the installation of the GitHub App configured in the environment. An
+// app's installation ID is taken from the environment if set, and its only
+// installation otherwise.
 func NewClient() *github.Client {
-	if token := GitHubToken(); token != "" {
-		return github.NewClient(oauth2.NewClient(
-			oauth2.NoContext,
-			oauth2.StaticTokenSource(
-				&oauth2.Token{AccessToken: GitHubToken()},
-			),
-		))
-	} else {
-		log.Fatalf("%s required", githubAccessTokenEnvVar)
+	base := newBaseTransport(nil)
+	app := GitHubAppFromEnv()
+	if app != nil {
+		app.Transport = base
+	}
+	return newClient(app, newTransport(app, base))
+}
+
+// newTransport returns the transport of the client: that of the app's
+// installation if there's an app, or base authenticated with the
+// GitHubToken otherwise.
+func newTransport(app *GitHubApp, base http.RoundTripper) http.RoundTripper {
+	if usesInstallation(app) {
+		return app.clientTransport(app.InstallationID)
+	}
+	if GitHubToken() == "" {
+		log.Fatalf("%s or %s required", githubAccessTokenEnvVar, githubAppIDEnvVar)
 		return nil
 	}
+	return githubTransport(base)
+}
+
+// usesInstallation returns true if the client authenticates as the app's
+// installation: one is configured, or there's no GitHubToken to use.
+func usesInstallation(app *GitHubApp) bool {
+	return app != nil && (app.InstallationID != 0 || GitHubToken() == "")
+}
+
+func newClient(app *GitHubApp, transport http.RoundTripper) *github.Client {
+	client := github.NewClient(&http.Client{Transport: transport})
+	if app != nil {
+		client.BaseURL = app.baseURL()
+	}
+	return client
+}
+
+// eventClient returns a copy of client which sends its requests with
+// transport, bound to std: they are aborted once std is done.
+func eventClient(client *github.Client, transport http.RoundTripper, std context.Context) *github.Client {
+	bound := github.NewClient(&http.Client{Transport: &eventTransport{Transport: transport, std: std}})
+	bound.BaseURL = client.BaseURL
+	bound.UploadURL = client.UploadURL
+	bound.UserAgent = client.UserAgent
+	return bound
+}
+
+// eventTransport sends requests with Transport, in the context of an event.
+// The vendored go-github predates contexts, so its requests can't carry
+// the event's otherwise.
+type eventTransport struct {
+	Transport http.RoundTripper
+	std       context.Context
+}
+
+func (t *eventTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.Transport.RoundTrip(req.WithContext(t.std))
+}
+
+// newBaseTransport returns the transport beneath the authentication of the
+// GitHub clients: it caches the responses, in GITHUB_CACHE_DIR if set, and
+// waits out the rate limits.
+func newBaseTransport(statsdClient *statsd.Client) http.RoundTripper {
+	cache := &CacheTransport{
+		Transport: &RateLimitTransport{Statsd: statsdClient},
+		Statsd:    statsdClient,
+		Dir:       os.Getenv(githubCacheDirEnvVar),
+	}
+	if cache.Dir != "" {
+		if err := os.MkdirAll(cache.Dir, 0700); err != nil {
+			log.Fatalf("%s: %v", githubCacheDirEnvVar, err)
+		}
+	}
+	return cache
+}
+
+// githubTransport authenticates requests with the GitHubToken, if any, then
+// sends them with base.
+func githubTransport(base http.RoundTripper) http.RoundTripper {
+	if token := GitHubToken(); token != "" {
+		return &oauth2.Transport{
+			Base:   base,
+			Source: oauth2.ReuseTokenSource(nil, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})),
+		}
+	}
+	return base
 }
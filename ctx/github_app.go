@@ -0,0 +1,372 @@
+package ctx
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+const (
+	githubAppIDEnvVar             = "GITHUB_APP_ID"
+	githubAppPrivateKeyEnvVar     = "GITHUB_APP_PRIVATE_KEY"
+	githubAppInstallationIDEnvVar = "GITHUB_APP_INSTALLATION_ID"
+
+	defaultGitHubBaseURL = "https://api.github.com/"
+
+	// GitHub rejects JWTs which expire more than 10 minutes from now.
+	appJWTLifetime = 9 * time.Minute
+	// Installation tokens last an hour; refresh them a little early so a
+	// token doesn't expire in the middle of a handler.
+	installationTokenRefreshMargin = 5 * time.Minute
+
+	// Installation tokens were a preview feature of the API.
+	machineManPreviewMediaType = "application/vnd.github.machine-man-preview+json"
+)
+
+// GitHubApp authenticates as a GitHub App: it signs JWTs with the app's
+// private key and exchanges them for installation tokens, which it refreshes
+// before they expire. Each installation gets its own client.
+type GitHubApp struct {
+	ID int64
+	// InstallationID is the installation used outside of webhooks, e.g. by
+	// the cmd/* utilities. If 0, the app's only installation is used.
+	// Webhooks use the installation they're from.
+	InstallationID int64
+
+	// BaseURL is the GitHub API endpoint; https://api.github.com/ if nil.
+	BaseURL *url.URL
+	// Transport makes the requests of the app & its installations;
+	// http.DefaultTransport if nil.
+	Transport http.RoundTripper
+
+	key *rsa.PrivateKey
+	now func() time.Time
+
+	lock    sync.Mutex // protects the fields below
+	tokens  map[int64]*installationToken
+	clients map[int64]*github.Client
+	// tokenLocks lets a single request create the token of an installation,
+	// without holding up the others.
+	tokenLocks map[int64]*sync.Mutex
+	login      string
+	// defaultInstallationID is InstallationID, or else the app's only
+	// installation once it's known.
+	defaultInstallationID int64
+	// wrap, if set, wraps the transport of the installation clients.
+	wrap func(http.RoundTripper) http.RoundTripper
+}
+
+type installationToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewGitHubApp returns the GitHub App with the given ID, authenticating with
+// its PEM-encoded RSA private key.
+func NewGitHubApp(id int64, privateKey []byte) (*GitHubApp, error) {
+	block, _ := pem.Decode(privateKey)
+	if block == nil {
+		return nil, errors.New("ctx: GitHub App private key isn't PEM-encoded")
+	}
+
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		parsed, pkcs8Err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if pkcs8Err != nil {
+			return nil, fmt.Errorf("ctx: couldn't parse GitHub App private key: %v", err)
+		}
+		rsaKey, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("ctx: GitHub App private key isn't an RSA key")
+		}
+		key = rsaKey
+	}
+
+	return &GitHubApp{
+		ID:         id,
+		key:        key,
+		now:        time.Now,
+		tokens:     map[int64]*installationToken{},
+		clients:    map[int64]*github.Client{},
+		tokenLocks: map[int64]*sync.Mutex{},
+	}, nil
+}
+
+// GitHubAppFromEnv returns the GitHub App configured by the GITHUB_APP_ID,
+// GITHUB_APP_PRIVATE_KEY & GITHUB_APP_INSTALLATION_ID environment
+// variables, or nil if there is none.
+func GitHubAppFromEnv() *GitHubApp {
+	rawID := os.Getenv(githubAppIDEnvVar)
+	if rawID == "" {
+		return nil
+	}
+
+	id, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil {
+		log.Fatalf("%s must be a number: %v", githubAppIDEnvVar, err)
+	}
+	app, err := NewGitHubApp(id, []byte(os.Getenv(githubAppPrivateKeyEnvVar)))
+	if err != nil {
+		log.Fatalf("%s: %v", githubAppPrivateKeyEnvVar, err)
+	}
+	if rawInstallationID := os.Getenv(githubAppInstallationIDEnvVar); rawInstallationID != "" {
+		app.InstallationID, err = strconv.ParseInt(rawInstallationID, 10, 64)
+		if err != nil {
+			log.Fatalf("%s must be a number: %v", githubAppInstallationIDEnvVar, err)
+		}
+	}
+	return app
+}
+
+// JWT returns a token authenticating as the app itself, which is only good
+// for a few endpoints, e.g. to create installation tokens.
+func (a *GitHubApp) JWT() (string, error) {
+	now := a.now()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]int64{
+		// Allow for our clock being ahead of GitHub's.
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": a.ID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Token returns a token for the installation, creating one if the last one
+// is about to expire.
+func (a *GitHubApp) Token(installationID int64) (string, error) {
+	a.lock.Lock()
+	tokenLock, ok := a.tokenLocks[installationID]
+	if !ok {
+		tokenLock = &sync.Mutex{}
+		a.tokenLocks[installationID] = tokenLock
+	}
+	a.lock.Unlock()
+
+	tokenLock.Lock()
+	defer tokenLock.Unlock()
+
+	a.lock.Lock()
+	token, ok := a.tokens[installationID]
+	a.lock.Unlock()
+	if ok && a.now().Add(installationTokenRefreshMargin).Before(token.ExpiresAt) {
+		return token.Token, nil
+	}
+
+	token = &installationToken{}
+	path := fmt.Sprintf("app/installations/%d/access_tokens", installationID)
+	if err := a.appRequest("POST", path, token); err != nil {
+		return "", err
+	}
+	a.lock.Lock()
+	a.tokens[installationID] = token
+	a.lock.Unlock()
+	return token.Token, nil
+}
+
+// DefaultInstallationID returns InstallationID or, if it's unset, the ID of
+// the app's only installation.
+func (a *GitHubApp) DefaultInstallationID() (int64, error) {
+	if a.InstallationID != 0 {
+		return a.InstallationID, nil
+	}
+	a.lock.Lock()
+	id := a.defaultInstallationID
+	a.lock.Unlock()
+	if id != 0 {
+		return id, nil
+	}
+
+	installations := []struct {
+		ID int64 `json:"id"`
+	}{}
+	if err := a.appRequest("GET", "app/installations", &installations); err != nil {
+		return 0, err
+	}
+	if len(installations) != 1 {
+		return 0, fmt.Errorf("ctx: GitHub App %d has %d installations; set %s", a.ID, len(installations), githubAppInstallationIDEnvVar)
+	}
+	a.lock.Lock()
+	a.defaultInstallationID = installations[0].ID
+	a.lock.Unlock()
+	return installations[0].ID, nil
+}
+
+// Client returns the client for the installation. Installation 0 is the
+// default one, see DefaultInstallationID.
+func (a *GitHubApp) Client(installationID int64) *github.Client {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if client, ok := a.clients[installationID]; ok {
+		return client
+	}
+
+	client := github.NewClient(&http.Client{Transport: a.wrapped(installationID)})
+	client.BaseURL = a.baseURL()
+	a.clients[installationID] = client
+	return client
+}
+
+// clientTransport returns the transport of the installation's client.
+func (a *GitHubApp) clientTransport(installationID int64) http.RoundTripper {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.wrapped(installationID)
+}
+
+// wrapped returns the transport of the installation, wrapped by a.wrap if
+// set. a.lock must be held.
+func (a *GitHubApp) wrapped(installationID int64) http.RoundTripper {
+	var transport http.RoundTripper = &installationTransport{app: a, installationID: installationID}
+	if a.wrap != nil {
+		transport = a.wrap(transport)
+	}
+	return transport
+}
+
+// Login returns the login of the app's bot user, e.g. "buntobot[bot]".
+func (a *GitHubApp) Login() (string, error) {
+	a.lock.Lock()
+	login := a.login
+	a.lock.Unlock()
+	if login != "" {
+		return login, nil
+	}
+
+	app := struct {
+		Slug string `json:"slug"`
+	}{}
+	if err := a.appRequest("GET", "app", &app); err != nil {
+		return "", err
+	}
+	a.lock.Lock()
+	a.login = app.Slug + "[bot]"
+	a.lock.Unlock()
+	return app.Slug + "[bot]", nil
+}
+
+// wrapTransport makes the installation clients use the transport returned by
+// wrap. The clients created so far are discarded.
+func (a *GitHubApp) wrapTransport(wrap func(http.RoundTripper) http.RoundTripper) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.wrap = wrap
+	a.clients = map[int64]*github.Client{}
+}
+
+func (a *GitHubApp) transport() http.RoundTripper {
+	if a.Transport != nil {
+		return a.Transport
+	}
+	return http.DefaultTransport
+}
+
+func (a *GitHubApp) baseURL() *url.URL {
+	if a.BaseURL != nil {
+		return a.BaseURL
+	}
+	baseURL, _ := url.Parse(defaultGitHubBaseURL)
+	return baseURL
+}
+
+// appRequest makes a request authenticated as the app, and decodes the
+// response into v. It must be called without a.lock held.
+func (a *GitHubApp) appRequest(method, path string, v interface{}) error {
+	jwt, err := a.JWT()
+	if err != nil {
+		return err
+	}
+	endpoint, err := a.baseURL().Parse(path)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(method, endpoint.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", machineManPreviewMediaType)
+
+	resp, err := a.transport().RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := github.CheckResponse(resp); err != nil {
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// installationTransport authenticates requests as an installation of app.
+type installationTransport struct {
+	app            *GitHubApp
+	installationID int64
+}
+
+func (t *installationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	installationID := t.installationID
+	if installationID == 0 {
+		var err error
+		if installationID, err = t.app.DefaultInstallationID(); err != nil {
+			return nil, err
+		}
+	}
+	token, err := t.app.Token(installationID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The token changes every hour, so the rate limit is kept track of by
+	// installation.
+	authed := cloneRequest(req.WithContext(context.WithValue(req.Context(), installationKey{}, installationID)))
+	authed.Header.Set("Authorization", "token "+token)
+	return t.app.transport().RoundTrip(authed)
+}
+
+// installationKey is the key of the installation ID in the contexts of the
+// requests of an installation.
+type installationKey struct{}
+
+// cloneRequest returns a shallow copy of req with its own headers, so a
+// RoundTripper can set some without changing the caller's request.
+func cloneRequest(req *http.Request) *http.Request {
+	clone := new(http.Request)
+	*clone = *req
+	clone.Header = make(http.Header, len(req.Header))
+	for name, values := range req.Header {
+		clone.Header[name] = append([]string(nil), values...)
+	}
+	return clone
+}
@@ -0,0 +1,249 @@
+package ctx
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestKey(t *testing.T) (*rsa.PrivateKey, []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+// verifyJWT checks the signature of the JWT & returns its claims.
+func verifyJWT(t *testing.T, key *rsa.PublicKey, jwt string) map[string]int64 {
+	parts := strings.Split(jwt, ".")
+	if !assert.Len(t, parts, 3) {
+		return nil
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	assert.NoError(t, err)
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	assert.NoError(t, rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature))
+
+	claims := map[string]int64{}
+	rawClaims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(rawClaims, &claims))
+	return claims
+}
+
+// newStubGitHub serves the app endpoints, issuing tokens which expire after
+// lifetime, and an issue which requires one of those tokens.
+func newStubGitHub(t *testing.T, key *rsa.PublicKey, lifetime time.Duration) (*httptest.Server, *int32) {
+	var exchanges int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/app/installations/42/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		claims := verifyJWT(t, key, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		assert.Equal(t, int64(7), claims["iss"])
+		n := atomic.AddInt32(&exchanges, 1)
+		json.NewEncoder(w).Encode(installationToken{
+			Token:     fmt.Sprintf("v1.token%d", n),
+			ExpiresAt: time.Now().Add(lifetime),
+		})
+	})
+	mux.HandleFunc("/app/installations", func(w http.ResponseWriter, r *http.Request) {
+		verifyJWT(t, key, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		fmt.Fprint(w, `[{"id": 42}]`)
+	})
+	mux.HandleFunc("/app", func(w http.ResponseWriter, r *http.Request) {
+		verifyJWT(t, key, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		fmt.Fprint(w, `{"id": 7, "slug": "buntobot"}`)
+	})
+	mux.HandleFunc("/repos/bunto/bunto/issues/1", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "token v1.token") {
+			http.Error(w, `{"message": "Bad credentials"}`, http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, `{"number": 1, "title": %q}`, r.Header.Get("Authorization"))
+	})
+	return httptest.NewServer(mux), &exchanges
+}
+
+func newTestApp(t *testing.T, privateKey []byte, server *httptest.Server) *GitHubApp {
+	app, err := NewGitHubApp(7, privateKey)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	app.BaseURL, _ = url.Parse(server.URL + "/")
+	return app
+}
+
+func TestGitHubAppJWT(t *testing.T) {
+	key, privateKey := newTestKey(t)
+	app, err := NewGitHubApp(7, privateKey)
+	if !assert.NoError(t, err) {
+		return
+	}
+	now := time.Unix(1500000000, 0)
+	app.now = func() time.Time { return now }
+
+	jwt, err := app.JWT()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{
+		"iat": now.Unix() - 60,
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": 7,
+	}, verifyJWT(t, &key.PublicKey, jwt))
+
+	_, err = NewGitHubApp(7, []byte("not a key"))
+	assert.Error(t, err)
+}
+
+func TestGitHubAppInstallationClient(t *testing.T) {
+	key, privateKey := newTestKey(t)
+	server, exchanges := newStubGitHub(t, &key.PublicKey, time.Hour)
+	defer server.Close()
+	app := newTestApp(t, privateKey, server)
+
+	client := app.Client(42)
+	assert.True(t, client == app.Client(42))
+	for i := 0; i < 2; i++ {
+		issue, _, err := client.Issues.Get("bunto", "bunto", 1)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "token v1.token1", *issue.Title)
+		}
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(exchanges))
+
+	// Without an InstallationID, the default client uses the only one.
+	issue, _, err := app.Client(0).Issues.Get("bunto", "bunto", 1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "token v1.token1", *issue.Title)
+	}
+	id, err := app.DefaultInstallationID()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), id)
+
+	login, err := app.Login()
+	assert.NoError(t, err)
+	assert.Equal(t, "buntobot[bot]", login)
+	context := &Context{GitHub: client, GitHubApp: app}
+	assert.True(t, context.GitHubAuthedAs("buntobot[bot]"))
+}
+
+func TestGitHubAppRefreshesTokens(t *testing.T) {
+	key, privateKey := newTestKey(t)
+	server, exchanges := newStubGitHub(t, &key.PublicKey, installationTokenRefreshMargin+time.Minute)
+	defer server.Close()
+	app := newTestApp(t, privateKey, server)
+
+	token, err := app.Token(42)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.token1", token)
+	token, err = app.Token(42)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.token1", token)
+
+	app.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	token, err = app.Token(42)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.token2", token)
+	assert.Equal(t, int32(2), atomic.LoadInt32(exchanges))
+
+	_, err = app.Token(43)
+	assert.Error(t, err)
+}
+
+func TestGitHubAppDoesntBlockOnTokenRequests(t *testing.T) {
+	_, privateKey := newTestKey(t)
+	started, release := make(chan bool), make(chan bool)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/app/installations/42/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		started <- true
+		<-release
+		json.NewEncoder(w).Encode(installationToken{Token: "v1.slow", ExpiresAt: time.Now().Add(time.Hour)})
+	})
+	mux.HandleFunc("/app", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 7, "slug": "buntobot"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	app := newTestApp(t, privateKey, server)
+
+	tokens := make(chan string)
+	go func() {
+		token, _ := app.Token(42)
+		tokens <- token
+	}()
+	<-started
+
+	// The app is still usable while the token is being created.
+	login, err := app.Login()
+	assert.NoError(t, err)
+	assert.Equal(t, "buntobot[bot]", login)
+	assert.NotNil(t, app.Client(43))
+
+	close(release)
+	assert.Equal(t, "v1.slow", <-tokens)
+}
+
+func TestUseInstallation(t *testing.T) {
+	key, privateKey := newTestKey(t)
+	server, _ := newStubGitHub(t, &key.PublicKey, time.Hour)
+	defer server.Close()
+	app := newTestApp(t, privateKey, server)
+
+	context := &Context{GitHub: github.NewClient(nil), GitHubApp: app}
+	eventContext, cancel := context.WithEvent("delivery-1", time.Minute)
+	eventContext.UseInstallation(42)
+	issue, _, err := eventContext.GitHub.Issues.Get("bunto", "bunto", 1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "token v1.token1", *issue.Title)
+	}
+
+	cancel()
+	_, _, err = eventContext.GitHub.Issues.Get("bunto", "bunto", 1)
+	assert.Error(t, err)
+}
+
+func TestGitHubAppDryRun(t *testing.T) {
+	key, privateKey := newTestKey(t)
+	server, _ := newStubGitHub(t, &key.PublicKey, time.Hour)
+	defer server.Close()
+	app := newTestApp(t, privateKey, server)
+
+	// Without an installation ID nor a token, the client is the app's only
+	// installation's, as it is outside of dry-run mode.
+	defer os.Setenv(githubAccessTokenEnvVar, os.Getenv(githubAccessTokenEnvVar))
+	os.Setenv(githubAccessTokenEnvVar, "")
+
+	context := &Context{GitHub: github.NewClient(nil), GitHubApp: app}
+	context.GitHub.BaseURL = app.BaseURL
+	context.EnableDryRun()
+	_, _, err := app.Client(42).Issues.AddLabelsToIssue("bunto", "bunto", 1, []string{"has-pull-request"})
+	assert.NoError(t, err)
+	issue, _, err := app.Client(42).Issues.Get("bunto", "bunto", 1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, *issue.Number)
+	}
+
+	issue, _, err = context.GitHub.Issues.Get("bunto", "bunto", 1)
+	if assert.NoError(t, err) {
+		assert.Contains(t, *issue.Title, "token v1.token")
+	}
+	_, _, err = context.GitHub.Issues.AddLabelsToIssue("bunto", "bunto", 1, []string{"has-pull-request"})
+	assert.NoError(t, err)
+}
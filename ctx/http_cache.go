@@ -0,0 +1,232 @@
+package ctx
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/DataDog/datadog-go/statsd"
+)
+
+const (
+	githubCacheDirEnvVar = "GITHUB_CACHE_DIR"
+
+	defaultCacheMaxEntries = 1000
+)
+
+// CacheTransport caches the responses to GET requests which have an ETag or
+// a Last-Modified date, and revalidates them with If-None-Match &
+// If-Modified-Since. GitHub answers those with a 304 when nothing changed,
+// which doesn't count against the rate limit, and the cached response is
+// served instead.
+//
+// The most recently used responses are kept in memory and, if Dir is set,
+// on disk so they survive restarts.
+type CacheTransport struct {
+	// Transport makes the requests; http.DefaultTransport if nil.
+	Transport http.RoundTripper
+	// Statsd, if set, counts the hits & misses.
+	Statsd *statsd.Client
+	// MaxEntries is the number of responses kept, 1000 by default.
+	MaxEntries int
+	// Dir, if set, is where the responses are persisted.
+	Dir string
+
+	lock    sync.Mutex // protects the fields below
+	entries map[string]*list.Element
+	// recent holds the entries, most recently used first.
+	recent *list.List
+}
+
+// cacheEntry is a cached response.
+type cacheEntry struct {
+	Key          string      `json:"key"`
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"last_modified,omitempty"`
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+}
+
+func (t *CacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != "GET" || req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return t.transport().RoundTrip(req)
+	}
+
+	key := cacheKey(req)
+	entry := t.get(key)
+	if entry != nil {
+		conditional := cloneRequest(req)
+		if entry.ETag != "" {
+			conditional.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			conditional.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+		req = conditional
+	}
+
+	resp, err := t.transport().RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	if entry != nil && resp.StatusCode == http.StatusNotModified {
+		t.count("github.cache.hit")
+		resp.Body.Close()
+		return entry.response(req, resp.Header), nil
+	}
+	t.count("github.cache.miss")
+
+	if resp.StatusCode != http.StatusOK || (resp.Header.Get("ETag") == "" && resp.Header.Get("Last-Modified") == "") {
+		return resp, nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	t.add(&cacheEntry{
+		Key:          key,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header,
+		Body:         body,
+	})
+	return resp, nil
+}
+
+// response rebuilds the cached response, with the rate limit headers of the
+// 304 which revalidated it.
+func (e *cacheEntry) response(req *http.Request, revalidated http.Header) *http.Response {
+	header := http.Header{}
+	for name, values := range e.Header {
+		header[name] = values
+	}
+	for name, values := range revalidated {
+		if strings.HasPrefix(name, "X-Ratelimit-") {
+			header[name] = values
+		}
+	}
+	header.Set("Content-Length", strconv.Itoa(len(e.Body)))
+
+	return &http.Response{
+		Status:        strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// get returns the entry from memory or, failing that, from disk.
+func (t *CacheTransport) get(key string) *cacheEntry {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if element, ok := t.entries[key]; ok {
+		t.recent.MoveToFront(element)
+		return element.Value.(*cacheEntry)
+	}
+	if t.Dir == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(t.path(key))
+	if err != nil {
+		return nil
+	}
+	entry := &cacheEntry{}
+	if err := json.Unmarshal(data, entry); err != nil || entry.Key != key {
+		return nil
+	}
+	t.insert(entry)
+	return entry
+}
+
+func (t *CacheTransport) add(entry *cacheEntry) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if element, ok := t.entries[entry.Key]; ok {
+		t.recent.Remove(element)
+		delete(t.entries, entry.Key)
+	}
+	t.insert(entry)
+
+	if t.Dir == "" {
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err == nil {
+		err = ioutil.WriteFile(t.path(entry.Key), data, 0600)
+	}
+	if err != nil {
+		log.Printf("ctx: couldn't persist cached GitHub response: %v", err)
+	}
+}
+
+// insert adds the entry to memory, then evicts the least recently used
+// entries beyond the maximum. t.lock must be held.
+func (t *CacheTransport) insert(entry *cacheEntry) {
+	if t.entries == nil {
+		t.entries = map[string]*list.Element{}
+		t.recent = list.New()
+	}
+	t.entries[entry.Key] = t.recent.PushFront(entry)
+
+	for t.recent.Len() > t.maxEntries() {
+		oldest := t.recent.Remove(t.recent.Back()).(*cacheEntry)
+		delete(t.entries, oldest.Key)
+		if t.Dir != "" {
+			os.Remove(t.path(oldest.Key))
+		}
+	}
+}
+
+func (t *CacheTransport) path(key string) string {
+	return filepath.Join(t.Dir, key+".json")
+}
+
+func (t *CacheTransport) count(name string) {
+	if t.Statsd != nil {
+		t.Statsd.Count(name, 1, noTags, countRate)
+	}
+}
+
+func (t *CacheTransport) transport() http.RoundTripper {
+	if t.Transport != nil {
+		return t.Transport
+	}
+	return http.DefaultTransport
+}
+
+func (t *CacheTransport) maxEntries() int {
+	if t.MaxEntries > 0 {
+		return t.MaxEntries
+	}
+	return defaultCacheMaxEntries
+}
+
+// cacheKey tells apart the responses to different URLs, media types &
+// credentials. It is hashed so the credentials don't end up on disk.
+func cacheKey(req *http.Request) string {
+	digest := sha256.Sum256([]byte(rateLimitCredential(req) + "\n" + req.Header.Get("Accept") + "\n" + req.URL.String()))
+	return hex.EncodeToString(digest[:])
+}
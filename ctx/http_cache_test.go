@@ -0,0 +1,136 @@
+package ctx
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+// newLabelServer serves the labels of bunto/bunto#1 with an ETag, which
+// changes when the labels do, and counts the full responses.
+func newLabelServer(labels *string, fullResponses *int) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/bunto/bunto/issues/1/labels", func(w http.ResponseWriter, r *http.Request) {
+		etag := fmt.Sprintf(`"%x"`, *labels)
+		w.Header().Set("X-RateLimit-Remaining", "4999")
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		*fullResponses++
+		w.Header().Set("ETag", etag)
+		fmt.Fprint(w, *labels)
+	})
+	mux.HandleFunc("/repos/bunto/bunto", func(w http.ResponseWriter, r *http.Request) {
+		*fullResponses++
+		fmt.Fprint(w, `{"name": "bunto"}`)
+	})
+	return httptest.NewServer(mux)
+}
+
+func newCachedClient(server *httptest.Server, cache *CacheTransport, token string) *github.Client {
+	client := github.NewClient(&http.Client{Transport: &authTransport{token: token, base: cache}})
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client
+}
+
+type authTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	authed := cloneRequest(req)
+	authed.Header.Set("Authorization", "token "+t.token)
+	return t.base.RoundTrip(authed)
+}
+
+func labelNames(t *testing.T, client *github.Client) []string {
+	labels, resp, err := client.Issues.ListLabelsByIssue("bunto", "bunto", 1, nil)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	assert.Equal(t, 200, resp.StatusCode)
+	names := []string{}
+	for _, label := range labels {
+		names = append(names, *label.Name)
+	}
+	return names
+}
+
+func TestCacheTransportRevalidates(t *testing.T) {
+	labels, fullResponses := `[{"name": "bug"}]`, 0
+	server := newLabelServer(&labels, &fullResponses)
+	defer server.Close()
+	cache := &CacheTransport{}
+	client := newCachedClient(server, cache, "abc")
+
+	assert.Equal(t, []string{"bug"}, labelNames(t, client))
+	assert.Equal(t, []string{"bug"}, labelNames(t, client))
+	assert.Equal(t, 1, fullResponses)
+
+	labels = `[{"name": "bug"}, {"name": "has-pull-request"}]`
+	assert.Equal(t, []string{"bug", "has-pull-request"}, labelNames(t, client))
+	assert.Equal(t, 2, fullResponses)
+
+	// Other credentials get their own responses.
+	assert.Equal(t, []string{"bug", "has-pull-request"}, labelNames(t, newCachedClient(server, cache, "def")))
+	assert.Equal(t, 3, fullResponses)
+
+	// Responses without validators aren't cached.
+	for i := 0; i < 2; i++ {
+		_, _, err := client.Repositories.Get("bunto", "bunto")
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 5, fullResponses)
+}
+
+func TestCacheTransportEvictsLeastRecentlyUsed(t *testing.T) {
+	labels, fullResponses := `[{"name": "bug"}]`, 0
+	server := newLabelServer(&labels, &fullResponses)
+	defer server.Close()
+	cache := &CacheTransport{MaxEntries: 2}
+
+	clients := []*github.Client{}
+	for _, token := range []string{"a", "b", "c"} {
+		clients = append(clients, newCachedClient(server, cache, token))
+	}
+	labelNames(t, clients[0])
+	labelNames(t, clients[1])
+	labelNames(t, clients[0])
+	labelNames(t, clients[2]) // evicts b's
+	assert.Equal(t, 3, fullResponses)
+
+	labelNames(t, clients[0])
+	assert.Equal(t, 3, fullResponses)
+	labelNames(t, clients[1])
+	assert.Equal(t, 4, fullResponses)
+}
+
+func TestCacheTransportPersists(t *testing.T) {
+	dir, err := ioutil.TempDir("", "github-cache")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	labels, fullResponses := `[{"name": "bug"}]`, 0
+	server := newLabelServer(&labels, &fullResponses)
+	defer server.Close()
+
+	labelNames(t, newCachedClient(server, &CacheTransport{Dir: dir}, "abc"))
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	// After a restart.
+	assert.Equal(t, []string{"bug"}, labelNames(t, newCachedClient(server, &CacheTransport{Dir: dir}, "abc")))
+	assert.Equal(t, 1, fullResponses)
+}
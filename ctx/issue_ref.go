@@ -21,12 +21,18 @@ func (r issueRef) IsEmpty() bool {
 	return r.Owner == "" || r.Repo == "" || r.Num == 0
 }
 
+// SetIssue sets the issue or pull request the context refers to. If it's
+// the one already set, e.g. from the webhook payload, its author is kept.
 func (c *Context) SetIssue(owner, repo string, num int) {
-	c.Issue = issueRef{
+	issue := issueRef{
 		Owner: owner,
 		Repo:  repo,
 		Num:   num,
 	}
+	if c.Issue.Owner == owner && c.Issue.Repo == repo && c.Issue.Num == num {
+		issue.Author = c.Issue.Author
+	}
+	c.Issue = issue
 }
 
 func (c *Context) SetAuthor(author string) {
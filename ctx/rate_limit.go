@@ -0,0 +1,287 @@
+package ctx
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-go/statsd"
+)
+
+const (
+	defaultRateLimitMaxWait    = 15 * time.Minute
+	defaultRateLimitMaxRetries = 3
+	// How long to back off from a secondary rate limit which doesn't say.
+	defaultSecondaryRateLimitBackoff = time.Minute
+)
+
+// RateLimitTransport keeps track of the GitHub API rate limits, from the
+// X-RateLimit-* headers of the responses, and holds requests back until
+// the limit resets rather than have GitHub reject them. It also backs off
+// from the secondary rate limits (e.g. on the Search API), as told by the
+// Retry-After header, and retries the requests.
+//
+// The core & search APIs are budgeted separately, and so is every
+// credential, e.g. each installation of a GitHub App.
+type RateLimitTransport struct {
+	// Transport makes the requests; http.DefaultTransport if nil.
+	Transport http.RoundTripper
+	// Statsd, if set, receives the remaining quota as gauges.
+	Statsd *statsd.Client
+
+	// MaxWait is the longest a request is held back, 15 minutes by default.
+	// Requests which would wait longer are sent right away, for GitHub to
+	// reject them.
+	MaxWait time.Duration
+	// MaxRetries is the number of times a request is retried after hitting
+	// a secondary rate limit, 3 by default.
+	MaxRetries int
+
+	now   func() time.Time
+	sleep func(time.Duration)
+
+	lock    sync.Mutex // protects budgets
+	budgets map[budgetKey]*rateBudget
+}
+
+type budgetKey struct {
+	resource   string
+	credential string
+}
+
+// rateBudget is what is left of a rate limit.
+type rateBudget struct {
+	limit     int
+	remaining int
+	reset     time.Time
+	// retryAfter is set when a secondary rate limit was hit.
+	retryAfter time.Time
+}
+
+func (t *RateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := budgetKey{resource: rateLimitResource(req), credential: rateLimitCredential(req)}
+
+	// Keep the body to send it again upon a retry.
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req = rewind(req, body)
+	}
+
+	for attempt := 0; ; attempt++ {
+		if wait := t.reserve(key); wait > 0 {
+			if err := t.wait(req, key.resource, wait); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := t.transport().RoundTrip(req)
+		if err != nil {
+			return resp, err
+		}
+		backoff, limited := t.update(key, resp)
+		if !limited || attempt >= t.maxRetries() {
+			return resp, nil
+		}
+		req = rewind(req, body)
+
+		// Let the next attempt wait out the backoff.
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		t.lock.Lock()
+		t.budget(key).retryAfter = t.timeNow().Add(backoff)
+		t.lock.Unlock()
+	}
+}
+
+// reserve counts the request against its budget, and returns how long it
+// must be held back, if at all.
+func (t *RateLimitTransport) reserve(key budgetKey) time.Duration {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	budget := t.budget(key)
+	now := t.timeNow()
+	var wait time.Duration
+	if budget.retryAfter.After(now) {
+		wait = budget.retryAfter.Sub(now)
+	}
+	if budget.limit > 0 && budget.remaining <= 0 && budget.reset.After(now) && budget.reset.Sub(now) > wait {
+		wait = budget.reset.Sub(now)
+	}
+	if budget.remaining > 0 {
+		budget.remaining--
+	}
+
+	if wait > t.maxWait() {
+		return 0
+	}
+	return wait
+}
+
+// wait holds the request back for the given duration, or until its context
+// is done, in which case it returns the context's error. A request whose
+// deadline would pass in the meantime fails right away instead.
+func (t *RateLimitTransport) wait(req *http.Request, resource string, wait time.Duration) error {
+	if deadline, ok := req.Context().Deadline(); ok && t.timeNow().Add(wait).After(deadline) {
+		return context.DeadlineExceeded
+	}
+	if t.Statsd != nil {
+		t.Statsd.Timing("github.rate_limit.wait", wait, []string{"resource:" + resource}, countRate)
+	}
+	if t.sleep != nil {
+		t.sleep(wait)
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
+
+// update records the rate limit headers of the response. If the request
+// was rejected because of a rate limit, it returns true along with how long
+// to back off for.
+func (t *RateLimitTransport) update(key budgetKey, resp *http.Response) (backoff time.Duration, limited bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := t.timeNow()
+	budget := t.budget(key)
+	limit, hasLimit := headerInt(resp.Header, "X-RateLimit-Limit")
+	remaining, hasRemaining := headerInt(resp.Header, "X-RateLimit-Remaining")
+	reset, hasReset := headerInt(resp.Header, "X-RateLimit-Reset")
+	if hasLimit && hasRemaining && hasReset {
+		budget.limit = limit
+		budget.remaining = remaining
+		budget.reset = time.Unix(int64(reset), 0)
+		t.gauge(key.resource, budget)
+	}
+
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	if retryAfter, ok := headerInt(resp.Header, "Retry-After"); ok {
+		return time.Duration(retryAfter) * time.Second, true
+	}
+	if hasRemaining && remaining == 0 {
+		return budget.reset.Sub(now), true
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return defaultSecondaryRateLimitBackoff, true
+	}
+	// Any other 403 is about permissions.
+	return 0, false
+}
+
+func (t *RateLimitTransport) gauge(resource string, budget *rateBudget) {
+	if t.Statsd == nil {
+		return
+	}
+	tags := []string{"resource:" + resource}
+	t.Statsd.Gauge("github.rate_limit.remaining", float64(budget.remaining), tags, countRate)
+	t.Statsd.Gauge("github.rate_limit.limit", float64(budget.limit), tags, countRate)
+}
+
+// budget returns the budget for the key. The budgets which have reset, and
+// so no longer hold anything back, are dropped as new ones are added.
+// t.lock must be held.
+func (t *RateLimitTransport) budget(key budgetKey) *rateBudget {
+	if t.budgets == nil {
+		t.budgets = map[budgetKey]*rateBudget{}
+	}
+	if _, ok := t.budgets[key]; !ok {
+		now := t.timeNow()
+		for other, budget := range t.budgets {
+			if !budget.reset.After(now) && !budget.retryAfter.After(now) {
+				delete(t.budgets, other)
+			}
+		}
+		t.budgets[key] = &rateBudget{}
+	}
+	return t.budgets[key]
+}
+
+func (t *RateLimitTransport) transport() http.RoundTripper {
+	if t.Transport != nil {
+		return t.Transport
+	}
+	return http.DefaultTransport
+}
+
+func (t *RateLimitTransport) timeNow() time.Time {
+	if t.now != nil {
+		return t.now()
+	}
+	return time.Now()
+}
+
+func (t *RateLimitTransport) maxWait() time.Duration {
+	if t.MaxWait > 0 {
+		return t.MaxWait
+	}
+	return defaultRateLimitMaxWait
+}
+
+func (t *RateLimitTransport) maxRetries() int {
+	if t.MaxRetries > 0 {
+		return t.MaxRetries
+	}
+	return defaultRateLimitMaxRetries
+}
+
+// rateLimitResource returns which rate limit the request counts against.
+func rateLimitResource(req *http.Request) string {
+	if strings.HasPrefix(req.URL.Path, "/search/") || strings.Contains(req.URL.Path, "/api/v3/search/") {
+		return "search"
+	}
+	return "core"
+}
+
+// rateLimitCredential returns who the request counts against. The JWTs of
+// a GitHub App and the tokens of its installations change all the time, but
+// count against the app and the installation.
+func rateLimitCredential(req *http.Request) string {
+	if installationID, ok := req.Context().Value(installationKey{}).(int64); ok {
+		return "installation:" + strconv.FormatInt(installationID, 10)
+	}
+	authorization := req.Header.Get("Authorization")
+	if strings.HasPrefix(authorization, "Bearer ") {
+		return "app"
+	}
+	return authorization
+}
+
+// rewind returns a copy of the request to send again, reading body anew.
+func rewind(req *http.Request, body []byte) *http.Request {
+	retry := cloneRequest(req)
+	if body != nil {
+		retry.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	return retry
+}
+
+func headerInt(header http.Header, name string) (int, bool) {
+	value := header.Get(name)
+	if value == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(value)
+	return n, err == nil
+}
@@ -0,0 +1,203 @@
+package ctx
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+// newRateLimitedClient returns a client whose requests go through a
+// RateLimitTransport with a fake clock, which records how long it waits.
+func newRateLimitedClient(server *httptest.Server, now time.Time) (*github.Client, *RateLimitTransport, *[]time.Duration) {
+	waits := []time.Duration{}
+	transport := &RateLimitTransport{
+		now: func() time.Time { return now },
+		sleep: func(d time.Duration) {
+			waits = append(waits, d)
+			now = now.Add(d)
+		},
+	}
+	client := github.NewClient(&http.Client{Transport: transport})
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client, transport, &waits
+}
+
+func setRateLimitHeaders(w http.ResponseWriter, limit, remaining int, reset time.Time) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+}
+
+func TestRateLimitTransportWaitsForReset(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	reset := now.Add(10 * time.Second)
+
+	remaining := 2
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/bunto/bunto/issues/1", func(w http.ResponseWriter, r *http.Request) {
+		remaining--
+		setRateLimitHeaders(w, 5000, remaining, reset)
+		fmt.Fprint(w, `{"number": 1}`)
+	})
+	mux.HandleFunc("/search/issues", func(w http.ResponseWriter, r *http.Request) {
+		setRateLimitHeaders(w, 30, 29, now.Add(time.Minute))
+		fmt.Fprint(w, `{"total_count": 0}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	client, transport, waits := newRateLimitedClient(server, now)
+
+	for i := 0; i < 2; i++ {
+		_, _, err := client.Issues.Get("bunto", "bunto", 1)
+		assert.NoError(t, err)
+	}
+	assert.Empty(t, *waits)
+
+	// Search has its own budget.
+	_, _, err := client.Search.Issues("is:open", nil)
+	assert.NoError(t, err)
+	assert.Empty(t, *waits)
+
+	// The core budget is spent: wait for it to reset.
+	_, _, err = client.Issues.Get("bunto", "bunto", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Duration{10 * time.Second}, *waits)
+
+	assert.Equal(t, 29, transport.budgets[budgetKey{resource: "search"}].remaining)
+}
+
+func TestRateLimitTransportBacksOffSecondaryLimits(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+
+	attempts := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/bunto/bunto/issues/1/labels", func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		// Retries send the body again.
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.JSONEq(t, `["has-pull-request"]`, string(body))
+		if attempts == 1 {
+			w.Header().Set("Retry-After", "30")
+			http.Error(w, `{"message": "You have triggered an abuse detection mechanism."}`, http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `[{"name": "has-pull-request"}]`)
+	})
+	mux.HandleFunc("/repos/bunto/bunto/issues/2/labels", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, `{"message": "You have triggered an abuse detection mechanism."}`, http.StatusForbidden)
+	})
+	mux.HandleFunc("/repos/bunto/bunto/issues/3/labels", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "Must have push access"}`, http.StatusForbidden)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	client, transport, waits := newRateLimitedClient(server, now)
+	transport.MaxRetries = 2
+
+	labels, _, err := client.Issues.AddLabelsToIssue("bunto", "bunto", 1, []string{"has-pull-request"})
+	if assert.NoError(t, err) && assert.Len(t, labels, 1) {
+		assert.Equal(t, "has-pull-request", *labels[0].Name)
+	}
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, []time.Duration{30 * time.Second}, *waits)
+
+	// Gives up after MaxRetries.
+	*waits = nil
+	_, _, err = client.Issues.AddLabelsToIssue("bunto", "bunto", 2, []string{"has-pull-request"})
+	assert.Error(t, err)
+	assert.Equal(t, []time.Duration{5 * time.Second, 5 * time.Second}, *waits)
+
+	// Other 403s aren't retried.
+	*waits = nil
+	transport.budgets = nil
+	_, _, err = client.Issues.AddLabelsToIssue("bunto", "bunto", 3, []string{"has-pull-request"})
+	assert.Error(t, err)
+	assert.Empty(t, *waits)
+}
+
+func TestRateLimitTransportDoesntWaitTooLong(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/bunto/bunto/issues/1", func(w http.ResponseWriter, r *http.Request) {
+		setRateLimitHeaders(w, 5000, 0, now.Add(time.Hour))
+		fmt.Fprint(w, `{"number": 1}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	client, _, waits := newRateLimitedClient(server, now)
+
+	for i := 0; i < 2; i++ {
+		_, _, err := client.Issues.Get("bunto", "bunto", 1)
+		assert.NoError(t, err)
+	}
+	assert.Empty(t, *waits)
+}
+
+func TestRateLimitCredential(t *testing.T) {
+	req := httptest.NewRequest("GET", "/app", nil)
+	req.Header.Set("Authorization", "Bearer abc.def.ghi")
+	assert.Equal(t, "app", rateLimitCredential(req))
+	req.Header.Set("Authorization", "token v1.abc")
+	assert.Equal(t, "token v1.abc", rateLimitCredential(req))
+
+	// Installation tokens rotate, so count against the installation.
+	req = req.WithContext(context.WithValue(req.Context(), installationKey{}, int64(42)))
+	assert.Equal(t, "installation:42", rateLimitCredential(req))
+}
+
+func TestRateLimitTransportDropsResetBudgets(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	transport := &RateLimitTransport{now: func() time.Time { return now }}
+	transport.budget(budgetKey{resource: "core", credential: "token v1.old"}).reset = now.Add(time.Minute)
+	transport.budget(budgetKey{resource: "core", credential: "token v1.older"}).reset = now.Add(-time.Minute)
+
+	transport.budget(budgetKey{resource: "core", credential: "token v1.new"})
+	assert.Len(t, transport.budgets, 2)
+	assert.NotNil(t, transport.budgets[budgetKey{resource: "core", credential: "token v1.old"}])
+}
+
+func TestRateLimitTransportStopsWaitingWhenCancelled(t *testing.T) {
+	transport := &RateLimitTransport{}
+	key := budgetKey{resource: "core"}
+	budget := transport.budget(key)
+	budget.limit, budget.reset = 5000, time.Now().Add(10*time.Minute)
+
+	std, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest("GET", "/repos/bunto/bunto/issues/1", nil).WithContext(std)
+	_, err := transport.RoundTrip(req)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestRateLimitTransportDoesntWaitPastTheEvent(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, `{"number": 1}`)
+	}))
+	defer server.Close()
+
+	transport := &RateLimitTransport{}
+	budget := transport.budget(budgetKey{resource: "core"})
+	budget.limit, budget.reset = 5000, time.Now().Add(10*time.Minute)
+	parent := &Context{GitHub: github.NewClient(nil), gitHubTransport: transport}
+	parent.GitHub.BaseURL, _ = url.Parse(server.URL + "/")
+
+	eventContext, cancel := parent.WithEvent("delivery-1", time.Minute)
+	defer cancel()
+	start := time.Now()
+	_, _, err := eventContext.GitHub.Issues.Get("bunto", "bunto", 1)
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < time.Second, "waited past the event's deadline")
+	assert.Equal(t, 0, requests)
+}
@@ -2,6 +2,7 @@ package ctx
 
 import (
 	"log"
+	"time"
 
 	"github.com/DataDog/datadog-go/statsd"
 )
@@ -26,7 +27,17 @@ func (c *Context) IncrStat(name string) {
 }
 
 func (c *Context) CountStat(name string, value int64) {
+	c.CountStatWithTags(name, value, noTags)
+}
+
+func (c *Context) CountStatWithTags(name string, value int64, tags []string) {
+	if c.Statsd != nil {
+		c.Statsd.Count(name, value, tags, countRate)
+	}
+}
+
+func (c *Context) TimingStat(name string, value time.Duration, tags []string) {
 	if c.Statsd != nil {
-		c.Statsd.Count(name, value, noTags, countRate)
+		c.Statsd.Timing(name, value, tags, countRate)
 	}
 }
@@ -0,0 +1,194 @@
+// deliverylog records every webhook delivery the bot receives, so that a
+// misbehaving handler can be debugged, and regression-tested, against the
+// real payload with cmd/replay-webhook.
+//
+// Each delivery is a JSON file in the log's directory. Only the most recent
+// deliveries are kept; the oldest ones are removed as new ones come in.
+package deliverylog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxDeliveries is the number of deliveries kept by a Log opened
+	// with a max of 0.
+	DefaultMaxDeliveries = 1000
+
+	fileTimeFormat = "20060102T150405.000000000"
+)
+
+// redactedHeaders are not recorded.
+var redactedHeaders = []string{"Authorization", "Cookie"}
+
+// Delivery is a webhook delivery as received from GitHub.
+type Delivery struct {
+	// ID is the X-GitHub-Delivery header of the webhook.
+	ID         string      `json:"id"`
+	EventType  string      `json:"event_type"`
+	Headers    http.Header `json:"headers"`
+	Payload    []byte      `json:"payload"`
+	ReceivedAt time.Time   `json:"received_at"`
+}
+
+// NewDelivery builds a Delivery from the webhook request & its payload.
+func NewDelivery(r *http.Request, id string, payload []byte) *Delivery {
+	headers := http.Header{}
+	for name, values := range r.Header {
+		headers[name] = values
+	}
+	for _, name := range redactedHeaders {
+		headers.Del(name)
+	}
+
+	return &Delivery{
+		ID:         id,
+		EventType:  r.Header.Get("X-GitHub-Event"),
+		Headers:    headers,
+		Payload:    payload,
+		ReceivedAt: time.Now(),
+	}
+}
+
+type Log struct {
+	dir string
+	max int
+
+	lock sync.Mutex // protects the files
+}
+
+// Open returns a log which stores up to max deliveries in dir, creating the
+// directory if necessary.
+func Open(dir string, max int) (*Log, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if max <= 0 {
+		max = DefaultMaxDeliveries
+	}
+	return &Log{dir: dir, max: max}, nil
+}
+
+// Record stores the delivery, then removes the oldest deliveries beyond the
+// maximum.
+func (l *Log) Record(delivery *Delivery) error {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	name := delivery.ReceivedAt.UTC().Format(fileTimeFormat) + "-" + sanitize(delivery.ID) + ".json"
+	if err := ioutil.WriteFile(filepath.Join(l.dir, name), data, 0644); err != nil {
+		return err
+	}
+	return l.rotate()
+}
+
+// Get returns the delivery with the given ID.
+func (l *Log) Get(id string) (*Delivery, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	names, err := l.names()
+	if err != nil {
+		return nil, err
+	}
+	// The latest delivery wins, should GitHub have redelivered it.
+	suffix := "-" + sanitize(id) + ".json"
+	for i := len(names) - 1; i >= 0; i-- {
+		if strings.Index(names[i], "-") == len(names[i])-len(suffix) && strings.HasSuffix(names[i], suffix) {
+			return read(filepath.Join(l.dir, names[i]))
+		}
+	}
+	return nil, fmt.Errorf("deliverylog: no delivery %s in %s", id, l.dir)
+}
+
+// List returns every stored delivery, oldest first.
+func (l *Log) List() ([]*Delivery, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	names, err := l.names()
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := []*Delivery{}
+	for _, name := range names {
+		delivery, err := read(filepath.Join(l.dir, name))
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+// rotate removes the oldest deliveries beyond the maximum. l.lock must be
+// held.
+func (l *Log) rotate() error {
+	names, err := l.names()
+	if err != nil {
+		return err
+	}
+	for len(names) > l.max {
+		if err := os.Remove(filepath.Join(l.dir, names[0])); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// names returns the file names of the deliveries, oldest first. l.lock must
+// be held.
+func (l *Log) names() ([]string, error) {
+	files, err := ioutil.ReadDir(l.dir)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), ".json") {
+			names = append(names, file.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func read(path string) (*Delivery, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	delivery := &Delivery{}
+	if err := json.Unmarshal(data, delivery); err != nil {
+		return nil, fmt.Errorf("deliverylog: %s: %v", path, err)
+	}
+	return delivery, nil
+}
+
+// sanitize makes the ID safe to use in a file name.
+func sanitize(id string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, id)
+}
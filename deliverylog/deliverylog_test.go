@@ -0,0 +1,93 @@
+package deliverylog
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLog(t *testing.T, max int) (*Log, func()) {
+	dir, err := ioutil.TempDir("", "deliverylog")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	l, err := Open(dir, max)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return l, func() { os.RemoveAll(dir) }
+}
+
+func newTestDelivery(id string, receivedAt time.Time) *Delivery {
+	return &Delivery{ID: id, EventType: "issues", Payload: []byte(`{"action":"opened"}`), ReceivedAt: receivedAt}
+}
+
+func TestNewDeliveryRedactsHeaders(t *testing.T) {
+	payload := `{"action": "opened"}`
+	req := httptest.NewRequest("POST", "/_github/bunto", strings.NewReader(payload))
+	req.Header.Set("X-GitHub-Event", "issues")
+	req.Header.Set("X-Hub-Signature", "sha1=abc")
+	req.Header.Set("Authorization", "token secret")
+	req.Header.Set("Cookie", "session=secret")
+
+	delivery := NewDelivery(req, "delivery-1", []byte(payload))
+	assert.Equal(t, "delivery-1", delivery.ID)
+	assert.Equal(t, "issues", delivery.EventType)
+	assert.Equal(t, payload, string(delivery.Payload))
+	assert.Equal(t, "sha1=abc", delivery.Headers.Get("X-Hub-Signature"))
+	assert.Empty(t, delivery.Headers.Get("Authorization"))
+	assert.Empty(t, delivery.Headers.Get("Cookie"))
+	assert.Equal(t, "token secret", req.Header.Get("Authorization"))
+}
+
+func TestLogRecordAndGet(t *testing.T) {
+	l, teardown := newTestLog(t, 0)
+	defer teardown()
+
+	now := time.Now()
+	assert.NoError(t, l.Record(newTestDelivery("abc-1", now)))
+	assert.NoError(t, l.Record(newTestDelivery("1", now.Add(time.Second))))
+	redelivered := newTestDelivery("abc-1", now.Add(2*time.Second))
+	redelivered.Payload = []byte(`{"action":"closed"}`)
+	assert.NoError(t, l.Record(redelivered))
+
+	delivery, err := l.Get("abc-1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, `{"action":"closed"}`, string(delivery.Payload))
+		assert.WithinDuration(t, redelivered.ReceivedAt, delivery.ReceivedAt, 0)
+	}
+	delivery, err = l.Get("1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "1", delivery.ID)
+	}
+	_, err = l.Get("abc")
+	assert.Error(t, err)
+}
+
+func TestLogRotates(t *testing.T) {
+	l, teardown := newTestLog(t, 2)
+	defer teardown()
+
+	now := time.Now()
+	for i, id := range []string{"first", "second", "third"} {
+		assert.NoError(t, l.Record(newTestDelivery(id, now.Add(time.Duration(i)*time.Second))))
+	}
+
+	deliveries, err := l.List()
+	if assert.NoError(t, err) && assert.Len(t, deliveries, 2) {
+		assert.Equal(t, "second", deliveries[0].ID)
+		assert.Equal(t, "third", deliveries[1].ID)
+	}
+	_, err = l.Get("first")
+	assert.Error(t, err)
+}
+
+func TestSanitize(t *testing.T) {
+	assert.Equal(t, "72d3162e-cc78-11e3-81ab-4c9367dc0958", sanitize("72d3162e-cc78-11e3-81ab-4c9367dc0958"))
+	assert.Equal(t, "______etc_passwd", sanitize("../../etc/passwd"))
+}
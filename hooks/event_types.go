@@ -1,5 +1,11 @@
 package hooks
 
+import (
+	"encoding/json"
+
+	"github.com/google/go-github/github"
+)
+
 type EventType string
 
 var (
@@ -23,6 +29,7 @@ var (
 	ReleaseEvent                  EventType = "release"
 	RepositoryEvent               EventType = "repository"
 	StatusEvent                   EventType = "status"
+	TeamEvent                     EventType = "team"
 	TeamAddEvent                  EventType = "team_add"
 	WatchEvent                    EventType = "watch"
 
@@ -33,6 +40,85 @@ func (e EventType) String() string {
 	return string(e)
 }
 
+// TeamEventPayload is the payload of a "team" event, which go-github can't
+// parse yet. Action is "created", "deleted", "edited",
+// "added_to_repository" or "removed_from_repository".
+type TeamEventPayload struct {
+	Action *string              `json:"action,omitempty"`
+	Team   *github.Team         `json:"team,omitempty"`
+	Repo   *github.Repository   `json:"repository,omitempty"`
+	Org    *github.Organization `json:"organization,omitempty"`
+	Sender *github.User         `json:"sender,omitempty"`
+}
+
+// parseWebHook is github.ParseWebHook, plus the events go-github doesn't
+// know of.
+func parseWebHook(eventType string, payload []byte) (interface{}, error) {
+	if EventType(eventType) == TeamEvent {
+		event := &TeamEventPayload{}
+		return event, json.Unmarshal(payload, event)
+	}
+	return github.ParseWebHook(eventType, payload)
+}
+
 type pingEventPayload struct {
 	Zen string `json:"zen"`
 }
+
+// repoEventPayload is the subset of every repository event payload which
+// identifies the repository, and the issue or pull request if any.
+type repoEventPayload struct {
+	Repository *struct {
+		Name  string `json:"name"`
+		Owner struct {
+			Login string `json:"login"`
+		} `json:"owner"`
+	} `json:"repository"`
+	// Organization is set by events on an organization, e.g. membership
+	// events, which needn't carry a repository.
+	Organization *struct {
+		Login string `json:"login"`
+	} `json:"organization"`
+	Number      int           `json:"number"`
+	Issue       *issuePayload `json:"issue"`
+	PullRequest *issuePayload `json:"pull_request"`
+	// Before is set by pushes, including "synchronize" pull_request events.
+	Before string `json:"before"`
+	// Installation is set when the webhook is for a GitHub App.
+	Installation *struct {
+		ID int64 `json:"id"`
+	} `json:"installation"`
+}
+
+// issuePayload is the subset of an issue or pull request payload which
+// identifies it and its author.
+type issuePayload struct {
+	Number int `json:"number"`
+	User   *struct {
+		Login string `json:"login"`
+	} `json:"user"`
+}
+
+// issueAuthor returns the login of the author of the issue or pull request
+// the event refers to, or "". It's not the sender, who e.g. commented.
+func (p repoEventPayload) issueAuthor() string {
+	for _, issue := range []*issuePayload{p.Issue, p.PullRequest} {
+		if issue != nil && issue.User != nil {
+			return issue.User.Login
+		}
+	}
+	return ""
+}
+
+// issueNumber returns the number of the issue or pull request the event
+// refers to, or 0.
+func (p repoEventPayload) issueNumber() int {
+	switch {
+	case p.Issue != nil:
+		return p.Issue.Number
+	case p.PullRequest != nil:
+		return p.PullRequest.Number
+	default:
+		return p.Number
+	}
+}
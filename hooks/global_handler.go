@@ -1,16 +1,26 @@
 package hooks
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/google/go-github/github"
 	"github.com/buntobot/auto-reply/ctx"
+	"github.com/buntobot/auto-reply/deliverylog"
+	"github.com/buntobot/auto-reply/queue"
 )
 
+// defaultEventTimeout is the EventTimeout of a GlobalHandler which doesn't
+// set one.
+const defaultEventTimeout = 10 * time.Minute
+
 type EventHandlerMap map[EventType][]EventHandler
 
 func (m EventHandlerMap) AddHandler(eventType EventType, handler EventHandler) {
@@ -24,9 +34,37 @@ func (m EventHandlerMap) AddHandler(eventType EventType, handler EventHandler) {
 // GlobalHandler is a handy handler which can take in every event,
 // choose which handlers to fire, and fires them.
 type GlobalHandler struct {
+	// Context holds the clients shared by every event. Each event gets its
+	// own context derived from it, and each handler a copy of that.
 	Context       *ctx.Context
 	EventHandlers EventHandlerMap
 
+	// EventTimeout is the deadline of the context given to the handlers of
+	// an event. Defaults to 10 minutes.
+	EventTimeout time.Duration
+
+	// Queue, if set with UseQueue, persists deliveries and retries their
+	// handlers. Otherwise handlers are fired right away, and a failure is
+	// only logged.
+	Queue *queue.Queue
+
+	// DeliveryLog, if set, records every delivery so it can be replayed
+	// with cmd/replay-webhook.
+	DeliveryLog *deliverylog.Log
+
+	// OnResult, if set, is called with the result of every handler fired.
+	// Results are also reported to statsd and logged.
+	OnResult func(Result)
+
+	// RepoEventHandlers are fired in addition to EventHandlers, but only for
+	// events on a given organization (keyed by "owner") or repository (keyed
+	// by "owner/name").
+	RepoEventHandlers map[string]EventHandlerMap
+
+	// handlersLock protects EventHandlers and RepoEventHandlers, so that
+	// they can be swapped out by SetEventHandlers while events come in.
+	handlersLock sync.RWMutex
+
 	// secret is the secret used by GitHub to validate the integrity of the
 	// request. It is given to GitHub in the webhook management interface.
 	secret []byte
@@ -58,10 +96,22 @@ func (h *GlobalHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 // HandlePayload handles the actual unpacking of the payload and firing of the proper handlers.
-// It will never respond with anything but a 200.
+// It will never respond with anything but a 200, unless a Queue is used and
+// the delivery couldn't be persisted.
 func (h *GlobalHandler) HandlePayload(w http.ResponseWriter, r *http.Request, payload []byte) {
 	eventType := github.WebHookType(r)
 
+	requestID := r.Header.Get("X-GitHub-Delivery")
+	if requestID == "" {
+		requestID = newRequestID()
+	}
+
+	if h.DeliveryLog != nil {
+		if err := h.DeliveryLog.Record(deliverylog.NewDelivery(r, requestID, payload)); err != nil {
+			log.Printf("GlobalHandler.HandlePayload: couldn't record delivery %s: %+v", requestID, err)
+		}
+	}
+
 	if eventType == "ping" {
 		handlePingPayload(w, r, payload)
 		return
@@ -71,49 +121,203 @@ func (h *GlobalHandler) HandlePayload(w http.ResponseWriter, r *http.Request, pa
 		log.Printf("payload: %s %s", eventType, string(payload))
 	}
 
-	if handlers, ok := h.EventHandlers[EventType(eventType)]; ok {
-		numHandlers := h.FireHandlers(handlers, eventType, payload)
+	if h.Queue != nil {
+		h.queuePayload(w, requestID, eventType, payload)
+		return
+	}
+
+	if handlers := h.handlersFor(EventType(eventType), payload); len(handlers) > 0 {
+		numHandlers := h.FireHandlers(requestID, handlers, eventType, payload)
 
 		if EventType(eventType) == PullRequestEvent {
-			if issueCommentHandlers, ok := h.EventHandlers[EventType(eventType)]; ok {
-				numHandlers += h.FireHandlers(issueCommentHandlers, "issue_comment", payload)
+			h.handlersLock.RLock()
+			issueCommentHandlers, ok := h.EventHandlers[EventType(eventType)]
+			h.handlersLock.RUnlock()
+			if ok {
+				numHandlers += h.FireHandlers(requestID, issueCommentHandlers, "issue_comment", payload)
 			}
 		}
 
 		fmt.Fprintf(w, "fired %d handlers", numHandlers)
 	} else {
-		h.Context.IncrStat("handler.invalid")
-		errMessage := fmt.Sprintf("unhandled event type: %s", eventType)
-		log.Printf("%s; handled events: %+v", errMessage, h.AcceptedEventTypes())
-		http.Error(w, errMessage, 200)
+		h.handleUnhandledEvent(w, eventType)
 	}
 
 	return
 }
 
-func (h *GlobalHandler) FireHandlers(handlers []EventHandler, eventType string, payload []byte) int {
+func (h *GlobalHandler) handleUnhandledEvent(w http.ResponseWriter, eventType string) {
+	h.Context.IncrStat("handler.invalid")
+	errMessage := fmt.Sprintf("unhandled event type: %s", eventType)
+	log.Printf("%s; handled events: %+v", errMessage, h.AcceptedEventTypes())
+	http.Error(w, errMessage, 200)
+}
+
+// HandlerKeys describes the handlers which would fire for the event, e.g.
+// "issues:lgtm.(*Handler).PullRequestHandler".
+func (h *GlobalHandler) HandlerKeys(eventType string, payload []byte) []string {
+	keys := []string{}
+	for _, f := range h.firingsFor(eventType, payload) {
+		keys = append(keys, f.key)
+	}
+	return keys
+}
+
+// HandleDelivery fires the handlers for the event one after the other, and
+// returns their results once they have all returned. It is meant for
+// replaying recorded deliveries; webhooks go through HandlePayload.
+func (h *GlobalHandler) HandleDelivery(requestID, eventType string, payload []byte) []Result {
+	results := []Result{}
+	for _, f := range h.firingsFor(eventType, payload) {
+		event, err := parseWebHook(f.eventType, payload)
+		if err != nil {
+			h.Context.NewError("GlobalHandler.HandleDelivery: couldn't parse webhook %s: %+v", requestID, err)
+			continue
+		}
+		context, cancel := h.newEventContext(requestID, payload)
+		results = append(results, h.runHandler(context, f.eventType, f.handler, event))
+		cancel()
+	}
+	return results
+}
+
+// FireHandlers fires each handler in its own goroutine. The handlers share a
+// context derived for this event, cancelled once they have all returned,
+// but each gets its own copy so they can't overwrite each other's refs.
+func (h *GlobalHandler) FireHandlers(requestID string, handlers []EventHandler, eventType string, payload []byte) int {
 	h.Context.IncrStat("handler." + eventType)
-	event, err := github.ParseWebHook(eventType, payload)
+	event, err := parseWebHook(eventType, payload)
 	if err != nil {
-		h.Context.NewError("FireHandlers: couldn't parse webhook: %+v", err)
+		h.Context.NewError("FireHandlers: couldn't parse webhook %s: %+v", requestID, err)
 		return 0
 	}
+
+	eventContext, cancel := h.newEventContext(requestID, payload)
+	var wg sync.WaitGroup
 	for _, handler := range handlers {
-		go handler(h.Context, event)
+		wg.Add(1)
+		go func(handler EventHandler) {
+			defer wg.Done()
+			h.runHandler(eventContext.Copy(), eventType, handler, event)
+		}(handler)
 	}
+	go func() {
+		wg.Wait()
+		cancel()
+	}()
 	return len(handlers)
 }
 
+// newEventContext derives the context of an event from h.Context, with the
+// repo & issue refs of the payload already set. Webhooks for a GitHub App
+// get the client of their installation.
+func (h *GlobalHandler) newEventContext(requestID string, payload []byte) (*ctx.Context, func()) {
+	timeout := h.EventTimeout
+	if timeout <= 0 {
+		timeout = defaultEventTimeout
+	}
+	context, cancel := h.Context.WithEvent(requestID, timeout)
+
+	var event repoEventPayload
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return context, cancel
+	}
+	context.Before = event.Before
+	if context.GitHubApp != nil && event.Installation != nil {
+		context.UseInstallation(event.Installation.ID)
+	}
+	if event.Repository == nil {
+		return context, cancel
+	}
+	owner, name := event.Repository.Owner.Login, event.Repository.Name
+	context.SetRepo(owner, name)
+	if number := event.issueNumber(); number > 0 {
+		context.SetIssue(owner, name, number)
+		context.SetAuthor(event.issueAuthor())
+	}
+	return context, cancel
+}
+
+// handlersFor returns the handlers which should fire for the given event
+// type & payload: all of EventHandlers plus any RepoEventHandlers for the
+// payload's organization and repository.
+func (h *GlobalHandler) handlersFor(eventType EventType, payload []byte) []EventHandler {
+	handlers := []EventHandler{}
+	for _, scoped := range h.scopedHandlersFor(eventType, payload) {
+		handlers = append(handlers, scoped.handler)
+	}
+	return handlers
+}
+
+// scopedHandler is a handler along with the key of the RepoEventHandlers it
+// was added to, or "" for EventHandlers.
+type scopedHandler struct {
+	scope   string
+	handler EventHandler
+}
+
+// scopedHandlersFor is handlersFor, telling which scope each handler fires
+// for.
+func (h *GlobalHandler) scopedHandlersFor(eventType EventType, payload []byte) []scopedHandler {
+	h.handlersLock.RLock()
+	defer h.handlersLock.RUnlock()
+
+	handlers := []scopedHandler{}
+	add := func(scope string, eventHandlers []EventHandler) {
+		for _, handler := range eventHandlers {
+			handlers = append(handlers, scopedHandler{scope: scope, handler: handler})
+		}
+	}
+	add("", h.EventHandlers[eventType])
+
+	if len(h.RepoEventHandlers) == 0 {
+		return handlers
+	}
+
+	owner, name := repoFromPayload(payload)
+	if owner == "" {
+		return handlers
+	}
+	add(owner, h.RepoEventHandlers[owner][eventType])
+	if name != "" {
+		add(owner+"/"+name, h.RepoEventHandlers[owner+"/"+name][eventType])
+	}
+	return handlers
+}
+
 // AcceptedEventTypes returns an array of all event types the GlobalHandler
 // can accept.
 func (h *GlobalHandler) AcceptedEventTypes() []EventType {
+	h.handlersLock.RLock()
+	defer h.handlersLock.RUnlock()
+
+	seen := map[EventType]bool{}
 	keys := []EventType{}
 	for k := range h.EventHandlers {
+		seen[k] = true
 		keys = append(keys, k)
 	}
+	for _, repoHandlers := range h.RepoEventHandlers {
+		for k := range repoHandlers {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
 	return keys
 }
 
+// SetEventHandlers atomically replaces EventHandlers and RepoEventHandlers.
+// Events which are already being handled finish with the old handlers.
+func (h *GlobalHandler) SetEventHandlers(eventHandlers EventHandlerMap, repoEventHandlers map[string]EventHandlerMap) {
+	h.handlersLock.Lock()
+	defer h.handlersLock.Unlock()
+
+	h.EventHandlers = eventHandlers
+	h.RepoEventHandlers = repoEventHandlers
+}
+
 func (h *GlobalHandler) getSecret() []byte {
 	if len(h.secret) > 0 {
 		return h.secret
@@ -126,6 +330,33 @@ func (h *GlobalHandler) getSecret() []byte {
 	return h.secret
 }
 
+// repoFromPayload extracts the owner and name of the repository a webhook
+// payload refers to, if any. Events on an organization rather than one of
+// its repositories, e.g. membership events, only have an owner.
+func repoFromPayload(payload []byte) (owner, name string) {
+	var event repoEventPayload
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return "", ""
+	}
+	if event.Repository == nil {
+		if event.Organization != nil {
+			return event.Organization.Login, ""
+		}
+		return "", ""
+	}
+	return event.Repository.Owner.Login, event.Repository.Name
+}
+
+// newRequestID returns a random ID for requests which lack an
+// X-GitHub-Delivery header.
+func newRequestID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(id)
+}
+
 func handlePingPayload(w http.ResponseWriter, r *http.Request, payload []byte) {
 	var ping pingEventPayload
 	if err := json.Unmarshal(payload, &ping); err != nil {
@@ -0,0 +1,203 @@
+package hooks
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/buntobot/auto-reply/deliverylog"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func noopHandler(context *ctx.Context, event interface{}) error {
+	return nil
+}
+
+func TestGlobalHandlerHandlersFor(t *testing.T) {
+	handler := &GlobalHandler{
+		EventHandlers: EventHandlerMap{
+			IssuesEvent: {noopHandler},
+		},
+		RepoEventHandlers: map[string]EventHandlerMap{
+			"octo":     {IssuesEvent: {noopHandler}, PushEvent: {noopHandler}},
+			"octo/cat": {IssuesEvent: {noopHandler, noopHandler}},
+		},
+	}
+
+	cases := []struct {
+		eventType EventType
+		payload   string
+		expected  int
+	}{
+		{IssuesEvent, `{}`, 1},
+		{IssuesEvent, `{"repository": {"name": "dog", "owner": {"login": "bunto"}}}`, 1},
+		{IssuesEvent, `{"repository": {"name": "dog", "owner": {"login": "octo"}}}`, 2},
+		{IssuesEvent, `{"repository": {"name": "cat", "owner": {"login": "octo"}}}`, 4},
+		{PushEvent, `{"repository": {"name": "cat", "owner": {"login": "octo"}}}`, 1},
+		{PushEvent, `{"repository": {"name": "cat", "owner": {"login": "bunto"}}}`, 0},
+		{PushEvent, `{"organization": {"login": "octo"}}`, 1},
+		{StatusEvent, `not json`, 0},
+	}
+	for _, test := range cases {
+		assert.Len(t, handler.handlersFor(test.eventType, []byte(test.payload)), test.expected,
+			"%s with payload %s", test.eventType, test.payload)
+	}
+
+	assert.Len(t, handler.AcceptedEventTypes(), 2)
+}
+
+func TestGlobalHandlerFireHandlersScopesContexts(t *testing.T) {
+	handler := &GlobalHandler{Context: &ctx.Context{}}
+
+	contexts := make(chan *ctx.Context, 2)
+	release := make(chan bool)
+	recordContext := func(context *ctx.Context, event interface{}) error {
+		context.SetAuthor("someone-else")
+		contexts <- context
+		<-release
+		return nil
+	}
+
+	payload := []byte(`{
+		"action": "opened",
+		"issue": {"number": 12},
+		"repository": {"name": "cat", "owner": {"login": "octo"}},
+		"sender": {"login": "parkr"}
+	}`)
+	fired := handler.FireHandlers("delivery-1", []EventHandler{recordContext, recordContext}, "issues", payload)
+	assert.Equal(t, 2, fired)
+
+	first, second := <-contexts, <-contexts
+	assert.False(t, first == second, "each handler should get its own context")
+	for _, context := range []*ctx.Context{first, second} {
+		assert.Equal(t, "delivery-1", context.RequestID)
+		assert.Equal(t, "octo/cat", context.Repo.String())
+		assert.Equal(t, "octo/cat#12", context.Issue.String())
+		_, hasDeadline := context.Deadline()
+		assert.True(t, hasDeadline)
+		assert.NoError(t, context.Err())
+	}
+	assert.Empty(t, handler.Context.Issue.Author)
+
+	close(release)
+	select {
+	case <-first.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the event context should be cancelled once every handler returned")
+	}
+}
+
+func TestNewEventContextUsesPayloadRefs(t *testing.T) {
+	handler := &GlobalHandler{Context: &ctx.Context{}}
+
+	context, cancel := handler.newEventContext("abc", []byte(`{
+		"number": 3,
+		"before": "0ld5ha",
+		"pull_request": {"number": 3, "user": {"login": "octocat"}},
+		"repository": {"name": "cat", "owner": {"login": "octo"}},
+		"sender": {"login": "parkr"}
+	}`))
+	defer cancel()
+	assert.Equal(t, "octo/cat#3", context.Issue.String())
+	assert.Equal(t, "octocat", context.Issue.Author, "the author is the PR's, not the sender")
+	assert.Equal(t, "0ld5ha", context.Before)
+
+	context, cancel = handler.newEventContext("def", []byte(`{"zen": "Keep it logically awesome."}`))
+	defer cancel()
+	assert.Empty(t, context.Before)
+	assert.True(t, context.Repo.IsEmpty())
+	assert.True(t, context.Issue.IsEmpty())
+}
+
+func TestNewEventContextUsesInstallationClient(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if !assert.NoError(t, err) {
+		return
+	}
+	app, err := ctx.NewGitHubApp(7, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	handler := &GlobalHandler{Context: &ctx.Context{GitHub: github.NewClient(nil), GitHubApp: app}}
+
+	context, cancel := handler.newEventContext("abc", []byte(`{
+		"installation": {"id": 42},
+		"repository": {"name": "cat", "owner": {"login": "octo"}}
+	}`))
+	defer cancel()
+	assert.False(t, context.GitHub == handler.Context.GitHub)
+	assert.Equal(t, app.Client(42).BaseURL, context.GitHub.BaseURL)
+	assert.Equal(t, "octo/cat", context.Repo.String())
+
+	context, cancel = handler.newEventContext("def", []byte(`{"zen": "Keep it logically awesome."}`))
+	defer cancel()
+	assert.True(t, context.GitHub == handler.Context.GitHub)
+}
+
+func TestParseWebHookParsesTeamEvents(t *testing.T) {
+	event, err := parseWebHook("team", []byte(`{"action": "edited", "team": {"id": 77, "slug": "documentation"}, "organization": {"login": "bunto"}}`))
+	if assert.NoError(t, err) && assert.IsType(t, &TeamEventPayload{}, event) {
+		assert.Equal(t, "edited", *event.(*TeamEventPayload).Action)
+		assert.Equal(t, 77, *event.(*TeamEventPayload).Team.ID)
+	}
+
+	event, err = parseWebHook("issues", []byte(`{"action": "opened"}`))
+	assert.NoError(t, err)
+	assert.IsType(t, &github.IssuesEvent{}, event)
+}
+
+func TestGlobalHandlerRecordsAndReplaysDeliveries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hooks-deliverylog")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	deliveryLog, err := deliverylog.Open(dir, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	fired := make(chan *ctx.Context, 2)
+	recordContext := func(context *ctx.Context, event interface{}) error {
+		fired <- context
+		return nil
+	}
+	handler := &GlobalHandler{
+		Context:       &ctx.Context{},
+		DeliveryLog:   deliveryLog,
+		EventHandlers: EventHandlerMap{IssuesEvent: {recordContext}},
+	}
+
+	payload := `{"action": "opened", "issue": {"number": 1}, "repository": {"name": "cat", "owner": {"login": "octo"}}}`
+	req := httptest.NewRequest("POST", "/_github", strings.NewReader(payload))
+	req.Header.Set("X-GitHub-Event", "issues")
+	req.Header.Set("X-GitHub-Delivery", "delivery-1")
+	handler.HandlePayload(httptest.NewRecorder(), req, []byte(payload))
+	<-fired
+
+	delivery, err := deliveryLog.Get("delivery-1")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "issues", delivery.EventType)
+	assert.Equal(t, payload, string(delivery.Payload))
+
+	assert.Len(t, handler.HandlerKeys(delivery.EventType, delivery.Payload), 1)
+	results := handler.HandleDelivery(delivery.ID, delivery.EventType, delivery.Payload)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, Succeeded, results[0].Outcome)
+		assert.Equal(t, "octo/cat", results[0].Repo)
+	}
+	context := <-fired
+	assert.Equal(t, "delivery-1", context.RequestID)
+	assert.Equal(t, "octo/cat#1", context.Issue.String())
+}
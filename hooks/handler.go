@@ -2,6 +2,9 @@ package hooks
 
 import (
 	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
 
 	"github.com/buntobot/auto-reply/ctx"
 )
@@ -13,3 +16,14 @@ type HookHandler interface {
 
 // EventHandler is An event handler takes in a given event and operates on it.
 type EventHandler func(context *ctx.Context, event interface{}) error
+
+// HandlerName returns the name of the function or method behind handler,
+// without its import path, e.g. "lgtm.(*Handler).PullRequestReviewHandler".
+func HandlerName(handler EventHandler) string {
+	name := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
+	name = strings.TrimSuffix(name, "-fm")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
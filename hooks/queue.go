@@ -0,0 +1,151 @@
+package hooks
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/buntobot/auto-reply/queue"
+	"github.com/google/go-github/github"
+)
+
+// firing is a handler to fire for an event, along with the event type its
+// payload is parsed as.
+type firing struct {
+	// key tells the handler apart from the others fired for the event, even
+	// after a restart or a reload of the handlers, e.g.
+	// "issues:lgtm.(*Handler).PullRequestHandler@bunto/bunto" for a handler
+	// added for the bunto/bunto repo.
+	key       string
+	eventType string
+	handler   EventHandler
+}
+
+// firingsFor returns every handler HandlePayload would fire for the event.
+func (h *GlobalHandler) firingsFor(eventType string, payload []byte) []firing {
+	firings := []firing{}
+	seen := map[string]int{}
+	add := func(eventType string, handlers []scopedHandler) {
+		for _, scoped := range handlers {
+			key := eventType + ":" + HandlerName(scoped.handler)
+			if scoped.scope != "" {
+				key += "@" + scoped.scope
+			}
+			// A handler added twice to the same scope is told apart by
+			// its position.
+			seen[key]++
+			if seen[key] > 1 {
+				key = fmt.Sprintf("%s#%d", key, seen[key])
+			}
+			firings = append(firings, firing{key: key, eventType: eventType, handler: scoped.handler})
+		}
+	}
+
+	handlers := h.scopedHandlersFor(EventType(eventType), payload)
+	if len(handlers) == 0 {
+		return firings
+	}
+	add(eventType, handlers)
+
+	if EventType(eventType) == PullRequestEvent {
+		h.handlersLock.RLock()
+		issueCommentHandlers := []scopedHandler{}
+		for _, handler := range h.EventHandlers[PullRequestEvent] {
+			issueCommentHandlers = append(issueCommentHandlers, scopedHandler{handler: handler})
+		}
+		h.handlersLock.RUnlock()
+		add("issue_comment", issueCommentHandlers)
+	}
+	return firings
+}
+
+// UseQueue makes h persist every delivery to q before responding to GitHub,
+// then run its handlers with q's workers. Handlers which fail because of
+// GitHub or the network are retried, and those which fail otherwise are
+// dead-lettered right away. Deliveries left pending by a previous run are
+// resumed.
+func (h *GlobalHandler) UseQueue(q *queue.Queue, workers int) error {
+	q.Run = h.runTask
+	q.Retryable = isRetryable
+	h.Queue = q
+	return q.Start(workers)
+}
+
+// queuePayload persists the delivery with a task per handler, and only
+// responds with a 200 once it is safely on disk.
+func (h *GlobalHandler) queuePayload(w http.ResponseWriter, requestID, eventType string, payload []byte) {
+	firings := h.firingsFor(eventType, payload)
+	if len(firings) == 0 {
+		h.handleUnhandledEvent(w, eventType)
+		return
+	}
+
+	delivery := &queue.Delivery{
+		ID:         requestID,
+		EventType:  eventType,
+		Payload:    payload,
+		ReceivedAt: time.Now(),
+	}
+	counted := map[string]bool{}
+	for _, f := range firings {
+		delivery.Tasks = append(delivery.Tasks, &queue.Task{Key: f.key})
+		if !counted[f.eventType] {
+			h.Context.IncrStat("handler." + f.eventType)
+			counted[f.eventType] = true
+		}
+	}
+
+	if err := h.Queue.Push(delivery); err != nil {
+		h.Context.IncrStat("queue.push.error")
+		log.Printf("GlobalHandler.HandlePayload: couldn't queue delivery %s: %+v", requestID, err)
+		http.Error(w, "couldn't queue the delivery", http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "queued %d handlers", len(firings))
+}
+
+// runTask fires the handler of the task, as currently configured. The task
+// is done once the handler succeeds or skips the event.
+func (h *GlobalHandler) runTask(delivery *queue.Delivery, task *queue.Task) error {
+	for _, f := range h.firingsFor(delivery.EventType, delivery.Payload) {
+		if f.key != task.Key {
+			continue
+		}
+
+		event, err := parseWebHook(f.eventType, delivery.Payload)
+		if err != nil {
+			return h.Context.NewError("GlobalHandler.runTask: couldn't parse webhook %s: %+v", delivery.ID, err)
+		}
+		context, cancel := h.newEventContext(delivery.ID, delivery.Payload)
+		defer cancel()
+		result := h.runHandler(context, f.eventType, f.handler, event)
+		if result.Outcome == Skipped {
+			// The handler doesn't apply to the event: nothing is left to do.
+			return nil
+		}
+		return result.Err
+	}
+	h.Context.Log("GlobalHandler.runTask: %s is no longer configured for delivery %s", task.Key, delivery.ID)
+	return nil
+}
+
+// isRetryable returns true if err was caused by GitHub being unavailable or
+// rate limiting us, or by the network. Other errors, e.g. a 404, wouldn't
+// go away by trying again.
+func isRetryable(err error) bool {
+	for ; err != nil; err = ctx.Unwrap(err) {
+		switch cause := err.(type) {
+		case *github.RateLimitError, *github.AbuseRateLimitError:
+			return true
+		case *github.ErrorResponse:
+			return cause.Response != nil &&
+				(cause.Response.StatusCode >= 500 || cause.Response.StatusCode == http.StatusTooManyRequests)
+		case net.Error:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package hooks
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/buntobot/auto-reply/queue"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+type testHandler struct{}
+
+func (h *testHandler) Handle(context *ctx.Context, event interface{}) error {
+	return nil
+}
+
+func TestHandlerName(t *testing.T) {
+	assert.Equal(t, "hooks.noopHandler", HandlerName(noopHandler))
+	assert.Equal(t, "hooks.(*testHandler).Handle", HandlerName((&testHandler{}).Handle))
+}
+
+func TestFiringsForKeysDuplicates(t *testing.T) {
+	handler := &GlobalHandler{
+		EventHandlers: EventHandlerMap{
+			PullRequestEvent: {noopHandler, noopHandler},
+		},
+	}
+
+	keys := []string{}
+	for _, f := range handler.firingsFor("pull_request", []byte(`{}`)) {
+		keys = append(keys, f.key)
+	}
+	assert.Equal(t, []string{
+		"pull_request:hooks.noopHandler",
+		"pull_request:hooks.noopHandler#2",
+		"issue_comment:hooks.noopHandler",
+		"issue_comment:hooks.noopHandler#2",
+	}, keys)
+	assert.Empty(t, handler.firingsFor("issues", []byte(`{}`)))
+}
+
+func TestFiringsForKeysHandlersByScope(t *testing.T) {
+	handler := &GlobalHandler{
+		RepoEventHandlers: map[string]EventHandlerMap{
+			"bunto":    {MembershipEvent: {noopHandler}},
+			"buntobot": {MembershipEvent: {noopHandler}},
+		},
+	}
+
+	keys := func(org string) []string {
+		keys := []string{}
+		for _, f := range handler.firingsFor("membership", []byte(`{"organization": {"login": "`+org+`"}}`)) {
+			keys = append(keys, f.key)
+		}
+		return keys
+	}
+	assert.Equal(t, []string{"membership:hooks.noopHandler@buntobot"}, keys("buntobot"))
+
+	// Dropping an org leaves the keys of the others as they were.
+	delete(handler.RepoEventHandlers, "bunto")
+	assert.Equal(t, []string{"membership:hooks.noopHandler@buntobot"}, keys("buntobot"))
+	assert.Empty(t, keys("bunto"))
+}
+
+func TestIsRetryable(t *testing.T) {
+	context := &ctx.Context{}
+	response := func(code int) *http.Response {
+		return &http.Response{StatusCode: code, Request: &http.Request{Method: "GET", URL: &url.URL{}}}
+	}
+	cases := []struct {
+		err       error
+		retryable bool
+	}{
+		{errors.New("lgtm: not enabled for o/r"), false},
+		{context.NewError("MergeAndLabel: error merging: %v", &github.ErrorResponse{Response: response(502)}), true},
+		{context.NewError("MergeAndLabel: error merging: %v", &github.ErrorResponse{Response: response(405)}), false},
+		{context.NewError("couldn't comment: %v", &github.RateLimitError{Response: response(403)}), true},
+		{context.NewError("couldn't comment: %v", &url.Error{Op: "Get", URL: "https://api.github.com", Err: errors.New("timeout")}), true},
+		{context.NewError("retrying: %v", context.NewError("merging: %v", &github.ErrorResponse{Response: response(503)})), true},
+		{context.NewError("affinity: %v", ctx.Errorf("couldn't list the files: %v", &github.ErrorResponse{Response: response(502)})), true},
+	}
+	for _, test := range cases {
+		assert.Equal(t, test.retryable, isRetryable(test.err), "%v", test.err)
+	}
+}
+
+func TestRunTaskCompletesSkippedTasks(t *testing.T) {
+	skipping := func(context *ctx.Context, event interface{}) error {
+		return context.NewSkip("skipping: not enabled")
+	}
+	failing := func(context *ctx.Context, event interface{}) error {
+		return context.NewError("failing: %v", errors.New("boom"))
+	}
+	handler := &GlobalHandler{
+		Context:       &ctx.Context{},
+		EventHandlers: EventHandlerMap{IssuesEvent: {skipping, failing}},
+	}
+	delivery := &queue.Delivery{ID: "delivery-1", EventType: "issues", Payload: []byte(`{"action": "opened"}`)}
+
+	firings := handler.firingsFor("issues", delivery.Payload)
+	if assert.Len(t, firings, 2) {
+		assert.NoError(t, handler.runTask(delivery, &queue.Task{Key: firings[0].key}))
+		assert.Error(t, handler.runTask(delivery, &queue.Task{Key: firings[1].key}))
+	}
+	assert.NoError(t, handler.runTask(delivery, &queue.Task{Key: "issues:gone"}))
+}
+
+func TestGlobalHandlerQueuesDeliveries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hooks-queue")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := queue.Open(dir)
+	if !assert.NoError(t, err) {
+		return
+	}
+	q.Backoff = time.Millisecond
+
+	attempts := make(chan *ctx.Context, 10)
+	tries := 0
+	flaky := func(context *ctx.Context, event interface{}) error {
+		tries++
+		attempts <- context
+		if tries == 1 {
+			return context.NewError("flaky: %v", &url.Error{Op: "Get", URL: "https://api.github.com", Err: errors.New("EOF")})
+		}
+		return nil
+	}
+
+	handler := &GlobalHandler{
+		Context:       &ctx.Context{},
+		EventHandlers: EventHandlerMap{IssuesEvent: {flaky}},
+	}
+	assert.NoError(t, handler.UseQueue(q, 1))
+
+	payload := `{"action": "opened", "issue": {"number": 1}, "repository": {"name": "cat", "owner": {"login": "octo"}}}`
+	req := httptest.NewRequest("POST", "/_github", strings.NewReader(payload))
+	req.Header.Set("X-GitHub-Event", "issues")
+	req.Header.Set("X-GitHub-Delivery", "delivery-1")
+	w := httptest.NewRecorder()
+	handler.HandlePayload(w, req, []byte(payload))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "queued 1 handlers", w.Body.String())
+
+	for i := 0; i < 2; i++ {
+		select {
+		case context := <-attempts:
+			assert.Equal(t, "delivery-1", context.RequestID)
+			assert.Equal(t, "octo/cat#1", context.Issue.String())
+		case <-time.After(2 * time.Second):
+			t.Fatalf("attempt %d never happened", i+1)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package hooks
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/buntobot/auto-reply/ctx"
+)
+
+// Outcome is what came of firing a handler for an event.
+type Outcome string
+
+const (
+	// Succeeded means the handler acted upon the event.
+	Succeeded Outcome = "succeeded"
+	// Skipped means the handler doesn't apply to the event, which it tells
+	// by returning an error from ctx.Context.NewSkip.
+	Skipped Outcome = "skipped"
+	// Failed means the handler returned any other error.
+	Failed Outcome = "failed"
+)
+
+// Result is reported by the GlobalHandler for every handler it fires.
+type Result struct {
+	RequestID string
+	EventType string
+	Handler   string
+	// The "owner/name" of the repo the event is about, if any.
+	Repo    string
+	Outcome Outcome
+	// The reason for the skip, or the cause of the failure.
+	Err      error
+	Duration time.Duration
+}
+
+// OutcomeOf classifies the error returned by a handler.
+func OutcomeOf(err error) Outcome {
+	switch {
+	case err == nil:
+		return Succeeded
+	case ctx.IsSkip(err):
+		return Skipped
+	default:
+		return Failed
+	}
+}
+
+// runHandler fires the handler, then reports & returns its result.
+func (h *GlobalHandler) runHandler(context *ctx.Context, eventType string, handler EventHandler, event interface{}) Result {
+	start := time.Now()
+	err := handler(context, event)
+
+	result := Result{
+		RequestID: context.RequestID,
+		EventType: eventType,
+		Handler:   HandlerName(handler),
+		Outcome:   OutcomeOf(err),
+		Err:       err,
+		Duration:  time.Since(start),
+	}
+	if !context.Repo.IsEmpty() {
+		result.Repo = context.Repo.String()
+	}
+	h.report(result)
+
+	return result
+}
+
+// report emits the result as statsd metrics tagged by handler, repo and
+// outcome, and as a JSON log record, then hands it to OnResult.
+func (h *GlobalHandler) report(result Result) {
+	tags := []string{
+		"handler:" + result.Handler,
+		"event:" + result.EventType,
+		"outcome:" + string(result.Outcome),
+	}
+	if result.Repo != "" {
+		tags = append(tags, "repo:"+result.Repo)
+	}
+	h.Context.CountStatWithTags("handler.result", 1, tags)
+	h.Context.TimingStat("handler.duration", result.Duration, tags)
+
+	if record, err := json.Marshal(result.logRecord()); err == nil {
+		log.Println(string(record))
+	}
+
+	if h.OnResult != nil {
+		h.OnResult(result)
+	}
+}
+
+type resultRecord struct {
+	RequestID  string  `json:"request_id"`
+	EventType  string  `json:"event"`
+	Handler    string  `json:"handler"`
+	Repo       string  `json:"repo,omitempty"`
+	Outcome    Outcome `json:"outcome"`
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+func (r Result) logRecord() resultRecord {
+	record := resultRecord{
+		RequestID:  r.RequestID,
+		EventType:  r.EventType,
+		Handler:    r.Handler,
+		Repo:       r.Repo,
+		Outcome:    r.Outcome,
+		DurationMS: float64(r.Duration) / float64(time.Millisecond),
+	}
+	if r.Err != nil {
+		record.Error = r.Err.Error()
+	}
+	return record
+}
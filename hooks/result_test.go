@@ -0,0 +1,78 @@
+package hooks
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func skippingHandler(context *ctx.Context, event interface{}) error {
+	return context.NewSkip("skippingHandler: not a LGTM comment")
+}
+
+func failingHandler(context *ctx.Context, event interface{}) error {
+	return context.NewError("failingHandler: couldn't set status: %v", errors.New("502 Bad Gateway"))
+}
+
+func TestOutcomeOf(t *testing.T) {
+	context := &ctx.Context{}
+	assert.Equal(t, Succeeded, OutcomeOf(nil))
+	assert.Equal(t, Skipped, OutcomeOf(context.NewSkip("not enabled for %s", "o/r")))
+	assert.Equal(t, Failed, OutcomeOf(context.NewError("not enabled for %s", "o/r")))
+	assert.Equal(t, Failed, OutcomeOf(errors.New("boom")))
+}
+
+func TestGlobalHandlerReportsResults(t *testing.T) {
+	results := make(chan Result, 3)
+	handler := &GlobalHandler{
+		Context:  &ctx.Context{},
+		OnResult: func(result Result) { results <- result },
+	}
+
+	payload := []byte(`{"action": "opened", "issue": {"number": 1}, "repository": {"name": "cat", "owner": {"login": "octo"}}}`)
+	handler.FireHandlers("delivery-1", []EventHandler{noopHandler, skippingHandler, failingHandler}, "issues", payload)
+
+	collected := map[string]Result{}
+	for i := 0; i < 3; i++ {
+		select {
+		case result := <-results:
+			collected[result.Handler] = result
+		case <-time.After(time.Second):
+			t.Fatalf("only got %d results", i)
+		}
+	}
+
+	names := []string{}
+	for name, result := range collected {
+		names = append(names, name)
+		assert.Equal(t, "delivery-1", result.RequestID)
+		assert.Equal(t, "issues", result.EventType)
+		assert.Equal(t, "octo/cat", result.Repo)
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"hooks.failingHandler", "hooks.noopHandler", "hooks.skippingHandler"}, names)
+
+	assert.Equal(t, Succeeded, collected["hooks.noopHandler"].Outcome)
+	assert.NoError(t, collected["hooks.noopHandler"].Err)
+	assert.Equal(t, Skipped, collected["hooks.skippingHandler"].Outcome)
+	assert.EqualError(t, collected["hooks.skippingHandler"].Err, "skippingHandler: not a LGTM comment")
+	assert.Equal(t, Failed, collected["hooks.failingHandler"].Outcome)
+}
+
+func TestResultLogRecord(t *testing.T) {
+	record := Result{
+		RequestID: "abc",
+		EventType: "issues",
+		Handler:   "hooks.noopHandler",
+		Outcome:   Failed,
+		Err:       errors.New("boom"),
+		Duration:  1500 * time.Microsecond,
+	}.logRecord()
+	assert.Equal(t, "boom", record.Error)
+	assert.Equal(t, 1.5, record.DurationMS)
+	assert.Empty(t, record.Repo)
+}
@@ -0,0 +1,31 @@
+// githubtest serves mock GitHub API responses to the tests of the handlers.
+package githubtest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/google/go-github/github"
+)
+
+// Setup starts a test server, and returns its mux, a context whose GitHub
+// client talks to it as buntobot, and a func closing it. Tests should
+// register handlers on mux which provide mock responses for the API method
+// being tested.
+func Setup() (*http.ServeMux, *ctx.Context, func()) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	client := github.NewClient(nil)
+	url, _ := url.Parse(server.URL)
+	client.BaseURL = url
+	client.UploadURL = url
+
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"login": "buntobot"}`)
+	})
+
+	return mux, &ctx.Context{GitHub: client}, server.Close
+}
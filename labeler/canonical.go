@@ -0,0 +1,105 @@
+package labeler
+
+import (
+	"strings"
+
+	"github.com/buntobot/auto-reply/freeze"
+	"github.com/google/go-github/github"
+)
+
+// CanonicalLabels are the labels every repo of the org should have, unless
+// the configuration file lists its own. cmd/unify-labels creates them, and
+// they're the only ones the label commands apply.
+var CanonicalLabels = []*github.Label{
+	{Name: github.String("accepted"), Color: github.String("4bc865")},
+	{Name: github.String("bug"), Color: github.String("d41313")},
+	{Name: github.String("discussion"), Color: github.String("006b75")},
+	{Name: github.String("documentation"), Color: github.String("006b75")},
+	{Name: github.String("enhancement"), Color: github.String("009800")},
+	{Name: github.String("feature"), Color: github.String("009800")},
+	{Name: github.String("fix"), Color: github.String("eb6420")},
+	{Name: github.String(freeze.LabelName), Color: github.String("0052cc")},
+	{Name: github.String("github"), Color: github.String("222222")},
+	{Name: github.String("has-pull-request"), Color: github.String("fbca04")},
+	{Name: github.String("help-wanted"), Color: github.String("fbca04")},
+	{Name: github.String("internal"), Color: github.String("ededed")},
+	{Name: github.String("pending-feedback"), Color: github.String("fbca04")},
+	{Name: github.String("pending-rebase"), Color: github.String("eb6420")},
+	{Name: github.String("pinned"), Color: github.String("f3f4d3")},
+	{Name: github.String("release"), Color: github.String("d4c5f9")},
+	{Name: github.String("security"), Color: github.String("e11d21")},
+	{Name: github.String("stale"), Color: github.String("bfd4f2")},
+	{Name: github.String("suggestion"), Color: github.String("0052cc")},
+	{Name: github.String("support"), Color: github.String("5319e7")},
+	{Name: github.String("tests"), Color: github.String("d4c5f9")},
+	{Name: github.String("undetermined"), Color: github.String("fe3868")},
+	{Name: github.String("ux"), Color: github.String("006b75")},
+	{Name: github.String("windows"), Color: github.String("fbca04")},
+	{Name: github.String("wont-fix"), Color: github.String("e11d21")},
+}
+
+// LabelNames returns the names of the labels.
+func LabelNames(labels []*github.Label) []string {
+	names := []string{}
+	for _, label := range labels {
+		names = append(names, *label.Name)
+	}
+	return names
+}
+
+// canonicalName returns the label of names which name refers to, allowing
+// for case and for spaces in place of dashes or the other way around, e.g.
+// "help-wanted" for "Help Wanted".
+func canonicalName(name string, names []string) (string, bool) {
+	normalized := normalizeName(name)
+	for _, candidate := range names {
+		if normalizeName(candidate) == normalized {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+func normalizeName(name string) string {
+	return strings.Replace(strings.ToLower(strings.TrimSpace(name)), " ", "-", -1)
+}
+
+// closestName returns the label of names closest to name, by edit
+// distance, or "" if none is close enough to be what was meant.
+func closestName(name string, names []string) string {
+	name = strings.ToLower(name)
+	closest, best := "", len(name)/2+1
+	for _, candidate := range names {
+		if distance := editDistance(name, strings.ToLower(candidate)); distance < best {
+			closest, best = candidate, distance
+		}
+	}
+	return closest
+}
+
+// editDistance is the Levenshtein distance between a & b.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j-1] + cost
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,135 @@
+package labeler
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/buntobot/auto-reply/affinity"
+	"github.com/buntobot/auto-reply/auth"
+	"github.com/buntobot/auto-reply/commands"
+	"github.com/buntobot/auto-reply/ctx"
+)
+
+// UntriagedLabel marks the issues nobody has triaged yet. /triage removes it.
+const UntriagedLabel = "undetermined"
+
+// LabelCommands returns the /label, /unlabel & /triage commands, which let
+// triagers without push access label issues & pull requests with the labels
+// of names, e.g. those of CanonicalLabels. Affinity team captains & users
+// with triage access may run them; a repo's policy can also list triagers by
+// login, e.g. "user:parkr".
+func LabelCommands(names []string) []commands.Command {
+	roles := []auth.Role{auth.PermissionRole(auth.TriagePermission), affinity.CaptainRole}
+	args := []commands.Arg{{Name: "labels", Rest: true}}
+	return []commands.Command{
+		{
+			Name:    "label",
+			Summary: "adds the labels, e.g. `/label bug windows`.",
+			Args:    args,
+			Roles:   roles,
+			Handler: labelCommandHandler(names, addLabels),
+		},
+		{
+			Name:    "unlabel",
+			Summary: "removes the labels.",
+			Args:    args,
+			Roles:   roles,
+			Handler: labelCommandHandler(names, removeLabels),
+		},
+		{
+			Name:    "triage",
+			Summary: fmt.Sprintf("adds the labels and removes `%s`.", UntriagedLabel),
+			Args:    args,
+			Roles:   roles,
+			Handler: labelCommandHandler(names, triage),
+		},
+	}
+}
+
+// labelAction applies the labels to the issue or pull request.
+type labelAction func(context *ctx.Context, invocation *commands.Invocation, labels []string) error
+
+// labelCommandHandler checks the labels given to the command are all known
+// before applying them, and suggests the closest known label otherwise.
+func labelCommandHandler(names []string, apply labelAction) commands.Handler {
+	return func(context *ctx.Context, invocation *commands.Invocation) error {
+		labels := []string{}
+		for _, name := range splitLabels(invocation.Arg("labels")) {
+			label, ok := canonicalName(name, names)
+			if !ok {
+				context.IncrStat("labeler.unknown_label")
+				message := fmt.Sprintf("`%s` isn't one of our labels, so I didn't change any.", name)
+				if closest := closestName(name, names); closest != "" {
+					message += fmt.Sprintf(" Did you mean `%s`?", closest)
+				}
+				if err := invocation.Reply(context, message); err != nil {
+					context.Log("ERROR replying to %s: %v", invocation, err)
+				}
+				return context.NewSkip("labeler: %s: unknown label %q", invocation, name)
+			}
+			labels = append(labels, label)
+		}
+
+		if err := apply(context, invocation, labels); err != nil {
+			return context.NewError("labeler: %s: couldn't apply %q: %v", invocation, labels, err)
+		}
+		context.Log("labeler: %s applied %q", invocation, labels)
+		return nil
+	}
+}
+
+// splitLabels splits the argument of a label command into labels: at commas
+// if there are any, e.g. "help wanted, windows", and at spaces otherwise,
+// except within quotes, e.g. `"help wanted" windows`.
+func splitLabels(arg string) []string {
+	labels := []string{}
+	if strings.Contains(arg, ",") {
+		for _, label := range strings.Split(arg, ",") {
+			if label = strings.Trim(strings.TrimSpace(label), `"'`); label != "" {
+				labels = append(labels, label)
+			}
+		}
+		return labels
+	}
+
+	var label []rune
+	var quote rune
+	for _, r := range arg + " " {
+		switch {
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && unicode.IsSpace(r):
+			if len(label) > 0 {
+				labels = append(labels, string(label))
+			}
+			label = nil
+		default:
+			label = append(label, r)
+		}
+	}
+	return labels
+}
+
+func addLabels(context *ctx.Context, invocation *commands.Invocation, labels []string) error {
+	return AddLabels(context.GitHub, invocation.Owner, invocation.Repo, invocation.Number, labels)
+}
+
+func removeLabels(context *ctx.Context, invocation *commands.Invocation, labels []string) error {
+	present := []string{}
+	for _, label := range labels {
+		if IssueHasLabel(context.GitHub, invocation.Owner, invocation.Repo, invocation.Number, label) {
+			present = append(present, label)
+		}
+	}
+	return RemoveLabels(context.GitHub, invocation.Owner, invocation.Repo, invocation.Number, present)
+}
+
+func triage(context *ctx.Context, invocation *commands.Invocation, labels []string) error {
+	if err := addLabels(context, invocation, labels); err != nil {
+		return err
+	}
+	return removeLabels(context, invocation, []string{UntriagedLabel})
+}
@@ -0,0 +1,108 @@
+package labeler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/buntobot/auto-reply/commands"
+	"github.com/buntobot/auto-reply/internal/githubtest"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalName(t *testing.T) {
+	names := LabelNames(CanonicalLabels)
+	label, ok := canonicalName("Help Wanted", names)
+	assert.True(t, ok)
+	assert.Equal(t, "help-wanted", label)
+	_, ok = canonicalName("help", names)
+	assert.False(t, ok)
+
+	assert.Equal(t, "documentation", closestName("documentaion", names))
+	assert.Equal(t, "bug", closestName("bugs", names))
+	assert.Equal(t, "", closestName("kubernetes", names))
+
+	label, ok = canonicalName("Good-First-Issue", []string{"good first issue"})
+	assert.True(t, ok)
+	assert.Equal(t, "good first issue", label)
+}
+
+func TestSplitLabels(t *testing.T) {
+	assert.Equal(t, []string{"bug", "windows"}, splitLabels("bug  windows"))
+	assert.Equal(t, []string{"help wanted", "windows"}, splitLabels(`"help wanted" windows`))
+	assert.Equal(t, []string{"help wanted", "windows"}, splitLabels("'help wanted' windows"))
+	assert.Equal(t, []string{"help wanted", "windows"}, splitLabels("help wanted, windows,"))
+	assert.Equal(t, []string{}, splitLabels(""))
+}
+
+func TestLabelCommands(t *testing.T) {
+	mux, context, teardown := githubtest.Setup()
+	defer teardown()
+
+	mux.HandleFunc("/repos/bunto/bunto/collaborators/mattr-/permission", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"permission": "read", "role_name": "triage"}`)
+	})
+	labels := []string{UntriagedLabel}
+	mux.HandleFunc("/repos/bunto/bunto/issues/1/labels", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			added := []string{}
+			json.NewDecoder(r.Body).Decode(&added)
+			labels = append(labels, added...)
+		}
+		issueLabels := []*github.Label{}
+		for _, label := range labels {
+			issueLabels = append(issueLabels, &github.Label{Name: github.String(label)})
+		}
+		json.NewEncoder(w).Encode(issueLabels)
+	})
+	mux.HandleFunc("/repos/bunto/bunto/issues/1/labels/", func(w http.ResponseWriter, r *http.Request) {
+		removed := strings.TrimPrefix(r.URL.Path, "/repos/bunto/bunto/issues/1/labels/")
+		remaining := []string{}
+		for _, label := range labels {
+			if label != removed {
+				remaining = append(remaining, label)
+			}
+		}
+		labels = remaining
+	})
+	replies := []string{}
+	mux.HandleFunc("/repos/bunto/bunto/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		comment := &github.IssueComment{}
+		json.NewDecoder(r.Body).Decode(comment)
+		replies = append(replies, *comment.Body)
+		json.NewEncoder(w).Encode(comment)
+	})
+
+	router := &commands.Router{}
+	for _, command := range LabelCommands(LabelNames(CanonicalLabels)) {
+		router.Register(command)
+	}
+	comment := func(body string) *github.IssueCommentEvent {
+		return &github.IssueCommentEvent{
+			Action:  github.String("created"),
+			Issue:   &github.Issue{Number: github.Int(1)},
+			Comment: &github.IssueComment{User: &github.User{Login: github.String("mattr-")}, Body: github.String(body)},
+			Repo:    &github.Repository{Owner: &github.User{Login: github.String("bunto")}, Name: github.String("bunto")},
+		}
+	}
+
+	assert.NoError(t, router.IssueCommentHandler(context, comment("/triage bug, Windows")))
+	assert.Equal(t, []string{"bug", "windows"}, labels)
+
+	assert.NoError(t, router.IssueCommentHandler(context, comment("/unlabel windows")))
+	assert.Equal(t, []string{"bug"}, labels)
+
+	assert.NoError(t, router.IssueCommentHandler(context, comment(`/label "Help Wanted"`)))
+	assert.Equal(t, []string{"bug", "help-wanted"}, labels)
+	assert.NoError(t, router.IssueCommentHandler(context, comment("/unlabel help wanted,")))
+	assert.Equal(t, []string{"bug"}, labels)
+
+	assert.Error(t, router.IssueCommentHandler(context, comment("/label enhancment feature")))
+	assert.Equal(t, []string{"bug"}, labels)
+	if assert.Len(t, replies, 1) {
+		assert.Contains(t, replies[0], "Did you mean `enhancement`?")
+	}
+}
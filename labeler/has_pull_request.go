@@ -13,7 +13,7 @@ var fixesIssueMatcher = regexp.MustCompile(`(?i)(?:Close|Closes|Closed|Fix|Fixes
 func IssueHasPullRequestLabeler(context *ctx.Context, payload interface{}) error {
 	event, ok := payload.(*github.PullRequestEvent)
 	if !ok {
-		return context.NewError("IssueHasPullRequestLabeler: not a pull request event")
+		return context.NewSkip("IssueHasPullRequestLabeler: not a pull request event")
 	}
 
 	if *event.Action != "opened" {
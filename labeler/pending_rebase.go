@@ -12,10 +12,10 @@ import (
 
 const repoMergeabilityCheckWaitSec = 2
 
-var PendingRebaseNeedsWorkPRUnlabeler = func(context *ctx.Context, payload interface{}) error {
+func PendingRebaseNeedsWorkPRUnlabeler(context *ctx.Context, payload interface{}) error {
 	event, ok := payload.(*github.PullRequestEvent)
 	if !ok {
-		return context.NewError("PendingRebaseUnlabeler: not a pull request event")
+		return context.NewSkip("PendingRebaseUnlabeler: not a pull request event")
 	}
 
 	if *event.Action != "synchronize" {
@@ -0,0 +1,217 @@
+package lgtm
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/buntobot/auto-reply/auth"
+	"github.com/buntobot/auto-reply/codeowners"
+	"github.com/buntobot/auto-reply/common"
+	"github.com/buntobot/auto-reply/ctx"
+)
+
+var teamNameRegexp = regexp.MustCompile(`\A@?[\w-]+/[\w.-]+\z`)
+
+// Approvals are the rules a PR must meet, on top of its quorum, before going
+// state: "success".
+type Approvals struct {
+	// Teams each need the LGTM's of some of their members.
+	Teams []TeamApproval `yaml:"teams"`
+
+	// CodeOwners needs, for each file the PR changes, the LGTM of one of its
+	// owners per the CODEOWNERS file of the PR's base branch.
+	CodeOwners bool `yaml:"code_owners"`
+
+	// Branches set the quorum of the PRs into matching base branches. The
+	// first match wins.
+	Branches []BranchQuorum `yaml:"branches"`
+}
+
+type TeamApproval struct {
+	// The team, e.g. "bunto/core".
+	Team string `yaml:"team"`
+	// How many of its members must LGTM; 1 if unset.
+	Count int `yaml:"count"`
+}
+
+type BranchQuorum struct {
+	// The name of the base branch, or a glob, e.g. "release/*".
+	Branch string `yaml:"branch"`
+	Quorum int    `yaml:"quorum"`
+}
+
+// IsEmpty returns true if there's no rule on top of the quorum.
+func (a Approvals) IsEmpty() bool {
+	return len(a.Teams) == 0 && !a.CodeOwners && len(a.Branches) == 0
+}
+
+// Validate returns an error if a team isn't an "org/slug" or a branch
+// isn't a valid glob.
+func (a Approvals) Validate() error {
+	for _, team := range a.Teams {
+		if !teamNameRegexp.MatchString(team.Team) {
+			return fmt.Errorf("lgtm team %q must be an org/slug", team.Team)
+		}
+		if team.Count < 0 {
+			return fmt.Errorf("lgtm team %s count must not be negative", team.Team)
+		}
+	}
+	for _, branch := range a.Branches {
+		if branch.Branch == "" {
+			return fmt.Errorf("lgtm branches need a branch")
+		}
+		if _, err := path.Match(branch.Branch, ""); err != nil {
+			return fmt.Errorf("lgtm branch %q: %v", branch.Branch, err)
+		}
+		if branch.Quorum < 0 {
+			return fmt.Errorf("lgtm branch %s quorum must not be negative", branch.Branch)
+		}
+	}
+	return nil
+}
+
+// quorumFor returns the quorum of the PRs into base, or fallback if no
+// branch matches.
+func (a Approvals) quorumFor(base string, fallback int) int {
+	for _, branch := range a.Branches {
+		if matched, _ := path.Match(branch.Branch, base); matched {
+			return branch.Quorum
+		}
+	}
+	return fallback
+}
+
+// checkApprovals sets the status' quorum for the PR's base branch and lists
+// what the repo's rules still need. The PR is fetched if the status doesn't
+// know it yet.
+func checkApprovals(context *ctx.Context, ref prRef, status *statusInfo) error {
+	status.missing = nil
+	approvals := ref.Repo.Approvals
+	if approvals.IsEmpty() {
+		return nil
+	}
+
+	if status.base == "" {
+		pr, _, err := context.GitHub.PullRequests.Get(ref.Repo.Owner, ref.Repo.Name, ref.Number)
+		if err != nil {
+			return ctx.Errorf("couldn't fetch %s: %v", ref, err)
+		}
+		status.setPullRequest(pr)
+	}
+
+	status.quorum = approvals.quorumFor(status.base, status.quorum)
+	approvers := status.approvers()
+
+	for _, team := range approvals.Teams {
+		count := team.Count
+		if count == 0 {
+			count = 1
+		}
+		members, err := teamMembers(context, strings.TrimPrefix(team.Team, "@"), approvers)
+		if err != nil {
+			return err
+		}
+		if remaining := count - len(members); remaining > 0 {
+			status.missing = append(status.missing, fmt.Sprintf("%d %s from %s",
+				remaining, pluralize(remaining, "LGTM", "LGTM's"), strings.TrimPrefix(team.Team, "@")))
+		}
+	}
+
+	if approvals.CodeOwners {
+		unowned, err := pathsWithoutOwnerLGTM(context, ref, status, approvers)
+		if err != nil {
+			return err
+		}
+		switch len(unowned) {
+		case 0:
+		case 1:
+			status.missing = append(status.missing, "a code owner of "+unowned[0])
+		default:
+			status.missing = append(status.missing, fmt.Sprintf("code owners of %d files", len(unowned)))
+		}
+	}
+	return nil
+}
+
+// teamMembers returns the logins which are members of the team, given as
+// "org/slug".
+func teamMembers(context *ctx.Context, team string, logins []string) ([]string, error) {
+	parts := strings.SplitN(team, "/", 2)
+	members := []string{}
+	for _, login := range logins {
+		isMember, err := auth.UserIsTeamMember(context, parts[0], parts[1], login)
+		if err != nil {
+			return nil, ctx.Errorf("couldn't check whether %s is in %s: %v", login, team, err)
+		}
+		if isMember {
+			members = append(members, login)
+		}
+	}
+	return members, nil
+}
+
+// pathsWithoutOwnerLGTM returns the files the PR changes which have owners,
+// none of whom approved it.
+func pathsWithoutOwnerLGTM(context *ctx.Context, ref prRef, status *statusInfo, approvers []string) ([]string, error) {
+	file, err := codeowners.FetchFile(context, ref.Repo.Owner, ref.Repo.Name, status.baseSHA)
+	if err != nil || file == nil {
+		return nil, err
+	}
+	paths, err := common.ChangedFiles(context, ref.Repo.Owner, ref.Repo.Name, ref.Number)
+	if err != nil {
+		return nil, err
+	}
+
+	// Whether an owner approved, by owner.
+	approved := map[string]bool{}
+	unowned := []string{}
+	for _, path := range paths {
+		owners := file.OwnersOf(path)
+		satisfied := len(owners) == 0
+		for _, owner := range owners {
+			ok, seen := approved[strings.ToLower(owner)]
+			if !seen {
+				if ok, err = ownerApproved(context, owner, approvers); err != nil {
+					return nil, err
+				}
+				approved[strings.ToLower(owner)] = ok
+			}
+			if ok {
+				satisfied = true
+				break
+			}
+		}
+		if !satisfied {
+			unowned = append(unowned, path)
+		}
+	}
+	return unowned, nil
+}
+
+// ownerApproved returns true if the owner, a "@login" or an "@org/slug", is
+// or has a member among the approvers. Email addresses never approve.
+func ownerApproved(context *ctx.Context, owner string, approvers []string) (bool, error) {
+	if !strings.HasPrefix(owner, "@") {
+		return false, nil
+	}
+	name := strings.TrimPrefix(owner, "@")
+	if strings.Contains(name, "/") {
+		members, err := teamMembers(context, name, approvers)
+		return len(members) > 0, err
+	}
+	for _, approver := range approvers {
+		if strings.EqualFold(approver, name) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func pluralize(count int, singular, plural string) string {
+	if count == 1 {
+		return singular
+	}
+	return plural
+}
@@ -0,0 +1,107 @@
+package lgtm
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApprovalsValidate(t *testing.T) {
+	valid := Approvals{
+		Teams:      []TeamApproval{{Team: "bunto/core", Count: 2}, {Team: "@bunto/documentation"}},
+		CodeOwners: true,
+		Branches:   []BranchQuorum{{Branch: "release/*", Quorum: 3}},
+	}
+	assert.NoError(t, valid.Validate())
+	assert.Error(t, Approvals{Teams: []TeamApproval{{Team: "core"}}}.Validate())
+	assert.Error(t, Approvals{Teams: []TeamApproval{{Team: "bunto/core", Count: -1}}}.Validate())
+	assert.Error(t, Approvals{Branches: []BranchQuorum{{Quorum: 1}}}.Validate())
+	assert.Error(t, Approvals{Branches: []BranchQuorum{{Branch: "release/[", Quorum: 1}}}.Validate())
+}
+
+func TestApprovalsQuorumFor(t *testing.T) {
+	approvals := Approvals{Branches: []BranchQuorum{{Branch: "master", Quorum: 2}, {Branch: "release/*", Quorum: 3}}}
+	assert.Equal(t, 2, approvals.quorumFor("master", 1))
+	assert.Equal(t, 3, approvals.quorumFor("release/3.4", 1))
+	assert.Equal(t, 1, approvals.quorumFor("gh-pages", 1))
+}
+
+func TestPullRequestReviewHandlerWithApprovals(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+	statusCache = statusMap{data: make(map[string]*statusInfo)}
+	statusCache.data[statusKey(ref, prSHA)] = &statusInfo{lgtmers: []string{}, quorum: 1, sha: prSHA}
+
+	h := &Handler{}
+	h.AddRepo("o", "r", 1)
+	h.SetApprovals("o", "r", Approvals{
+		Teams:      []TeamApproval{{Team: "o/core"}},
+		CodeOwners: true,
+		Branches:   []BranchQuorum{{Branch: "release/*", Quorum: 2}},
+	})
+
+	mux.HandleFunc("/repos/o/r/collaborators/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"permission": "write", "role_name": "write"}`)
+	})
+	mux.HandleFunc("/orgs/o/teams", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id": 9, "slug": "core"}]`)
+	})
+	mux.HandleFunc("/teams/9/memberships/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/teams/9/memberships/subins2000" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"state": "active"}`)
+	})
+	mux.HandleFunc("/repos/o/r/contents/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/o/r/contents/CODEOWNERS" {
+			http.NotFound(w, r)
+			return
+		}
+		assert.Equal(t, "base0000", r.URL.Query().Get("ref"))
+		content := base64.StdEncoding.EncodeToString([]byte("docs/ @DirtyF\n"))
+		fmt.Fprintf(w, `{"type": "file", "encoding": "base64", "content": %q}`, content)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/273/files", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"filename": "docs/_docs/windows.md"}, {"filename": "lib/bunto/site.rb"}]`)
+	})
+	var posted *github.RepoStatus
+	mux.HandleFunc(statusesPOST, func(w http.ResponseWriter, r *http.Request) {
+		posted = new(github.RepoStatus)
+		json.NewDecoder(r.Body).Decode(posted)
+		fmt.Fprint(w, `{"id":1}`)
+	})
+
+	review := func(reviewer string) error {
+		event := newReviewEvent("submitted", "approved", reviewer)
+		event.PullRequest.User = &github.User{Login: github.String("octocat")}
+		event.PullRequest.Base = &github.PullRequestBranch{Ref: github.String("release/3.4"), SHA: github.String("base0000")}
+		return h.PullRequestReviewHandler(context, event)
+	}
+
+	// The author's own approval never counts.
+	assert.Error(t, review("OctoCat"))
+	assert.Nil(t, posted)
+
+	assert.NoError(t, review("subins2000"))
+	if assert.NotNil(t, posted) {
+		assert.Equal(t, "pending", *posted.State)
+		assert.Equal(t, "Approved by @subins2000. Requires 1 more LGTM. Missing: a code owner of docs/_docs/windows.md.", *posted.Description)
+	}
+
+	assert.NoError(t, review("DirtyF"))
+	assert.Equal(t, "success", *posted.State)
+	assert.Equal(t, "Approved by @subins2000 and @DirtyF.", *posted.Description)
+
+	// Without subins2000, the team's LGTM is missing again.
+	assert.NoError(t, h.PullRequestReviewHandler(context, newReviewEvent("dismissed", "approved", "subins2000")))
+	assert.Equal(t, "pending", *posted.State)
+	assert.Equal(t, "Approved by @DirtyF. Requires 1 more LGTM. Missing: 1 LGTM from o/core.", *posted.Description)
+}
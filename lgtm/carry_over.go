@@ -0,0 +1,150 @@
+package lgtm
+
+import (
+	"fmt"
+
+	"github.com/buntobot/auto-reply/codeowners"
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/google/go-github/github"
+)
+
+// PushPolicy says whether the LGTM's of a PR carry over to the commits
+// pushed to it.
+type PushPolicy string
+
+const (
+	// ResetOnPush drops the LGTM's upon every push. It's the default.
+	ResetOnPush PushPolicy = "reset"
+	// KeepOnBaseMerge keeps them if only merges of the base branch were
+	// pushed.
+	KeepOnBaseMerge PushPolicy = "keep_base_merges"
+	// KeepUnlessProtected keeps them if the pushed commits change none of
+	// the protected paths.
+	KeepUnlessProtected PushPolicy = "keep_unless_protected"
+)
+
+// CarryOver says what happens to the LGTM's of a PR when commits are pushed
+// to it.
+type CarryOver struct {
+	OnPush PushPolicy `yaml:"on_push"`
+	// The files a push mustn't change for KeepUnlessProtected to keep the
+	// LGTM's, as CODEOWNERS patterns, e.g. "/lib/" or "*.gemspec".
+	ProtectedPaths []string `yaml:"protected_paths"`
+}
+
+// Validate returns an error if the policy is unknown, or if
+// KeepUnlessProtected has no paths to protect.
+func (c CarryOver) Validate() error {
+	switch c.OnPush {
+	case "", ResetOnPush, KeepOnBaseMerge:
+	case KeepUnlessProtected:
+		if len(c.ProtectedPaths) == 0 {
+			return fmt.Errorf("lgtm on_push %s needs protected_paths", c.OnPush)
+		}
+	default:
+		return fmt.Errorf("lgtm on_push must be %s, %s or %s, not %q",
+			ResetOnPush, KeepOnBaseMerge, KeepUnlessProtected, c.OnPush)
+	}
+	return nil
+}
+
+// carriedOverLGTMers returns the LGTMers of the PR's previous head, and its
+// SHA, if the repo's policy keeps them for what was pushed since. The
+// previous head is the last one seen or, e.g. after a restart, the one the
+// push event says the PR was at.
+func carriedOverLGTMers(context *ctx.Context, ref prRef, pr *github.PullRequest) ([]string, string, error) {
+	policy := ref.Repo.CarryOver
+	if policy.OnPush == "" || policy.OnPush == ResetOnPush {
+		return nil, "", nil
+	}
+	before := statusCache.previous(ref, *pr.Head.SHA)
+	if before == nil && context.Before != "" {
+		var err error
+		if before, err = lookupStatus(context, ref, context.Before); err != nil {
+			return nil, "", err
+		}
+	}
+	if before == nil || len(before.lgtmers) == 0 {
+		return nil, "", nil
+	}
+
+	comparison, _, err := context.GitHub.Repositories.CompareCommits(ref.Repo.Owner, ref.Repo.Name, before.sha, *pr.Head.SHA)
+	if err != nil {
+		return nil, "", ctx.Errorf("couldn't compare %s to %s: %v", before.sha, *pr.Head.SHA, err)
+	}
+	// A force-push which rewrote the history keeps nothing, nor does a push
+	// too large to be listed in full.
+	if comparison.Status == nil || *comparison.Status != "ahead" || isTruncated(comparison) {
+		return nil, "", nil
+	}
+
+	var keep bool
+	switch policy.OnPush {
+	case KeepOnBaseMerge:
+		keep, err = onlyMergesOf(context, ref, *pr.Base.Ref, *pr.Head.SHA, comparison.Commits)
+	case KeepUnlessProtected:
+		keep = !touchesAny(comparison.Files, policy.ProtectedPaths)
+	}
+	if err != nil || !keep {
+		return nil, "", err
+	}
+	return before.lgtmers, before.sha, nil
+}
+
+// onlyMergesOf returns true if the pushed commits merge the base branch into
+// the PR at head: each is either a merge whose other parent is on the base
+// branch, or a commit of the base branch which came in with such a merge.
+func onlyMergesOf(context *ctx.Context, ref prRef, base, head string, pushed []github.RepositoryCommit) (bool, error) {
+	// The commits of the PR which aren't on the base branch.
+	comparison, _, err := context.GitHub.Repositories.CompareCommits(ref.Repo.Owner, ref.Repo.Name, base, head)
+	if err != nil {
+		return false, ctx.Errorf("couldn't compare %s to %s: %v", base, head, err)
+	}
+	if isTruncated(comparison) {
+		return false, nil
+	}
+	offBase := map[string]bool{}
+	for _, commit := range comparison.Commits {
+		if commit.SHA != nil {
+			offBase[*commit.SHA] = true
+		}
+	}
+
+	merges := 0
+	for _, commit := range pushed {
+		if commit.SHA == nil {
+			return false, nil
+		}
+		if !offBase[*commit.SHA] {
+			// It came in with a merge of the base branch.
+			continue
+		}
+		if len(commit.Parents) != 2 || commit.Parents[1].SHA == nil || offBase[*commit.Parents[1].SHA] {
+			return false, nil
+		}
+		merges++
+	}
+	return merges > 0, nil
+}
+
+// maxComparedFiles is the most files GitHub lists in a comparison. It
+// doesn't say how many there are in all.
+const maxComparedFiles = 300
+
+// isTruncated returns true if the comparison may not list all its commits
+// or files.
+func isTruncated(comparison *github.CommitsComparison) bool {
+	return comparison.TotalCommits != nil && *comparison.TotalCommits > len(comparison.Commits) ||
+		len(comparison.Files) >= maxComparedFiles
+}
+
+func touchesAny(files []github.CommitFile, patterns []string) bool {
+	for _, file := range files {
+		for _, pattern := range patterns {
+			if file.Filename != nil && codeowners.Match(pattern, *file.Filename) {
+				return true
+			}
+		}
+	}
+	return false
+}
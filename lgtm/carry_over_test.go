@@ -0,0 +1,148 @@
+package lgtm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	// A merge of master, which brought in the commit b4se of master.
+	baseMergePush = `{"status": "ahead", "commits": [
+		{"sha": "b4se", "parents": [{"sha": "0ld6ase"}]},
+		{"sha": "m3rge", "parents": [{"sha": "0ld5ha"}, {"sha": "b4se"}]}
+	], "files": [{"filename": "lib/bunto/site.rb"}]}`
+	// A merge of another branch of the PR's author.
+	branchMergePush = `{"status": "ahead", "commits": [
+		{"sha": "f34ture", "parents": [{"sha": "0ld6ase"}]},
+		{"sha": "m3rge", "parents": [{"sha": "0ld5ha"}, {"sha": "f34ture"}]}
+	], "files": [{"filename": "docs/index.md"}]}`
+	docsPush  = `{"status": "ahead", "commits": [{"sha": "d0cs", "parents": [{"sha": "0ld5ha"}]}], "files": [{"filename": "docs/index.md"}]}`
+	forcePush = `{"status": "diverged", "commits": [{"sha": "d0cs", "parents": [{"sha": "r3based"}]}], "files": [{"filename": "docs/index.md"}]}`
+
+	// The commits of the PR, at its new head, which aren't on master.
+	prCommits = `{"status": "ahead", "commits": [{"sha": "0ld5ha"}, {"sha": "f34ture"}, {"sha": "m3rge"}, {"sha": "d0cs"}]}`
+)
+
+func TestCarryOverValidate(t *testing.T) {
+	assert.NoError(t, CarryOver{}.Validate())
+	assert.NoError(t, CarryOver{OnPush: KeepOnBaseMerge}.Validate())
+	assert.NoError(t, CarryOver{OnPush: KeepUnlessProtected, ProtectedPaths: []string{"/lib/"}}.Validate())
+	assert.Error(t, CarryOver{OnPush: KeepUnlessProtected}.Validate())
+	assert.Error(t, CarryOver{OnPush: "keep"}.Validate())
+}
+
+func TestPullRequestHandlerCarriesOverLGTMs(t *testing.T) {
+	// GitHub lists 300 files at most, so others may touch protected paths.
+	largeDocsPush := `{"status": "ahead", "commits": [{"sha": "d0cs", "parents": [{"sha": "0ld5ha"}]}], "files": [` +
+		strings.TrimSuffix(strings.Repeat(`{"filename": "docs/index.md"},`, maxComparedFiles), ",") + `]}`
+	cases := []struct {
+		carryOver   CarryOver
+		push        string
+		description string
+	}{
+		{CarryOver{}, baseMergePush, "Awaiting approval from at least 1 maintainer."},
+		{CarryOver{OnPush: KeepOnBaseMerge}, baseMergePush, "Approved by @DirtyF."},
+		{CarryOver{OnPush: KeepOnBaseMerge}, branchMergePush, "Awaiting approval from at least 1 maintainer."},
+		{CarryOver{OnPush: KeepOnBaseMerge}, docsPush, "Awaiting approval from at least 1 maintainer."},
+		{CarryOver{OnPush: KeepUnlessProtected, ProtectedPaths: []string{"/lib/"}}, baseMergePush, "Awaiting approval from at least 1 maintainer."},
+		{CarryOver{OnPush: KeepUnlessProtected, ProtectedPaths: []string{"/lib/"}}, docsPush, "Approved by @DirtyF."},
+		{CarryOver{OnPush: KeepUnlessProtected, ProtectedPaths: []string{"/lib/"}}, forcePush, "Awaiting approval from at least 1 maintainer."},
+		{CarryOver{OnPush: KeepUnlessProtected, ProtectedPaths: []string{"/lib/"}}, largeDocsPush, "Awaiting approval from at least 1 maintainer."},
+	}
+	for _, test := range cases {
+		setup() // server & client!
+		context := &ctx.Context{GitHub: client}
+		statusCache = statusMap{data: make(map[string]*statusInfo)}
+		statusCache.set(ref, "0ld5ha", &statusInfo{lgtmers: []string{"@DirtyF"}, quorum: 1, sha: "0ld5ha"})
+
+		h := &Handler{}
+		h.AddRepo("o", "r", 1)
+		h.SetCarryOver("o", "r", test.carryOver)
+
+		push := test.push
+		mux.HandleFunc("/repos/o/r/compare/0ld5ha..."+prSHA, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, push)
+		})
+		mux.HandleFunc("/repos/o/r/compare/master..."+prSHA, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, prCommits)
+		})
+		var posted *github.RepoStatus
+		mux.HandleFunc(statusesPOST, func(w http.ResponseWriter, r *http.Request) {
+			posted = new(github.RepoStatus)
+			json.NewDecoder(r.Body).Decode(posted)
+			fmt.Fprint(w, `{"id":1}`)
+		})
+
+		event := &github.PullRequestEvent{
+			Action: github.String("synchronize"),
+			Number: github.Int(ref.Number),
+			PullRequest: &github.PullRequest{
+				User: &github.User{Login: github.String("octocat")},
+				Head: &github.PullRequestBranch{SHA: github.String(prSHA)},
+				Base: &github.PullRequestBranch{Ref: github.String("master")},
+			},
+			Repo: &github.Repository{
+				Owner: &github.User{Login: github.String("o")},
+				Name:  github.String("r"),
+			},
+		}
+		assert.NoError(t, h.PullRequestHandler(context, event))
+		if assert.NotNil(t, posted, "%+v", test) {
+			assert.Equal(t, test.description, *posted.Description, "%+v", test.carryOver)
+		}
+		// Only the new head is cached.
+		assert.Len(t, statusCache.data, 1)
+		assert.NotNil(t, statusCache.data[statusKey(ref, prSHA)])
+		teardown()
+	}
+}
+
+func TestPullRequestHandlerCarriesOverLGTMsOfBefore(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	// As after a restart, the previous head of the PR isn't cached.
+	context := &ctx.Context{GitHub: client, Before: "0ld5ha"}
+	statusCache = statusMap{data: make(map[string]*statusInfo)}
+
+	h := &Handler{}
+	h.AddRepo("o", "r", 1)
+	h.SetCarryOver("o", "r", CarryOver{OnPush: KeepUnlessProtected, ProtectedPaths: []string{"/lib/"}})
+
+	mux.HandleFunc("/repos/o/r/commits/0ld5ha/statuses", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"context": "o/lgtm", "state": "success", "description": "Approved by @DirtyF."}]`)
+	})
+	mux.HandleFunc("/repos/o/r/compare/0ld5ha..."+prSHA, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, docsPush)
+	})
+	var posted *github.RepoStatus
+	mux.HandleFunc(statusesPOST, func(w http.ResponseWriter, r *http.Request) {
+		posted = new(github.RepoStatus)
+		json.NewDecoder(r.Body).Decode(posted)
+		fmt.Fprint(w, `{"id":1}`)
+	})
+
+	event := &github.PullRequestEvent{
+		Action: github.String("synchronize"),
+		Number: github.Int(ref.Number),
+		PullRequest: &github.PullRequest{
+			User: &github.User{Login: github.String("octocat")},
+			Head: &github.PullRequestBranch{SHA: github.String(prSHA)},
+			Base: &github.PullRequestBranch{Ref: github.String("master")},
+		},
+		Repo: &github.Repository{
+			Owner: &github.User{Login: github.String("o")},
+			Name:  github.String("r"),
+		},
+	}
+	assert.NoError(t, h.PullRequestHandler(context, event))
+	if assert.NotNil(t, posted) {
+		assert.Equal(t, "Approved by @DirtyF.", *posted.Description)
+	}
+}
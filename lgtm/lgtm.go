@@ -4,10 +4,13 @@ package lgtm
 import (
 	"fmt"
 	"regexp"
+	"strings"
 
 	"github.com/google/go-github/github"
 	"github.com/buntobot/auto-reply/auth"
+	"github.com/buntobot/auto-reply/commands"
 	"github.com/buntobot/auto-reply/ctx"
+	"github.com/buntobot/auto-reply/repoconfig"
 )
 
 var lgtmBodyRegexp = regexp.MustCompile(`(?i:\ALGTM[!.,]\s+|\s+LGTM[.!,]*\z|\ALGTM[.!,]*\z)`)
@@ -21,10 +24,29 @@ func (r prRef) String() string {
 	return fmt.Sprintf("%s/%s#%d", r.Repo.Owner, r.Repo.Name, r.Number)
 }
 
+// lgtmCommand is the request by login to LGTM the PR, opened by author.
+func (r prRef) lgtmCommand(login, author string) auth.Command {
+	return auth.Command{
+		Name:   "lgtm",
+		Owner:  r.Repo.Owner,
+		Repo:   r.Repo.Name,
+		Number: r.Number,
+		Login:  login,
+		Author: author,
+	}
+}
+
 type Repo struct {
 	Owner, Name string
 	// The number of LGTM's a PR must get before going state: "success"
 	Quorum int
+	// Who may LGTM, under the "lgtm" command. Set from the repo's
+	// .github/buntobot.yml; write access by default.
+	Policy auth.Policy
+	// The approvals a PR needs on top of the quorum.
+	Approvals Approvals
+	// Whether the LGTM's of a PR survive pushes to it.
+	CarryOver CarryOver
 }
 
 type Handler struct {
@@ -43,10 +65,26 @@ func (h *Handler) AddRepo(owner, name string, quorum int) {
 	}
 }
 
+// SetApprovals sets the approvals the PRs of a repo the handler was added
+// for need on top of its quorum.
+func (h *Handler) SetApprovals(owner, name string, approvals Approvals) {
+	if repo := h.findRepo(owner, name); repo != nil {
+		repo.Approvals = approvals
+	}
+}
+
+// SetCarryOver sets what happens to the LGTM's of the PRs of a repo the
+// handler was added for when commits are pushed to them.
+func (h *Handler) SetCarryOver(owner, name string, carryOver CarryOver) {
+	if repo := h.findRepo(owner, name); repo != nil {
+		repo.CarryOver = carryOver
+	}
+}
+
 func (h *Handler) findRepo(owner, name string) *Repo {
-	for _, repo := range h.repos {
-		if repo.Owner == owner && repo.Name == name {
-			return &repo
+	for i := range h.repos {
+		if h.repos[i].Owner == owner && h.repos[i].Name == name {
+			return &h.repos[i]
 		}
 	}
 
@@ -71,52 +109,64 @@ func (h *Handler) newPRRef(owner, name string, number int) prRef {
 	}
 }
 
-func (h *Handler) IssueCommentHandler(context *ctx.Context, payload interface{}) error {
-	comment, ok := payload.(*github.IssueCommentEvent)
-	if !ok {
-		return context.NewError("lgtm.IssueCommentHandler: not an issue comment event")
-	}
-
-	// LGTM comment?
-	if !lgtmBodyRegexp.MatchString(*comment.Comment.Body) {
-		return context.NewError("lgtm.IssueCommentHandler: not a LGTM comment")
-	}
+// applyRepoConfig merges the quorum & policy set in the repo's own
+// .github/buntobot.yml, if any, over the ones it was added with. Handlers
+// call it once the event passed the checks which don't need either, so
+// events left unhandled never fetch the file.
+func applyRepoConfig(context *ctx.Context, ref *prRef) {
+	config := repoconfig.Get(context, ref.Repo.Owner, ref.Repo.Name)
+	ref.Repo.Quorum = config.QuorumOr(ref.Repo.Quorum)
+	ref.Repo.Policy = config.Policy()
+}
 
-	// Is this a pull request?
-	if comment.Issue == nil || comment.Issue.PullRequestLinks == nil {
-		return context.NewError("lgtm.IssueCommentHandler: not a pull request")
+// Command is the "lgtm" command, run by "/lgtm" or a comment which says
+// "LGTM", for the repos the handler was added for. The commands.Router
+// checks the LGTMer may run it.
+func (h *Handler) Command() commands.Command {
+	return commands.Command{
+		Name:            "lgtm",
+		Summary:         "approves the pull request, as one of the LGTM's it needs.",
+		PullRequestOnly: true,
+		Pattern:         lgtmBodyRegexp,
+		Enabled:         h.isEnabledFor,
+		Handler:         h.CommandHandler,
 	}
+}
 
-	ref := h.newPRRef(*comment.Repo.Owner.Login, *comment.Repo.Name, *comment.Issue.Number)
-	lgtmer := *comment.Comment.User.Login
+// CommandHandler adds the LGTM of the user who ran the "lgtm" command.
+func (h *Handler) CommandHandler(context *ctx.Context, invocation *commands.Invocation) error {
+	ref := h.newPRRef(invocation.Owner, invocation.Repo, invocation.Number)
+	lgtmer := invocation.Login
 
 	if !h.isEnabledFor(ref.Repo.Owner, ref.Repo.Name) {
-		return context.NewError("lgtm.IssueCommentHandler: not enabled for %s/%s", ref.Repo.Owner, ref.Repo.Name)
-	}
-
-	// Does the user have merge/label abilities?
-	if !auth.CommenterHasPushAccess(context, *comment) {
-		return context.NewError(
-			"%s isn't authenticated to merge anything on %s/%s",
-			*comment.Comment.User.Login, ref.Repo.Owner, ref.Repo.Name)
+		return context.NewSkip("lgtm.CommandHandler: not enabled for %s/%s", ref.Repo.Owner, ref.Repo.Name)
 	}
+	// The router authorized the LGTMer before running the command.
+	applyRepoConfig(context, &ref)
 
 	// Get status
 	info, err := getStatus(context, ref)
 	if err != nil {
-		return context.NewError("lgtm.IssueCommentHandler: couldn't get status for %s: %v", ref, err)
+		return context.NewError("lgtm.CommandHandler: couldn't get status for %s: %v", ref, err)
 	}
 
 	// Already LGTM'd by you? Exit.
 	if info.IsLGTMer(lgtmer) {
-		return context.NewError(
-			"lgtm.IssueCommentHandler: no duplicate LGTM allowed for @%s on %s", lgtmer, ref)
+		return context.NewSkip(
+			"lgtm.CommandHandler: no duplicate LGTM allowed for @%s on %s", lgtmer, ref)
 	}
 
-	info.lgtmers = append(info.lgtmers, "@"+lgtmer)
+	if invocation.Author != "" {
+		info.author = invocation.Author
+	}
+	if strings.EqualFold(lgtmer, info.author) {
+		return context.NewSkip("lgtm.CommandHandler: @%s can't LGTM their own %s", lgtmer, ref)
+	}
+
+	info.addLGTMer(lgtmer)
 	if err := setStatus(context, ref, info.sha, info); err != nil {
 		return context.NewError(
-			"lgtm.IssueCommentHandler: had trouble adding lgtmer '%s' on %s: %v",
+			"lgtm.CommandHandler: had trouble adding lgtmer '%s' on %s: %v",
 			lgtmer, ref, err)
 	}
 	return nil
@@ -125,21 +175,35 @@ func (h *Handler) IssueCommentHandler(context *ctx.Context, payload interface{})
 func (h *Handler) PullRequestHandler(context *ctx.Context, payload interface{}) error {
 	event, ok := payload.(*github.PullRequestEvent)
 	if !ok {
-		return context.NewError("lgtm.PullRequestHandler: not a pull request event")
+		return context.NewSkip("lgtm.PullRequestHandler: not a pull request event")
 	}
 
 	ref := h.newPRRef(*event.Repo.Owner.Login, *event.Repo.Name, *event.Number)
 
 	if !h.isEnabledFor(ref.Repo.Owner, ref.Repo.Name) {
-		return context.NewError("lgtm.PullRequestHandler: not enabled for %s", ref)
+		return context.NewSkip("lgtm.PullRequestHandler: not enabled for %s", ref)
 	}
 
 	if *event.Action == "opened" || *event.Action == "synchronize" {
-		err := setStatus(context, ref, *event.PullRequest.Head.SHA, &statusInfo{
+		applyRepoConfig(context, &ref)
+		info := &statusInfo{
 			lgtmers: []string{},
 			quorum:  ref.Repo.Quorum,
 			sha:     *event.PullRequest.Head.SHA,
-		})
+		}
+		info.setPullRequest(event.PullRequest)
+		if *event.Action == "synchronize" {
+			lgtmers, before, err := carriedOverLGTMers(context, ref, event.PullRequest)
+			if err != nil {
+				context.IncrStat("lgtm.error.github_api")
+				context.Log("lgtm.PullRequestHandler: resetting the LGTM's of %s: %v", ref, err)
+			} else if len(lgtmers) > 0 {
+				info.lgtmers = append(info.lgtmers, lgtmers...)
+				context.IncrStat("lgtm.carried_over")
+				context.Log("lgtm: carried the LGTM's of %s over from %s to %s", ref, before, info.sha)
+			}
+		}
+		err := setStatus(context, ref, *event.PullRequest.Head.SHA, info)
 		if err != nil {
 			return context.NewError(
 				"lgtm.PullRequestHandler: could not create status on %s: %v",
@@ -151,17 +215,110 @@ func (h *Handler) PullRequestHandler(context *ctx.Context, payload interface{})
 	return nil
 }
 
+// PullRequestReviewHandler counts an "approved" review from a user with push
+// access as a LGTM. A "changes_requested" review, or the dismissal of a
+// review, removes that reviewer's LGTM.
 func (h *Handler) PullRequestReviewHandler(context *ctx.Context, payload interface{}) error {
-	return context.NewError("lgtm.PullRequestReviewHandler: pull request review webhooks aren't implemented yet")
+	event, ok := payload.(*github.PullRequestReviewEvent)
+	if !ok {
+		return context.NewSkip("lgtm.PullRequestReviewHandler: not a pull request review event")
+	}
+
+	ref := h.newPRRef(*event.Repo.Owner.Login, *event.Repo.Name, *event.PullRequest.Number)
+
+	if !h.isEnabledFor(ref.Repo.Owner, ref.Repo.Name) {
+		return context.NewSkip("lgtm.PullRequestReviewHandler: not enabled for %s", ref)
+	}
 
-	//event, ok := payload.(*github.PullRequestReviewEvent)
-	//if !ok {
-	//	return context.NewError("lgtm.PullRequestReviewHandler: not a pull request review event")
-	//}
+	if event.Review == nil || event.Review.User == nil {
+		return context.NewSkip("lgtm.PullRequestReviewHandler: no review author for %s", ref)
+	}
 
-	//ref := h.newPRRef(*event.Repo.Owner.Login, *event.Repo.Name, *event.Number)
+	reviewer := *event.Review.User.Login
 
-	//if !h.isEnabledFor(ref.Repo.Owner, ref.Repo.Name) {
-	//	return context.NewError("lgtm.PullRequestReviewHandler: not enabled for %s", ref)
-	//}
+	switch reviewState(event) {
+	case "approved":
+		return h.approve(context, ref, event.PullRequest, reviewer)
+	case "changes_requested", "dismissed":
+		return h.unapprove(context, ref, event.PullRequest, reviewer)
+	default:
+		return context.NewSkip("lgtm.PullRequestReviewHandler: review by @%s on %s is not an approval or rejection", reviewer, ref)
+	}
+}
+
+func (h *Handler) approve(context *ctx.Context, ref prRef, pr *github.PullRequest, reviewer string) error {
+	author := loginOf(pr.User)
+	if strings.EqualFold(reviewer, author) {
+		return context.NewSkip("lgtm.PullRequestReviewHandler: @%s can't LGTM their own %s", reviewer, ref)
+	}
+
+	// May the user LGTM? Who may is up to the repo's policy. Other
+	// reviewers' approvals just don't count, so they aren't told off.
+	applyRepoConfig(context, &ref)
+	if !ref.Repo.Policy.Allowed(context, ref.lgtmCommand(reviewer, author)) {
+		return context.NewSkip("lgtm.PullRequestReviewHandler: @%s may not LGTM %s", reviewer, ref)
+	}
+
+	sha := *pr.Head.SHA
+	info, err := getStatusForSHA(context, ref, sha)
+	if err != nil {
+		return context.NewError("lgtm.PullRequestReviewHandler: couldn't get status for %s: %v", ref, err)
+	}
+	info.setPullRequest(pr)
+
+	if info.IsLGTMer(reviewer) {
+		return context.NewSkip(
+			"lgtm.PullRequestReviewHandler: no duplicate LGTM allowed for @%s on %s", reviewer, ref)
+	}
+
+	info.addLGTMer(reviewer)
+	if err := setStatus(context, ref, sha, info); err != nil {
+		return context.NewError(
+			"lgtm.PullRequestReviewHandler: had trouble adding lgtmer '%s' on %s: %v",
+			reviewer, ref, err)
+	}
+	return nil
+}
+
+func (h *Handler) unapprove(context *ctx.Context, ref prRef, pr *github.PullRequest, reviewer string) error {
+	applyRepoConfig(context, &ref)
+	sha := *pr.Head.SHA
+	info, err := getStatusForSHA(context, ref, sha)
+	if err != nil {
+		return context.NewError("lgtm.PullRequestReviewHandler: couldn't get status for %s: %v", ref, err)
+	}
+	info.setPullRequest(pr)
+
+	if !info.IsLGTMer(reviewer) {
+		return context.NewSkip(
+			"lgtm.PullRequestReviewHandler: @%s hasn't approved %s; nothing to remove", reviewer, ref)
+	}
+
+	info.removeLGTMer(reviewer)
+	if err := setStatus(context, ref, sha, info); err != nil {
+		return context.NewError(
+			"lgtm.PullRequestReviewHandler: had trouble removing lgtmer '%s' on %s: %v",
+			reviewer, ref, err)
+	}
+	return nil
+}
+
+// loginOf returns the user's login, or "" if the payload left them out.
+func loginOf(user *github.User) string {
+	if user == nil || user.Login == nil {
+		return ""
+	}
+	return *user.Login
+}
+
+// reviewState returns the lowercased state of the review, or "dismissed" if
+// the review was dismissed.
+func reviewState(event *github.PullRequestReviewEvent) string {
+	if event.Action != nil && *event.Action == "dismissed" {
+		return "dismissed"
+	}
+	if event.Review.State == nil {
+		return ""
+	}
+	return strings.ToLower(*event.Review.State)
 }
@@ -0,0 +1,187 @@
+package lgtm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func newReviewEvent(action, state, reviewer string) *github.PullRequestReviewEvent {
+	return &github.PullRequestReviewEvent{
+		Action: github.String(action),
+		Review: &github.PullRequestReview{
+			User:  &github.User{Login: github.String(reviewer)},
+			State: github.String(state),
+		},
+		PullRequest: &github.PullRequest{
+			Number: github.Int(ref.Number),
+			Head:   &github.PullRequestBranch{SHA: github.String(prSHA)},
+		},
+		Repo: &github.Repository{
+			Owner: &github.User{Login: github.String(ref.Repo.Owner)},
+			Name:  github.String(ref.Repo.Name),
+		},
+	}
+}
+
+func TestReviewState(t *testing.T) {
+	cases := []struct {
+		action, state, expected string
+	}{
+		{"submitted", "approved", "approved"},
+		{"submitted", "APPROVED", "approved"},
+		{"submitted", "changes_requested", "changes_requested"},
+		{"submitted", "commented", "commented"},
+		{"dismissed", "approved", "dismissed"},
+	}
+	for _, test := range cases {
+		event := newReviewEvent(test.action, test.state, "SuriyaaKudoIsc")
+		assert.Equal(t, test.expected, reviewState(event))
+	}
+}
+
+func TestPullRequestReviewHandlerIgnoresComments(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+	statusCache = statusMap{data: make(map[string]*statusInfo)}
+
+	mux.HandleFunc("/repos/o/r/contents/.github/buntobot.yml", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("fetched the repo config of an ignored review")
+		http.NotFound(w, r)
+	})
+
+	err := handler.PullRequestReviewHandler(context, newReviewEvent("submitted", "commented", "SuriyaaKudoIsc"))
+	assert.Error(t, err)
+}
+
+func TestPullRequestReviewHandlerApproved(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+	statusCache = statusMap{data: make(map[string]*statusInfo)}
+	statusCache.data[statusKey(ref, prSHA)] = &statusInfo{lgtmers: []string{}, quorum: 1, sha: prSHA}
+
+	mux.HandleFunc("/repos/o/r/collaborators/SuriyaaKudoIsc/permission", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"permission": "write", "role_name": "write"}`)
+	})
+	var posted *github.RepoStatus
+	mux.HandleFunc(statusesPOST, func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		posted = new(github.RepoStatus)
+		json.NewDecoder(r.Body).Decode(posted)
+		fmt.Fprint(w, `{"id":1}`)
+	})
+
+	err := handler.PullRequestReviewHandler(context, newReviewEvent("submitted", "approved", "SuriyaaKudoIsc"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"@SuriyaaKudoIsc"}, statusCache.data[statusKey(ref, prSHA)].lgtmers)
+	if assert.NotNil(t, posted, "the Statuses API endpoint should be hit") {
+		assert.Equal(t, "success", *posted.State)
+		assert.Equal(t, "Approved by @SuriyaaKudoIsc.", *posted.Description)
+	}
+}
+
+func TestPullRequestReviewHandlerChangesRequested(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+	statusCache = statusMap{data: make(map[string]*statusInfo)}
+	statusCache.data[statusKey(ref, prSHA)] = &statusInfo{lgtmers: []string{"@SuriyaaKudoIsc"}, quorum: 1, sha: prSHA}
+
+	var posted *github.RepoStatus
+	mux.HandleFunc(statusesPOST, func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		posted = new(github.RepoStatus)
+		json.NewDecoder(r.Body).Decode(posted)
+		fmt.Fprint(w, `{"id":1}`)
+	})
+
+	err := handler.PullRequestReviewHandler(context, newReviewEvent("submitted", "changes_requested", "suriyaakudoisc"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{}, statusCache.data[statusKey(ref, prSHA)].lgtmers)
+	if assert.NotNil(t, posted, "the Statuses API endpoint should be hit") {
+		assert.Equal(t, "pending", *posted.State)
+		assert.Equal(t, "Awaiting approval from at least 1 maintainer.", *posted.Description)
+	}
+}
+
+func TestPullRequestReviewHandlerDismissedWithoutApproval(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+	statusCache = statusMap{data: make(map[string]*statusInfo)}
+	statusCache.data[statusKey(ref, prSHA)] = &statusInfo{lgtmers: []string{"@subins2000"}, quorum: 1, sha: prSHA}
+
+	err := handler.PullRequestReviewHandler(context, newReviewEvent("dismissed", "approved", "SuriyaaKudoIsc"))
+
+	assert.Error(t, err)
+	assert.Equal(t, []string{"@subins2000"}, statusCache.data[statusKey(ref, prSHA)].lgtmers)
+}
+
+func TestPullRequestReviewHandlerIgnoresApprovalsWithoutPushAccess(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+	statusCache = statusMap{data: make(map[string]*statusInfo)}
+	statusCache.data[statusKey(ref, prSHA)] = &statusInfo{lgtmers: []string{}, quorum: 1, sha: prSHA}
+
+	mux.HandleFunc("/repos/o/r/collaborators/drive-by/permission", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"permission": "read", "role_name": "read"}`)
+	})
+	mux.HandleFunc("/repos/o/r/issues/273/comments", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("answered an approval which doesn't count")
+	})
+	mux.HandleFunc(statusesPOST, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("set the status for an approval which doesn't count")
+	})
+
+	err := handler.PullRequestReviewHandler(context, newReviewEvent("submitted", "approved", "drive-by"))
+
+	assert.True(t, ctx.IsSkip(err))
+	assert.Equal(t, []string{}, statusCache.data[statusKey(ref, prSHA)].lgtmers)
+}
+
+func TestPullRequestReviewHandlerApprovedRetriesAfterFailedStatus(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+	statusCache = statusMap{data: make(map[string]*statusInfo)}
+	statusCache.data[statusKey(ref, prSHA)] = &statusInfo{lgtmers: []string{}, quorum: 1, sha: prSHA}
+
+	mux.HandleFunc("/repos/o/r/collaborators/SuriyaaKudoIsc/permission", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"permission": "write", "role_name": "write"}`)
+	})
+	attempts := 0
+	var posted *github.RepoStatus
+	mux.HandleFunc(statusesPOST, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		posted = new(github.RepoStatus)
+		json.NewDecoder(r.Body).Decode(posted)
+		fmt.Fprint(w, `{"id":1}`)
+	})
+
+	event := newReviewEvent("submitted", "approved", "SuriyaaKudoIsc")
+	err := handler.PullRequestReviewHandler(context, event)
+	assert.Error(t, err)
+	assert.False(t, ctx.IsSkip(err))
+	assert.Equal(t, []string{}, statusCache.data[statusKey(ref, prSHA)].lgtmers)
+
+	// The queue runs the handler again.
+	assert.NoError(t, handler.PullRequestReviewHandler(context, event))
+	assert.Equal(t, []string{"@SuriyaaKudoIsc"}, statusCache.data[statusKey(ref, prSHA)].lgtmers)
+	if assert.NotNil(t, posted, "the retry should set the status") {
+		assert.Equal(t, "Approved by @SuriyaaKudoIsc.", *posted.Description)
+	}
+}
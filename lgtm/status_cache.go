@@ -2,6 +2,7 @@ package lgtm
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 
 	"github.com/google/go-github/github"
@@ -12,7 +13,42 @@ var statusCache = statusMap{data: make(map[string]*statusInfo)}
 
 type statusMap struct {
 	sync.Mutex // protects 'data'
-	data       map[string]*statusInfo
+	// data maps statusKey(ref, sha) to the status of the PR at its head
+	// commit sha. Only the latest head of each PR is kept.
+	data map[string]*statusInfo
+}
+
+// statusKey keys the cache by head SHA, so the LGTM's given on a commit are
+// never applied to another.
+func statusKey(ref prRef, sha string) string {
+	return ref.String() + "@" + sha
+}
+
+// set caches a copy of the status of the PR at sha, dropping those of its
+// other heads. Changes made to info later, e.g. for a status GitHub then
+// fails to create, don't reach the cache.
+func (m *statusMap) set(ref prRef, sha string, info *statusInfo) {
+	m.Lock()
+	defer m.Unlock()
+	for key := range m.data {
+		if strings.HasPrefix(key, ref.String()+"@") {
+			delete(m.data, key)
+		}
+	}
+	m.data[statusKey(ref, sha)] = info.copy()
+}
+
+// previous returns the cached status of a head of the PR other than sha,
+// i.e. the head before the latest push, if any.
+func (m *statusMap) previous(ref prRef, sha string) *statusInfo {
+	m.Lock()
+	defer m.Unlock()
+	for key, info := range m.data {
+		if strings.HasPrefix(key, ref.String()+"@") && key != statusKey(ref, sha) {
+			return info.copy()
+		}
+	}
+	return nil
 }
 
 func lgtmContext(owner string) string {
@@ -20,56 +56,95 @@ func lgtmContext(owner string) string {
 }
 
 func setStatus(context *ctx.Context, ref prRef, sha string, status *statusInfo) error {
+	if err := checkApprovals(context, ref, status); err != nil {
+		return err
+	}
+
 	_, _, err := context.GitHub.Repositories.CreateStatus(
 		ref.Repo.Owner, ref.Repo.Name, sha, status.NewRepoStatus(ref.Repo.Owner))
 	if err != nil {
 		return err
 	}
 
-	statusCache.Lock()
-	statusCache.data[ref.String()] = status
-	statusCache.Unlock()
+	status.sha = sha
+	statusCache.set(ref, sha, status)
 
 	return nil
 }
 
+// getStatus returns the status of the PR's current head, which is fetched
+// as the cached head may be outdated.
 func getStatus(context *ctx.Context, ref prRef) (*statusInfo, error) {
-	statusCache.Lock()
-	cachedStatus, ok := statusCache.data[ref.String()]
-	statusCache.Unlock()
-	if ok && cachedStatus != nil {
-		return cachedStatus, nil
+	pr, _, err := context.GitHub.PullRequests.Get(ref.Repo.Owner, ref.Repo.Name, ref.Number)
+	if err != nil {
+		return nil, err
 	}
 
-	pr, _, err := context.GitHub.PullRequests.Get(ref.Repo.Owner, ref.Repo.Name, ref.Number)
+	info, err := getStatusForSHA(context, ref, *pr.Head.SHA)
 	if err != nil {
 		return nil, err
 	}
+	info.setPullRequest(pr)
+	return info, nil
+}
+
+// getStatusForSHA is getStatus for callers which already know the head SHA
+// of the PR, e.g. from a webhook payload.
+func getStatusForSHA(context *ctx.Context, ref prRef, sha string) (*statusInfo, error) {
+	if cachedStatus := cachedStatusFor(ref, sha); cachedStatus != nil {
+		return cachedStatus, nil
+	}
+
+	return fetchStatus(context, ref, sha)
+}
+
+// cachedStatusFor returns a copy of the cached status of the PR at sha, if
+// any, so callers only update the cache by setting the status. Its quorum is
+// updated, as the repo's quorum may have changed since it was cached.
+func cachedStatusFor(ref prRef, sha string) *statusInfo {
+	statusCache.Lock()
+	defer statusCache.Unlock()
+	info := statusCache.data[statusKey(ref, sha)]
+	if info == nil {
+		return nil
+	}
+	info = info.copy()
+	if ref.Repo.Quorum != 0 {
+		info.quorum = ref.Repo.Quorum
+	}
+	return info
+}
 
-	statuses, _, err := context.GitHub.Repositories.ListStatuses(ref.Repo.Owner, ref.Repo.Name, *pr.Head.SHA, nil)
+// lookupStatus returns the lgtm status of the commit sha, or nil if it has
+// none. Unlike fetchStatus, it neither creates nor caches one.
+func lookupStatus(context *ctx.Context, ref prRef, sha string) (*statusInfo, error) {
+	statuses, _, err := context.GitHub.Repositories.ListStatuses(ref.Repo.Owner, ref.Repo.Name, sha, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	var preExistingStatus *github.RepoStatus
-	var info *statusInfo
 	// Find the status matching context.
 	neededContext := lgtmContext(ref.Repo.Owner)
 	for _, status := range statuses {
 		if *status.Context == neededContext {
-			preExistingStatus = status
-			info = parseStatus(*pr.Head.SHA, status)
-			break
+			return parseStatus(sha, status), nil
 		}
 	}
+	return nil, nil
+}
+
+func fetchStatus(context *ctx.Context, ref prRef, sha string) (*statusInfo, error) {
+	info, err := lookupStatus(context, ref, sha)
+	if err != nil {
+		return nil, err
+	}
 
 	// None of the contexts matched.
-	if preExistingStatus == nil {
-		preExistingStatus = newEmptyStatus(ref.Repo.Owner, ref.Repo.Quorum)
-		info = parseStatus(*pr.Head.SHA, preExistingStatus)
-		err := setStatus(context, ref, *pr.Head.SHA, info)
+	if info == nil {
+		info = parseStatus(sha, newEmptyStatus(ref.Repo.Owner, ref.Repo.Quorum))
+		err := setStatus(context, ref, sha, info)
 		if err != nil {
-			fmt.Printf("getStatus: couldn't save new empty status to %s for %s: %v\n", ref, *pr.Head.SHA, err)
+			fmt.Printf("getStatus: couldn't save new empty status to %s for %s: %v\n", ref, sha, err)
 		}
 	}
 
@@ -77,9 +152,7 @@ func getStatus(context *ctx.Context, ref prRef) (*statusInfo, error) {
 		info.quorum = ref.Repo.Quorum
 	}
 
-	statusCache.Lock()
-	statusCache.data[ref.String()] = info
-	statusCache.Unlock()
+	statusCache.set(ref, sha, info)
 
 	return info, nil
 }
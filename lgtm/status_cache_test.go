@@ -47,10 +47,22 @@ func TestGetStatusInCache(t *testing.T) {
 	context := &ctx.Context{GitHub: client}
 	expectedInfo := &statusInfo{
 		lgtmers: []string{"@SuriyaaKudoIsc"},
+		quorum:  ref.Repo.Quorum,
+		sha:     prSHA,
 	}
 
 	statusCache = statusMap{data: make(map[string]*statusInfo)}
-	statusCache.data[ref.String()] = expectedInfo
+	statusCache.data[statusKey(ref, prSHA)] = expectedInfo
+
+	mux.HandleFunc(pullRequestGET, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&github.PullRequest{
+			Number: github.Int(ref.Number),
+			Head:   &github.PullRequestBranch{SHA: github.String(prSHA)},
+		})
+	})
+	mux.HandleFunc(statusesGET, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the Statuses API endpoint shouldn't be hit")
+	})
 
 	info, err := getStatus(context, ref)
 
@@ -58,6 +70,27 @@ func TestGetStatusInCache(t *testing.T) {
 	assert.Equal(t, expectedInfo, info)
 }
 
+func TestGetStatusIgnoresOtherHeads(t *testing.T) {
+	setup() // server & client!
+	defer teardown()
+	context := &ctx.Context{GitHub: client}
+	statusCache = statusMap{data: make(map[string]*statusInfo)}
+	statusCache.set(ref, "0ld5ha", &statusInfo{lgtmers: []string{"@SuriyaaKudoIsc"}, sha: "0ld5ha"})
+
+	mux.HandleFunc(statusesGET, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]github.RepoStatus{
+			{Context: github.String("o/lgtm"), Description: github.String("Awaiting approval from at least 1 maintainer.")},
+		})
+	})
+
+	info, err := getStatusForSHA(context, ref, prSHA)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{}, info.lgtmers)
+	assert.Equal(t, info, statusCache.previous(ref, "0ld5ha"))
+	assert.Nil(t, statusCache.previous(ref, prSHA))
+}
+
 func TestGetStatusAPIPRError(t *testing.T) {
 	setup() // server & client!
 	defer teardown()
@@ -76,7 +109,7 @@ func TestGetStatusAPIPRError(t *testing.T) {
 	assert.True(t, prHandled, "the PR API endpoint should be hit")
 	assert.Error(t, err)
 	assert.Nil(t, info)
-	assert.Nil(t, statusCache.data[ref.String()])
+	assert.Nil(t, statusCache.data[statusKey(ref, prSHA)])
 }
 
 func TestGetStatusAPIStatusesError(t *testing.T) {
@@ -111,7 +144,7 @@ func TestGetStatusAPIStatusesError(t *testing.T) {
 	assert.True(t, statusesHandled, "the Statuses API endpoint should be hit")
 	assert.Error(t, err)
 	assert.Nil(t, info)
-	assert.Nil(t, statusCache.data[ref.String()])
+	assert.Nil(t, statusCache.data[statusKey(ref, prSHA)])
 }
 
 func TestGetStatusAPIStatusesNoneMatch(t *testing.T) {
@@ -155,7 +188,7 @@ func TestGetStatusAPIStatusesNoneMatch(t *testing.T) {
 	assert.True(t, statusesHandled, "the Statuses API endpoint should be hit")
 	assert.NoError(t, err)
 	assert.Equal(t, expectedStatus, info)
-	assert.Equal(t, info, statusCache.data[ref.String()])
+	assert.Equal(t, info, statusCache.data[statusKey(ref, prSHA)])
 }
 
 func TestGetStatusFromAPI(t *testing.T) {
@@ -205,7 +238,7 @@ func TestGetStatusFromAPI(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, expectedStatus, info)
 	assert.Equal(t, expectedRepoStatus, info.repoStatus)
-	assert.Equal(t, info, statusCache.data[ref.String()])
+	assert.Equal(t, info, statusCache.data[statusKey(ref, prSHA)])
 }
 
 func TestSetStatus(t *testing.T) {
@@ -243,7 +276,7 @@ func TestSetStatus(t *testing.T) {
 		newStatus,
 	))
 	assert.True(t, statusesHandled, "the Statuses API endpoint should be hit")
-	assert.Equal(t, newStatus, statusCache.data[ref.String()])
+	assert.Equal(t, newStatus, statusCache.data[statusKey(ref, prSHA)])
 }
 
 func TestSetStatusHTTPError(t *testing.T) {
@@ -273,7 +306,7 @@ func TestSetStatusHTTPError(t *testing.T) {
 		newStatus,
 	))
 	assert.True(t, statusesHandled, "the Statuses API endpoint should be hit")
-	assert.Nil(t, statusCache.data[ref.String()])
+	assert.Nil(t, statusCache.data[statusKey(ref, prSHA)])
 }
 
 func TestNewEmptyStatus(t *testing.T) {
@@ -10,21 +10,41 @@ import (
 )
 
 var lgtmerExtractor = regexp.MustCompile("@[a-zA-Z0-9_-]+")
+
+// missingPrefix starts the part of a description listing what the repo's
+// rules still need.
+const missingPrefix = " Missing: "
+
 var remainingLGTMsExtractor = regexp.MustCompile(`Waiting for approval from at least (\d+)|Requires (\d+) more LGTM('s)?`)
 
+// maxDescriptionLength is the longest description GitHub accepts.
+const maxDescriptionLength = 140
+
 type statusInfo struct {
 	lgtmers    []string
 	quorum     int
 	sha        string
 	repoStatus *github.RepoStatus
+
+	// The PR's author, whose own LGTM never counts, and its base branch &
+	// commit. Empty until known.
+	author, base, baseSHA string
+	// missing describes the approvals the repo's rules still need, e.g.
+	// "1 LGTM from bunto/core". It is recomputed rather than parsed.
+	missing []string
 }
 
 func parseStatus(sha string, repoStatus *github.RepoStatus) *statusInfo {
 	status := &statusInfo{sha: sha, repoStatus: repoStatus, lgtmers: []string{}}
 
 	if repoStatus.Description != nil {
-		// Extract LGTMers.
-		lgtmersExtracted := lgtmerExtractor.FindAllStringSubmatch(*repoStatus.Description, -1)
+		// Extract LGTMers. What's missing mentions no users, but is left out
+		// in case a file path has an "@".
+		description := *repoStatus.Description
+		if i := strings.Index(description, missingPrefix); i >= 0 {
+			description = description[:i]
+		}
+		lgtmersExtracted := lgtmerExtractor.FindAllStringSubmatch(description, -1)
 		if len(lgtmersExtracted) > 0 {
 			for _, lgtmerWrapping := range lgtmersExtracted {
 				for _, lgtmer := range lgtmerWrapping {
@@ -36,7 +56,7 @@ func parseStatus(sha string, repoStatus *github.RepoStatus) *statusInfo {
 		status.quorum = len(status.lgtmers)
 
 		// Extract additional quorum. :)
-		extractedRemainingLGTMs := remainingLGTMsExtractor.FindAllStringSubmatch(*repoStatus.Description, -1)
+		extractedRemainingLGTMs := remainingLGTMsExtractor.FindAllStringSubmatch(description, -1)
 		if len(extractedRemainingLGTMs) > 0 && len(extractedRemainingLGTMs[0]) > 2 {
 			remainingLGTMsString := extractedRemainingLGTMs[0][1]
 			if remainingLGTMsString == "" {
@@ -65,16 +85,89 @@ func (s statusInfo) IsLGTMer(username string) bool {
 	return false
 }
 
+// copy returns a copy of the status which may be changed without changing
+// the status.
+func (s *statusInfo) copy() *statusInfo {
+	c := *s
+	c.lgtmers = append([]string{}, s.lgtmers...)
+	c.missing = append([]string(nil), s.missing...)
+	return &c
+}
+
+func (s *statusInfo) addLGTMer(username string) {
+	s.lgtmers = append(s.lgtmers, "@"+strings.TrimPrefix(username, "@"))
+}
+
+func (s *statusInfo) removeLGTMer(username string) {
+	lowerUsername := strings.ToLower(strings.TrimPrefix(username, "@"))
+	lgtmers := []string{}
+	for _, lgtmer := range s.lgtmers {
+		if strings.ToLower(strings.TrimPrefix(lgtmer, "@")) != lowerUsername {
+			lgtmers = append(lgtmers, lgtmer)
+		}
+	}
+	s.lgtmers = lgtmers
+}
+
+// setPullRequest records the author & base of the PR.
+func (s *statusInfo) setPullRequest(pr *github.PullRequest) {
+	if author := loginOf(pr.User); author != "" {
+		s.author = author
+	}
+	if pr.Base != nil {
+		if pr.Base.Ref != nil {
+			s.base = *pr.Base.Ref
+		}
+		if pr.Base.SHA != nil {
+			s.baseSHA = *pr.Base.SHA
+		}
+	}
+}
+
+// approvers returns the logins of the LGTMers which count: all but the PR's
+// author.
+func (s statusInfo) approvers() []string {
+	approvers := []string{}
+	for _, lgtmer := range s.lgtmers {
+		login := strings.TrimPrefix(lgtmer, "@")
+		if s.author == "" || !strings.EqualFold(login, s.author) {
+			approvers = append(approvers, login)
+		}
+	}
+	return approvers
+}
+
 func (s statusInfo) newState() string {
-	if len(s.lgtmers) >= s.quorum {
+	if len(s.approvers()) >= s.quorum && len(s.missing) == 0 {
 		return "success"
 	}
 	return "pending"
 }
 
 // newDescription produces the LGTM status description based on the LGTMers
-// and quorum values specified for this statusInfo.
+// and quorum values specified for this statusInfo, followed by what the
+// repo's rules still need, if anything.
 func (s statusInfo) newDescription() string {
+	if len(s.missing) == 0 {
+		return s.newQuorumDescription()
+	}
+
+	description := s.newApprovedByDescription()
+	if requiredLGTMsDesc := s.newLGTMsRequiredDescription(); requiredLGTMsDesc != "" {
+		description += " " + requiredLGTMsDesc
+	}
+	missing := strings.Join(s.missing, ", ")
+	if room := maxDescriptionLength - len(description) - len(missingPrefix) - 1; len(missing) > room && room >= 3 {
+		missing = missing[:room-3] + "..."
+	}
+	description += missingPrefix + missing + "."
+	if len(description) > maxDescriptionLength {
+		description = description[:maxDescriptionLength-3] + "..."
+	}
+	return description
+}
+
+func (s statusInfo) newQuorumDescription() string {
 	if s.quorum == 0 {
 		return "No approval is required."
 	}
@@ -95,7 +188,7 @@ func (s statusInfo) newDescription() string {
 }
 
 func (s statusInfo) newLGTMsRequiredDescription() string {
-	remaining := s.quorum - len(s.lgtmers)
+	remaining := s.quorum - len(s.approvers())
 
 	switch {
 	case remaining <= 0:
@@ -20,6 +20,7 @@ func TestParseStatus(t *testing.T) {
 		// {"deadbeef", "Waiting for approval from at least 22 maintainers.", []string{}, 22},
 		{"deadbeef", "Approved by @SuriyaaKudoIsc. Requires 1 more LGTM.", []string{"@SuriyaaKudoIsc"}, 2},
 		{"deadbeef", "@SuriyaaKudoIsc have approved this PR. Requires 32 more LGTM's.", []string{"@SuriyaaKudoIsc"}, 33},
+		{"deadbeef", "Approved by @SuriyaaKudoIsc. Missing: a code owner of docs/@mentions.md.", []string{"@SuriyaaKudoIsc"}, 1},
 		// {"deadbeef", "@SuriyaaKudoIsc, and @aahashderuffy have approved this PR.", []string{"@SuriyaaKudoIsc", "@aahashderuffy"}, 2},
 		// {"deadbeef", "@subins2000, @SuriyaaKudoIsc have approved this PR. Requires no more LGTM's.", []string{"@subins2000", "@SuriyaaKudoIsc", "@aahashderuffy"}, 3},
 	}
@@ -126,6 +127,31 @@ func TestLGTMsRequiredDescription(t *testing.T) {
 func TestNewApprovedByDescription(t *testing.T) {
 }
 
+func TestNewDescriptionWithApprovals(t *testing.T) {
+	cases := []struct {
+		info        statusInfo
+		state       string
+		description string
+	}{
+		// The author's LGTM doesn't count.
+		{statusInfo{lgtmers: []string{"@octocat"}, quorum: 1, author: "OctoCat"}, "pending", "Approved by @octocat. Requires 1 more LGTM."},
+		{statusInfo{quorum: 0, missing: []string{"1 LGTM from bunto/core"}}, "pending", "Not yet approved by any maintainers. Missing: 1 LGTM from bunto/core."},
+		{statusInfo{lgtmers: []string{"@SuriyaaKudoIsc"}, quorum: 2, missing: []string{"2 LGTM's from bunto/core", "code owners of 3 files"}},
+			"pending", "Approved by @SuriyaaKudoIsc. Requires 1 more LGTM. Missing: 2 LGTM's from bunto/core, code owners of 3 files."},
+		{statusInfo{lgtmers: []string{"@SuriyaaKudoIsc"}, quorum: 1, missing: []string{"a code owner of docs/_docs/plugins/generators/a-very-long-file-name-for-the-status-description.md", "1 LGTM from bunto/core"}},
+			"pending", "Approved by @SuriyaaKudoIsc. Missing: a code owner of docs/_docs/plugins/generators/a-very-long-file-name-for-the-status-description.md,...."},
+		// No room is left for what's missing.
+		{statusInfo{lgtmers: []string{"@SuriyaaKudoIsc", "@DirtyF", "@octocat", "@mattr-", "@parkr", "@pathawks", "@benbalter", "@ashmaroli", "@oe"}, quorum: 10, missing: []string{"1 LGTM from bunto/core"}},
+			"pending", "Approved by @SuriyaaKudoIsc, @DirtyF, @octocat, @mattr-, @parkr, @pathawks, @benbalter, @ashmaroli, and @oe. Requires 1 more LGTM. Missin..."},
+	}
+	for _, test := range cases {
+		assert.Equal(t, test.state, test.info.newState())
+		actual := test.info.newDescription()
+		assert.Equal(t, test.description, actual)
+		assert.True(t, len(actual) <= 140, fmt.Sprintf("%q must be <= 140 chars.", actual))
+	}
+}
+
 func TestStatusInfoNewRepoStatus(t *testing.T) {
 	cases := []struct {
 		owner          string
@@ -159,3 +185,20 @@ func TestStatusInfoNewRepoStatus(t *testing.T) {
 		assert.True(t, len(*newStatus.Description) <= 140, fmt.Sprintf("%q must be <= 140 chars.", *newStatus.Description))
 	}
 }
+
+func TestStatusInfoAddAndRemoveLGTMer(t *testing.T) {
+	info := &statusInfo{lgtmers: []string{}}
+
+	info.addLGTMer("SuriyaaKudoIsc")
+	info.addLGTMer("@subins2000")
+	assert.Equal(t, []string{"@SuriyaaKudoIsc", "@subins2000"}, info.lgtmers)
+
+	info.removeLGTMer("suriyaakudoisc")
+	assert.Equal(t, []string{"@subins2000"}, info.lgtmers)
+
+	info.removeLGTMer("@aahashderuffy")
+	assert.Equal(t, []string{"@subins2000"}, info.lgtmers)
+
+	info.removeLGTMer("@subins2000")
+	assert.Equal(t, []string{}, info.lgtmers)
+}
@@ -0,0 +1,365 @@
+// queue persists webhook deliveries to disk until each of their handlers
+// has run, so that work isn't lost to a transient error or a restart.
+//
+// Every delivery is a JSON file in the "pending" directory. Its tasks (one
+// per handler) are run by a pool of workers and retried with exponential
+// backoff. Once a task has failed MaxAttempts times it is dead, and once a
+// delivery only has dead tasks left its file is moved to the "dead"
+// directory, where it can be inspected.
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxAttempts = 5
+	defaultBackoff     = 30 * time.Second
+	maxBackoff         = time.Hour
+
+	pendingDir = "pending"
+	deadDir    = "dead"
+)
+
+// Delivery is a webhook delivery along with the work left to do for it.
+type Delivery struct {
+	// ID is the X-GitHub-Delivery header of the webhook.
+	ID         string    `json:"id"`
+	EventType  string    `json:"event_type"`
+	Payload    []byte    `json:"payload"`
+	ReceivedAt time.Time `json:"received_at"`
+
+	// Tasks are the handlers which haven't succeeded yet.
+	Tasks []*Task `json:"tasks"`
+}
+
+// Task is one handler to run for a delivery.
+type Task struct {
+	// Key identifies the handler among those of the delivery.
+	Key         string    `json:"key"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+	Dead        bool      `json:"dead,omitempty"`
+}
+
+type taskRef struct {
+	deliveryID, key string
+}
+
+type Queue struct {
+	// Run runs a task. It must be set before calling Start, and must not
+	// modify the delivery or the task.
+	Run func(delivery *Delivery, task *Task) error
+
+	// Retryable decides whether a task which failed with the given error
+	// should be tried again. If nil, every error is retried. A task which
+	// isn't is dead right away.
+	Retryable func(err error) bool
+
+	// MaxAttempts is the number of times a task is tried before it is
+	// dead. Defaults to 5.
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry. It doubles with each
+	// attempt, up to an hour. Defaults to 30 seconds.
+	Backoff time.Duration
+
+	dir string
+
+	lock       sync.Mutex // protects 'deliveries' and the files
+	deliveries map[string]*Delivery
+
+	tasks chan taskRef
+}
+
+// Open returns a queue which stores its deliveries in dir, creating the
+// directory if necessary. Call Start to run the pending deliveries.
+func Open(dir string) (*Queue, error) {
+	for _, sub := range []string{pendingDir, deadDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &Queue{
+		dir:        dir,
+		deliveries: make(map[string]*Delivery),
+		tasks:      make(chan taskRef, 100),
+	}, nil
+}
+
+// Start loads the deliveries left pending by a previous run, schedules
+// their tasks and starts the given number of workers.
+func (q *Queue) Start(workers int) error {
+	if q.Run == nil {
+		return fmt.Errorf("queue: Run must be set before starting")
+	}
+
+	pending, err := q.load(pendingDir)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for _, delivery := range pending {
+		log.Printf("queue: resuming delivery %s (%s) with %d task(s)", delivery.ID, delivery.EventType, len(delivery.Tasks))
+		q.deliveries[delivery.ID] = delivery
+		for _, task := range delivery.Tasks {
+			if !task.Dead {
+				q.schedule(delivery.ID, task)
+			}
+		}
+	}
+	return nil
+}
+
+// Push persists the delivery, then schedules its tasks. Once Push returns
+// without error, the delivery survives a crash.
+func (q *Queue) Push(delivery *Delivery) error {
+	if delivery.ID == "" {
+		return fmt.Errorf("queue: delivery without an ID")
+	}
+	if len(delivery.Tasks) == 0 {
+		return nil
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if _, ok := q.deliveries[delivery.ID]; ok {
+		// GitHub redelivered it, but we haven't given up on it yet.
+		log.Printf("queue: delivery %s is already queued", delivery.ID)
+		return nil
+	}
+	if err := q.write(pendingDir, delivery); err != nil {
+		return err
+	}
+	q.deliveries[delivery.ID] = delivery
+	for _, task := range delivery.Tasks {
+		q.schedule(delivery.ID, task)
+	}
+	return nil
+}
+
+// Pending returns the IDs of the deliveries which still have tasks to run.
+func (q *Queue) Pending() []string {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	ids := []string{}
+	for id := range q.deliveries {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// DeadLetters returns the deliveries whose remaining tasks are all dead.
+func (q *Queue) DeadLetters() ([]*Delivery, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.load(deadDir)
+}
+
+// schedule queues the task for its next attempt. q.lock must be held.
+func (q *Queue) schedule(deliveryID string, task *Task) {
+	ref := taskRef{deliveryID: deliveryID, key: task.Key}
+	if delay := task.NextAttempt.Sub(time.Now()); delay > 0 {
+		time.AfterFunc(delay, func() { q.tasks <- ref })
+		return
+	}
+	go func() { q.tasks <- ref }()
+}
+
+func (q *Queue) work() {
+	for ref := range q.tasks {
+		q.lock.Lock()
+		delivery, task := q.find(ref)
+		q.lock.Unlock()
+		if task == nil {
+			continue
+		}
+
+		err := q.Run(delivery, task)
+		q.finish(delivery, task, err)
+	}
+}
+
+// find returns the delivery & task the ref points to. q.lock must be held.
+func (q *Queue) find(ref taskRef) (*Delivery, *Task) {
+	delivery, ok := q.deliveries[ref.deliveryID]
+	if !ok {
+		return nil, nil
+	}
+	for _, task := range delivery.Tasks {
+		if task.Key == ref.key && !task.Dead {
+			return delivery, task
+		}
+	}
+	return nil, nil
+}
+
+// finish records the outcome of an attempt at the task, and reschedules it
+// if it should be tried again.
+func (q *Queue) finish(delivery *Delivery, task *Task, err error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	task.Attempts++
+	switch {
+	case err == nil:
+		delivery.removeTask(task)
+	case q.Retryable != nil && !q.Retryable(err):
+		log.Printf("queue: %s for delivery %s failed, not retrying: %v", task.Key, delivery.ID, err)
+		task.LastError = err.Error()
+		task.Dead = true
+	case task.Attempts >= q.maxAttempts():
+		log.Printf("queue: %s for delivery %s failed %d times, giving up: %v", task.Key, delivery.ID, task.Attempts, err)
+		task.LastError = err.Error()
+		task.Dead = true
+	default:
+		task.LastError = err.Error()
+		task.NextAttempt = time.Now().Add(q.backoff(task.Attempts))
+		log.Printf("queue: %s for delivery %s failed, retrying at %s: %v", task.Key, delivery.ID, task.NextAttempt.Format(time.RFC3339), err)
+		q.schedule(delivery.ID, task)
+	}
+
+	if err := q.save(delivery); err != nil {
+		log.Printf("queue: couldn't save delivery %s: %v", delivery.ID, err)
+	}
+}
+
+// save persists the delivery's progress. A delivery without tasks left is
+// removed, and one with only dead tasks left is moved to the dead letters.
+// q.lock must be held.
+func (q *Queue) save(delivery *Delivery) error {
+	if !delivery.hasLiveTasks() {
+		delete(q.deliveries, delivery.ID)
+		if len(delivery.Tasks) > 0 {
+			if err := q.write(deadDir, delivery); err != nil {
+				return err
+			}
+		}
+		return os.Remove(q.path(pendingDir, delivery.ID))
+	}
+	return q.write(pendingDir, delivery)
+}
+
+func (q *Queue) maxAttempts() int {
+	if q.MaxAttempts <= 0 {
+		return defaultMaxAttempts
+	}
+	return q.MaxAttempts
+}
+
+// backoff returns how long to wait before the attempt after the given one.
+func (q *Queue) backoff(attempts int) time.Duration {
+	backoff := q.Backoff
+	if backoff <= 0 {
+		backoff = defaultBackoff
+	}
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+	return backoff
+}
+
+func (q *Queue) path(sub, id string) string {
+	return filepath.Join(q.dir, sub, filepath.Base(id)+".json")
+}
+
+// write atomically replaces the delivery's file in sub.
+func (q *Queue) write(sub string, delivery *Delivery) error {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Join(q.dir, sub), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), q.path(sub, delivery.ID))
+}
+
+// load reads every delivery in sub, oldest first.
+func (q *Queue) load(sub string) ([]*Delivery, error) {
+	files, err := ioutil.ReadDir(filepath.Join(q.dir, sub))
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := []*Delivery{}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(q.dir, sub, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		delivery := &Delivery{}
+		if err := json.Unmarshal(data, delivery); err != nil {
+			log.Printf("queue: skipping corrupt delivery %s: %v", file.Name(), err)
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	sort.Sort(byReceivedAt(deliveries))
+	return deliveries, nil
+}
+
+func (d *Delivery) removeTask(task *Task) {
+	for i, t := range d.Tasks {
+		if t == task {
+			d.Tasks = append(d.Tasks[:i], d.Tasks[i+1:]...)
+			return
+		}
+	}
+}
+
+func (d *Delivery) hasLiveTasks() bool {
+	for _, task := range d.Tasks {
+		if !task.Dead {
+			return true
+		}
+	}
+	return false
+}
+
+type byReceivedAt []*Delivery
+
+func (s byReceivedAt) Len() int           { return len(s) }
+func (s byReceivedAt) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byReceivedAt) Less(i, j int) bool { return s[i].ReceivedAt.Before(s[j].ReceivedAt) }
@@ -0,0 +1,161 @@
+package queue
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errTemporary = errors.New("502 Bad Gateway")
+
+// runner records the attempts at each task, and fails each task with the
+// errors it is given, in order.
+type runner struct {
+	sync.Mutex
+	failures map[string][]error
+	attempts map[string]int
+	done     chan string
+}
+
+func newRunner(failures map[string][]error) *runner {
+	return &runner{failures: failures, attempts: map[string]int{}, done: make(chan string, 100)}
+}
+
+func (r *runner) Run(delivery *Delivery, task *Task) error {
+	r.Lock()
+	defer r.Unlock()
+	attempt := r.attempts[task.Key]
+	r.attempts[task.Key]++
+	var err error
+	if attempt < len(r.failures[task.Key]) {
+		err = r.failures[task.Key][attempt]
+	}
+	r.done <- task.Key
+	return err
+}
+
+func (r *runner) wait(t *testing.T, n int) {
+	for i := 0; i < n; i++ {
+		select {
+		case <-r.done:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("only %d of %d attempts were made", i, n)
+		}
+	}
+	// Let the queue record the outcome of the last attempt.
+	time.Sleep(50 * time.Millisecond)
+}
+
+func newTestQueue(t *testing.T, dir string, r *runner) *Queue {
+	q, err := Open(dir)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	q.Run = r.Run
+	q.Retryable = func(err error) bool { return err == errTemporary }
+	q.Backoff = time.Millisecond
+	q.MaxAttempts = 3
+	return q
+}
+
+func newDelivery(id string, keys ...string) *Delivery {
+	delivery := &Delivery{ID: id, EventType: "issues", Payload: []byte(`{}`), ReceivedAt: time.Now()}
+	for _, key := range keys {
+		delivery.Tasks = append(delivery.Tasks, &Task{Key: key})
+	}
+	return delivery
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "queue")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return dir
+}
+
+func TestQueueRetriesAndDeadLetters(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	r := newRunner(map[string][]error{
+		"flaky":    {errTemporary},
+		"broken":   {errTemporary, errTemporary, errTemporary},
+		"rejected": {errors.New("not enabled for this repo")},
+	})
+	q := newTestQueue(t, dir, r)
+	assert.NoError(t, q.Start(2))
+
+	assert.NoError(t, q.Push(newDelivery("abc", "ok", "flaky", "broken", "rejected")))
+	r.wait(t, 1+2+3+1)
+
+	assert.Equal(t, map[string]int{"ok": 1, "flaky": 2, "broken": 3, "rejected": 1}, r.attempts)
+	assert.Empty(t, q.Pending())
+	_, err := os.Stat(filepath.Join(dir, pendingDir, "abc.json"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Errors which aren't retryable aren't retried, but aren't lost either.
+	dead, err := q.DeadLetters()
+	assert.NoError(t, err)
+	if assert.Len(t, dead, 1) && assert.Len(t, dead[0].Tasks, 2) {
+		assert.Equal(t, "broken", dead[0].Tasks[0].Key)
+		assert.Equal(t, 3, dead[0].Tasks[0].Attempts)
+		assert.Equal(t, errTemporary.Error(), dead[0].Tasks[0].LastError)
+		assert.True(t, dead[0].Tasks[0].Dead)
+
+		assert.Equal(t, "rejected", dead[0].Tasks[1].Key)
+		assert.Equal(t, 1, dead[0].Tasks[1].Attempts)
+		assert.Equal(t, "not enabled for this repo", dead[0].Tasks[1].LastError)
+		assert.True(t, dead[0].Tasks[1].Dead)
+	}
+}
+
+func TestQueueResumesPendingDeliveries(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	// Persisted, but never run: as if we crashed right after responding.
+	q := newTestQueue(t, dir, newRunner(nil))
+	assert.NoError(t, q.Push(newDelivery("abc", "lgtm", "affinity")))
+	assert.Equal(t, []string{"abc"}, q.Pending())
+
+	r := newRunner(nil)
+	restarted := newTestQueue(t, dir, r)
+	assert.NoError(t, restarted.Start(1))
+	r.wait(t, 2)
+
+	assert.Equal(t, map[string]int{"lgtm": 1, "affinity": 1}, r.attempts)
+	assert.Empty(t, restarted.Pending())
+}
+
+func TestQueuePushIgnoresRedeliveries(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	q := newTestQueue(t, dir, newRunner(nil))
+	assert.NoError(t, q.Push(newDelivery("abc", "lgtm")))
+	assert.NoError(t, q.Push(newDelivery("abc", "lgtm")))
+	assert.Equal(t, []string{"abc"}, q.Pending())
+
+	assert.Error(t, q.Push(newDelivery("", "lgtm")))
+	assert.NoError(t, q.Push(newDelivery("nothing-to-do")))
+	assert.Equal(t, []string{"abc"}, q.Pending())
+}
+
+func TestQueueBackoff(t *testing.T) {
+	q := &Queue{Backoff: time.Second}
+	assert.Equal(t, time.Second, q.backoff(1))
+	assert.Equal(t, 2*time.Second, q.backoff(2))
+	assert.Equal(t, 8*time.Second, q.backoff(4))
+	assert.Equal(t, time.Hour, q.backoff(20))
+
+	q = &Queue{}
+	assert.Equal(t, defaultBackoff, q.backoff(1))
+	assert.Equal(t, defaultMaxAttempts, q.maxAttempts())
+}
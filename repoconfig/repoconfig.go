@@ -0,0 +1,314 @@
+// repoconfig reads the .github/buntobot.yml file a repository may keep on
+// its default branch to override the org-level parameters of the handlers,
+// e.g. its lgtm quorum, stale exempt labels or changelog categories.
+//
+// Files are cached by blob SHA for CacheTTL. The cache entry for a repository
+// is dropped sooner by PushHandler whenever a push to the default branch
+// touches the file.
+package repoconfig
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/buntobot/auto-reply/auth"
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/google/go-github/github"
+	"gopkg.in/yaml.v2"
+)
+
+// Path is where the bot looks for a repository's configuration.
+const Path = ".github/buntobot.yml"
+
+// Config holds the parameters a repository may override. A nil field means
+// the org-level default applies.
+type Config struct {
+	LGTM      *LGTM      `yaml:"lgtm"`
+	Stale     *Stale     `yaml:"stale"`
+	Changelog *Changelog `yaml:"changelog"`
+	// Commands maps comment-driven commands, e.g. "merge", to the roles
+	// allowed to run them, replacing those of auth.DefaultPolicy.
+	Commands auth.Policy `yaml:"commands"`
+}
+
+type LGTM struct {
+	// The number of LGTM's a PR must get before going state: "success"
+	Quorum int `yaml:"quorum"`
+	// The level of access a user needs for their LGTM to count, e.g.
+	// "maintain".
+	Permission *auth.Permission `yaml:"permission"`
+}
+
+type Stale struct {
+	// If an issue has one of these labels, it is not stale.
+	ExemptLabels []string `yaml:"exempt_labels"`
+}
+
+type Changelog struct {
+	// The sections of the History file, replacing the default ones.
+	Categories []Category `yaml:"categories"`
+	// The level of access a user needs for "@buntobot: merge", e.g.
+	// "admin".
+	MergePermission *auth.Permission `yaml:"merge_permission"`
+}
+
+// Category is a changelog category, like "Site Enhancements" and such.
+type Category struct {
+	// "@buntobot: merge +<prefix>" files the PR under this category.
+	Prefix  string   `yaml:"prefix"`
+	Slug    string   `yaml:"slug"`
+	Section string   `yaml:"section"`
+	Labels  []string `yaml:"labels"`
+}
+
+// Parse reads a repository's YAML (or JSON) configuration.
+func Parse(data []byte) (*Config, error) {
+	config := &Config{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// QuorumOr returns the repo's lgtm quorum, or fallback if it doesn't set a
+// valid one.
+func (c *Config) QuorumOr(fallback int) int {
+	if c == nil || c.LGTM == nil || c.LGTM.Quorum <= 0 {
+		return fallback
+	}
+	return c.LGTM.Quorum
+}
+
+// Policy returns who may run which command on the repo: auth.DefaultPolicy,
+// with the lgtm & merge permissions and the commands set by the repo
+// replacing its own.
+func (c *Config) Policy() auth.Policy {
+	return c.PolicyOver(auth.DefaultPolicy)
+}
+
+// PolicyOver returns the base policy with the lgtm & merge permissions and
+// the commands set by the repo replacing its own.
+func (c *Config) PolicyOver(base auth.Policy) auth.Policy {
+	overrides := auth.Policy{}
+	if c == nil {
+		return base
+	}
+	if c.LGTM != nil && c.LGTM.Permission != nil {
+		overrides["lgtm"] = []auth.Role{auth.PermissionRole(*c.LGTM.Permission)}
+	}
+	if c.Changelog != nil && c.Changelog.MergePermission != nil {
+		overrides["merge"] = []auth.Role{auth.PermissionRole(*c.Changelog.MergePermission)}
+	}
+	return base.Merge(overrides).Merge(c.Commands)
+}
+
+// ExemptLabelsOr returns the repo's stale exempt labels, or fallback if it
+// doesn't set any.
+func (c *Config) ExemptLabelsOr(fallback []string) []string {
+	if c == nil || c.Stale == nil || c.Stale.ExemptLabels == nil {
+		return fallback
+	}
+	return c.Stale.ExemptLabels
+}
+
+// Categories returns the repo's changelog categories, or nil if it doesn't
+// set any.
+func (c *Config) Categories() []Category {
+	if c == nil || c.Changelog == nil {
+		return nil
+	}
+	return c.Changelog.Categories
+}
+
+// CacheTTL is how long a repository's configuration is trusted for. The
+// push events touching the file evict it sooner.
+var CacheTTL = time.Hour
+
+var cache = newConfigCache()
+
+type configCache struct {
+	sync.Mutex // protects 'entries' & 'configs'
+
+	// entries maps "owner/name" to the blob SHA of the repo's config file,
+	// or to "" if the repo has none.
+	entries map[string]cacheEntry
+
+	// configs maps the blob SHAs of entries to their parsed configuration.
+	configs map[string]*Config
+
+	now func() time.Time
+}
+
+type cacheEntry struct {
+	sha     string
+	expires time.Time
+}
+
+func newConfigCache() configCache {
+	return configCache{
+		entries: make(map[string]cacheEntry),
+		configs: make(map[string]*Config),
+		now:     time.Now,
+	}
+}
+
+// get returns the configuration of nwo, unless it isn't cached or has
+// expired.
+func (c *configCache) get(nwo string) (*Config, bool) {
+	c.Lock()
+	defer c.Unlock()
+	entry, ok := c.entries[nwo]
+	if !ok {
+		return nil, false
+	}
+	if !c.now().Before(entry.expires) {
+		delete(c.entries, nwo)
+		c.prune()
+		return nil, false
+	}
+	return c.configs[entry.sha], true
+}
+
+// parsed returns the configuration parsed from the blob sha, if any repo
+// still uses it.
+func (c *configCache) parsed(sha string) (*Config, bool) {
+	c.Lock()
+	defer c.Unlock()
+	config, ok := c.configs[sha]
+	return config, ok
+}
+
+func (c *configCache) set(nwo, sha string, config *Config) {
+	c.Lock()
+	defer c.Unlock()
+	c.entries[nwo] = cacheEntry{sha: sha, expires: c.now().Add(CacheTTL)}
+	if sha != "" {
+		c.configs[sha] = config
+	}
+	c.prune()
+}
+
+func (c *configCache) invalidate(nwo string) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.entries, nwo)
+	c.prune()
+}
+
+// prune drops the expired entries & the configurations no entry uses. The
+// lock must be held.
+func (c *configCache) prune() {
+	used := map[string]bool{}
+	for nwo, entry := range c.entries {
+		if !c.now().Before(entry.expires) {
+			delete(c.entries, nwo)
+			continue
+		}
+		used[entry.sha] = true
+	}
+	for sha := range c.configs {
+		if !used[sha] {
+			delete(c.configs, sha)
+		}
+	}
+}
+
+// Get returns the configuration of the given repository, or nil if it has
+// none or if it couldn't be read. An invalid file is logged and ignored, so
+// the org-level defaults apply.
+func Get(context *ctx.Context, owner, name string) *Config {
+	nwo := owner + "/" + name
+	if config, ok := cache.get(nwo); ok {
+		return config
+	}
+
+	contents, _, resp, err := context.GitHub.Repositories.GetContents(owner, name, Path, nil)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			cache.set(nwo, "", nil)
+		} else {
+			context.Log("repoconfig: couldn't fetch %s from %s: %v", Path, nwo, err)
+		}
+		return nil
+	}
+	if contents == nil || contents.SHA == nil {
+		// Path is a directory.
+		cache.set(nwo, "", nil)
+		return nil
+	}
+
+	sha := *contents.SHA
+	config, ok := cache.parsed(sha)
+	if !ok {
+		config = parseContents(context, nwo, contents)
+	}
+	cache.set(nwo, sha, config)
+	return config
+}
+
+func parseContents(context *ctx.Context, nwo string, contents *github.RepositoryContent) *Config {
+	if contents.Content == nil {
+		return nil
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.Replace(*contents.Content, "\n", "", -1))
+	if err != nil {
+		context.Log("repoconfig: couldn't decode %s of %s: %v", Path, nwo, err)
+		return nil
+	}
+	config, err := Parse(data)
+	if err != nil {
+		context.IncrStat("repoconfig.invalid")
+		context.Log("repoconfig: ignoring invalid %s of %s: %v", Path, nwo, err)
+		return nil
+	}
+	return config
+}
+
+// PushHandler drops the cached configuration of a repository when a push to
+// its default branch adds, modifies or removes the configuration file.
+func PushHandler(context *ctx.Context, payload interface{}) error {
+	event, ok := payload.(*github.PushEvent)
+	if !ok {
+		return context.NewSkip("repoconfig.PushHandler: not a push event")
+	}
+
+	if event.Repo == nil || event.Repo.Owner == nil || event.Repo.Owner.Name == nil || event.Repo.Name == nil {
+		return context.NewError("repoconfig.PushHandler: push event without a repository")
+	}
+	nwo := *event.Repo.Owner.Name + "/" + *event.Repo.Name
+
+	if event.Repo.DefaultBranch != nil && event.Ref != nil &&
+		*event.Ref != "refs/heads/"+*event.Repo.DefaultBranch {
+		return context.NewSkip("repoconfig.PushHandler: %s is not the default branch of %s", *event.Ref, nwo)
+	}
+
+	if !touchesConfig(event) {
+		return context.NewSkip("repoconfig.PushHandler: push to %s doesn't touch %s", nwo, Path)
+	}
+
+	cache.invalidate(nwo)
+	context.IncrStat("repoconfig.invalidated")
+	context.Log("repoconfig: %s changed on %s, dropped cached configuration", Path, nwo)
+	return nil
+}
+
+func touchesConfig(event *github.PushEvent) bool {
+	commits := []github.PushEventCommit{}
+	commits = append(commits, event.Commits...)
+	if event.HeadCommit != nil {
+		commits = append(commits, *event.HeadCommit)
+	}
+	for _, commit := range commits {
+		for _, files := range [][]string{commit.Added, commit.Modified, commit.Removed} {
+			for _, file := range files {
+				if file == Path {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+package repoconfig
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/buntobot/auto-reply/auth"
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+const testConfig = `
+lgtm:
+  quorum: 1
+  permission: maintain
+stale:
+  exempt_labels: [pinned, plugin-idea]
+changelog:
+  merge_permission: admin
+  categories:
+    - prefix: feat
+      slug: features
+      section: Features
+      labels: [feature]
+commands:
+  merge: [author, "team:core"]
+`
+
+func setup() (*http.ServeMux, *ctx.Context, func()) {
+	cache = newConfigCache()
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	client := github.NewClient(nil)
+	url, _ := url.Parse(server.URL)
+	client.BaseURL = url
+	client.UploadURL = url
+
+	return mux, &ctx.Context{GitHub: client}, server.Close
+}
+
+func serveConfig(mux *http.ServeMux, nwo, sha, config string, requests *int) {
+	mux.HandleFunc("/repos/"+nwo+"/contents/"+Path, func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		json.NewEncoder(w).Encode(&github.RepositoryContent{
+			Type:     github.String("file"),
+			Encoding: github.String("base64"),
+			SHA:      github.String(sha),
+			Content:  github.String(base64.StdEncoding.EncodeToString([]byte(config))),
+		})
+	})
+}
+
+func newPushEvent(ref string, modified ...string) *github.PushEvent {
+	return &github.PushEvent{
+		Ref: github.String(ref),
+		Repo: &github.PushEventRepository{
+			Owner:         &github.PushEventRepoOwner{Name: github.String("bunto")},
+			Name:          github.String("bunto-feed"),
+			DefaultBranch: github.String("master"),
+		},
+		Commits: []github.PushEventCommit{{Modified: modified}},
+	}
+}
+
+func TestParse(t *testing.T) {
+	config, err := Parse([]byte(testConfig))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 1, config.QuorumOr(2))
+	policy := config.Policy()
+	assert.Equal(t, []auth.Role{"maintain"}, policy.RolesFor("lgtm"))
+	assert.Equal(t, []auth.Role{"author", "team:core"}, policy.RolesFor("merge"))
+	assert.Equal(t, auth.DefaultPolicy["unstale"], policy.RolesFor("unstale"))
+	assert.Equal(t, []string{"pinned", "plugin-idea"}, config.ExemptLabelsOr([]string{"security"}))
+	assert.Equal(t, []Category{{"feat", "features", "Features", []string{"feature"}}}, config.Categories())
+
+	_, err = Parse([]byte("lgtm:\n  quorom: 1\n"))
+	assert.Error(t, err)
+	_, err = Parse([]byte("lgtm:\n  permission: owner\n"))
+	assert.Error(t, err)
+	_, err = Parse([]byte("commands:\n  merge: [maintainers]\n"))
+	assert.Error(t, err)
+}
+
+func TestNilConfigFallsBack(t *testing.T) {
+	var config *Config
+	assert.Equal(t, 2, config.QuorumOr(2))
+	assert.Equal(t, []string{"security"}, config.ExemptLabelsOr([]string{"security"}))
+	assert.Nil(t, config.Categories())
+	assert.Equal(t, auth.DefaultPolicy, config.Policy())
+
+	config = &Config{LGTM: &LGTM{Quorum: 0}}
+	assert.Equal(t, 2, config.QuorumOr(2))
+}
+
+func TestGetCachesBySHA(t *testing.T) {
+	mux, context, teardown := setup()
+	defer teardown()
+
+	feedRequests, seoRequests := 0, 0
+	serveConfig(mux, "bunto/bunto-feed", "abc123", testConfig, &feedRequests)
+	serveConfig(mux, "bunto/bunto-seo-tag", "abc123", testConfig, &seoRequests)
+
+	config := Get(context, "bunto", "bunto-feed")
+	assert.Equal(t, 1, config.QuorumOr(2))
+	assert.Equal(t, config, Get(context, "bunto", "bunto-feed"))
+	assert.Equal(t, 1, feedRequests)
+
+	// Same blob, same parsed configuration.
+	assert.True(t, config == Get(context, "bunto", "bunto-seo-tag"))
+	assert.Equal(t, 1, seoRequests)
+}
+
+func TestGetExpires(t *testing.T) {
+	mux, context, teardown := setup()
+	defer teardown()
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	requests := 0
+	serveConfig(mux, "bunto/bunto-feed", "abc123", testConfig, &requests)
+	Get(context, "bunto", "bunto-feed")
+	Get(context, "bunto", "bunto-feed")
+	assert.Equal(t, 1, requests)
+
+	now = now.Add(CacheTTL)
+	_, ok := cache.get("bunto/bunto-feed")
+	assert.False(t, ok)
+	assert.Empty(t, cache.configs)
+
+	Get(context, "bunto", "bunto-feed")
+	assert.Equal(t, 2, requests)
+}
+
+func TestGetWithoutConfig(t *testing.T) {
+	mux, context, teardown := setup()
+	defer teardown()
+
+	requests := 0
+	mux.HandleFunc("/repos/bunto/bunto/contents/"+Path, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.NotFound(w, r)
+	})
+
+	assert.Nil(t, Get(context, "bunto", "bunto"))
+	assert.Nil(t, Get(context, "bunto", "bunto"))
+	assert.Equal(t, 1, requests)
+}
+
+func TestGetIgnoresInvalidConfig(t *testing.T) {
+	mux, context, teardown := setup()
+	defer teardown()
+
+	requests := 0
+	serveConfig(mux, "bunto/bunto-feed", "def456", "lgtm: [", &requests)
+
+	assert.Nil(t, Get(context, "bunto", "bunto-feed"))
+	assert.Nil(t, Get(context, "bunto", "bunto-feed"))
+	assert.Equal(t, 1, requests)
+}
+
+func TestPushHandlerInvalidatesCache(t *testing.T) {
+	mux, context, teardown := setup()
+	defer teardown()
+
+	requests := 0
+	serveConfig(mux, "bunto/bunto-feed", "abc123", testConfig, &requests)
+	Get(context, "bunto", "bunto-feed")
+
+	assert.True(t, ctx.IsSkip(PushHandler(context, newPushEvent("refs/heads/master", "README.md"))))
+	assert.True(t, ctx.IsSkip(PushHandler(context, newPushEvent("refs/heads/topic", Path))))
+	Get(context, "bunto", "bunto-feed")
+	assert.Equal(t, 1, requests)
+
+	assert.NoError(t, PushHandler(context, newPushEvent("refs/heads/master", Path)))
+	Get(context, "bunto", "bunto-feed")
+	assert.Equal(t, 2, requests)
+
+	assert.Error(t, PushHandler(context, &github.IssuesEvent{}))
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/google/go-github/github"
 	"github.com/buntobot/auto-reply/ctx"
 	"github.com/buntobot/auto-reply/labeler"
+	"github.com/buntobot/auto-reply/repoconfig"
 )
 
 var (
@@ -38,6 +39,9 @@ func MarkAndCloseForRepo(context *ctx.Context, config Configuration) error {
 
 	owner, name, nonStaleIssues, failedIssues := context.Repo.Owner, context.Repo.Name, 0, 0
 
+	// The repo's own .github/buntobot.yml may list other exempt labels.
+	config.ExemptLabels = repoconfig.Get(context, owner, name).ExemptLabelsOr(config.ExemptLabels)
+
 	staleIssuesListOptions := &github.IssueListByRepoOptions{
 		State:       "open",
 		Sort:        "updated",
@@ -93,7 +97,7 @@ func MarkOrCloseIssue(context *ctx.Context, issue *github.Issue, config Configur
 	}
 
 	if !IsStale(issue, config) {
-		return context.NewError("stale: issue %s#%d is not stale", context.Repo, *issue.Number)
+		return context.NewSkip("stale: issue %s#%d is not stale", context.Repo, *issue.Number)
 	}
 
 	if hasStaleLabel(issue) {
@@ -0,0 +1,34 @@
+// stats reports webhook activity to statsd.
+package stats
+
+import (
+	"fmt"
+
+	"github.com/buntobot/auto-reply/ctx"
+	"github.com/google/go-github/github"
+)
+
+// StatusHandler increments a "status.<state>" stat for each status event,
+// tagged with the status context and repository.
+func StatusHandler(context *ctx.Context, payload interface{}) error {
+	status, ok := payload.(*github.StatusEvent)
+	if !ok {
+		return context.NewSkip("stats.StatusHandler: not an status event")
+	}
+
+	context.SetIssue(*status.Repo.Owner.Login, *status.Repo.Name, -1)
+
+	if context.Statsd != nil {
+		statName := fmt.Sprintf("status.%s", *status.State)
+		context.Log("context.Statsd.Count(%s, 1, []string{context:%s, repo:%s}, 1)", statName, *status.Context, context.Issue)
+		return context.Statsd.Incr(
+			statName,
+			[]string{
+				"context:" + *status.Context,
+				"repo:" + context.Issue.String(),
+			},
+			float64(1.0), // rate..?
+		)
+	}
+	return nil
+}
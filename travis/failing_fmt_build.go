@@ -35,19 +35,19 @@ type travisJobConfig struct {
 func FailingFmtBuildHandler(context *ctx.Context, payload interface{}) error {
 	status, ok := payload.(*github.StatusEvent)
 	if !ok {
-		return context.NewError("FailingFmtBuildHandler: not an status event")
+		return context.NewSkip("FailingFmtBuildHandler: not an status event")
 	}
 
 	if *status.State != "failure" {
-		return context.NewError("FailingFmtBuildHandler: not a failure status event")
+		return context.NewSkip("FailingFmtBuildHandler: not a failure status event")
 	}
 
 	if *status.Context != "continuous-integration/travis-ci/push" {
-		return context.NewError("FailingFmtBuildHandler: not a continuous-integration/travis-ci/push context")
+		return context.NewSkip("FailingFmtBuildHandler: not a continuous-integration/travis-ci/push context")
 	}
 
 	if status.Branches != nil && len(status.Branches) > 0 && *status.Branches[0].Name != "master" {
-		return context.NewError("FailingFmtBuildHandler: not a travis build on the master branch")
+		return context.NewSkip("FailingFmtBuildHandler: not a travis build on the master branch")
 	}
 
 	context.SetRepo(*status.Repo.Owner.Login, *status.Repo.Name)